@@ -0,0 +1,213 @@
+package jcp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"go.uber.org/zap"
+)
+
+const (
+	cacheFileExt   = ".json"
+	logJWKSURL     = "jwksURL"
+	tempFilePrefix = ".jcp-"
+)
+
+var (
+	// ErrCacheCorrupt is returned when a cached JWK Set fails its integrity check.
+	ErrCacheCorrupt = errors.New("cached JWK Set is corrupt")
+	// ErrCacheExpired is returned when a cached JWK Set is older than the maximum age.
+	ErrCacheExpired = errors.New("cached JWK Set is older than the maximum age")
+)
+
+// JWKSCache is a persistent on-disk cache of JWK Sets. It allows the proxy to start when a remote JWK Set resource is
+// unavailable, as long as a copy of that JWK Set was fetched recently enough.
+type JWKSCache struct {
+	dir    string
+	logger *zap.Logger
+	maxAge time.Duration
+}
+
+type cacheEntry struct {
+	Checksum string          `json:"checksum"`
+	Fetched  time.Time       `json:"fetched"`
+	JWKS     json.RawMessage `json:"jwks"`
+	URL      string          `json:"url"`
+}
+
+// NewJWKSCache creates a new JWKSCache that stores JWK Sets in the given directory. The directory is created if it
+// does not exist. Cached JWK Sets older than maxAge are ignored.
+func NewJWKSCache(dir string, maxAge time.Duration, logger *zap.Logger) (JWKSCache, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return JWKSCache{}, fmt.Errorf("failed to create JWK Set cache directory: %w", err)
+	}
+	c := JWKSCache{
+		dir:    dir,
+		logger: logger,
+		maxAge: maxAge,
+	}
+	return c, nil
+}
+
+// Load reads the cached JWK Set for the given URL. It returns ErrCacheCorrupt if the cache file fails its integrity
+// check and ErrCacheExpired if the cached JWK Set is older than the maximum age.
+func (c JWKSCache) Load(jwksURL string) (raw json.RawMessage, fetched time.Time, err error) {
+	data, err := os.ReadFile(c.path(jwksURL))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read cached JWK Set: %w", err)
+	}
+	var entry cacheEntry
+	err = json.Unmarshal(data, &entry)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to JSON parse cached JWK Set: %s: %w", err, ErrCacheCorrupt)
+	}
+	if entry.URL != jwksURL || entry.Checksum != checksum(entry.JWKS) {
+		return nil, time.Time{}, fmt.Errorf("cached JWK Set failed integrity check: %w", ErrCacheCorrupt)
+	}
+	if c.maxAge > 0 && time.Since(entry.Fetched) > c.maxAge {
+		return nil, time.Time{}, fmt.Errorf("cached JWK Set fetched at %s: %w", entry.Fetched, ErrCacheExpired)
+	}
+	return entry.JWKS, entry.Fetched, nil
+}
+
+// Store writes the JWK Set for the given URL to the cache along with the time it was fetched. The write is atomic, so
+// a crash during the write will not leave a partially written cache file behind.
+func (c JWKSCache) Store(jwksURL string, raw json.RawMessage, fetched time.Time) error {
+	// The JWK Set is compacted when the entry is marshaled, so the checksum is computed over the compacted form that is
+	// read back by Load.
+	compact, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("failed to JSON marshal JWK Set: %w", err)
+	}
+	data, err := json.Marshal(cacheEntry{
+		Checksum: checksum(compact),
+		Fetched:  fetched,
+		JWKS:     compact,
+		URL:      jwksURL,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to JSON marshal JWK Set cache entry: %w", err)
+	}
+
+	err = writeFileAtomic(c.path(jwksURL), data)
+	if err != nil {
+		return fmt.Errorf("failed to write JWK Set cache file: %w", err)
+	}
+	return nil
+}
+
+// Transport wraps the given http.RoundTripper for the JWK Set at the given URL. Every successfully fetched JWK Set is
+// written to the cache. If the very first fetch fails, such as on startup while the remote resource is down, the cached
+// JWK Set is served in its place.
+func (c JWKSCache) Transport(jwksURL string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &cacheTransport{
+		base:    base,
+		cache:   c,
+		jwksURL: jwksURL,
+	}
+}
+
+func (c JWKSCache) path(jwksURL string) string {
+	return filepath.Join(c.dir, checksum([]byte(jwksURL))+cacheFileExt)
+}
+
+type cacheTransport struct {
+	base    http.RoundTripper
+	cache   JWKSCache
+	jwksURL string
+	started atomic.Bool
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	first := !t.started.Swap(true)
+
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusOK {
+		raw, readErr := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if readErr != nil {
+			return nil, readErr
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(raw))
+		if _, parseErr := keyfunc.NewJSON(raw); parseErr == nil {
+			storeErr := t.cache.Store(t.jwksURL, raw, time.Now())
+			if storeErr != nil {
+				t.cache.logger.Warn("Failed to cache JWK Set.", zap.String(logJWKSURL, t.jwksURL), zap.Error(storeErr))
+			}
+		}
+		return resp, nil
+	}
+	if !first {
+		return resp, err
+	}
+
+	raw, fetched, loadErr := t.cache.Load(t.jwksURL)
+	if loadErr != nil {
+		t.cache.logger.Warn("Failed to load JWK Set from cache after failed fetch.", zap.String(logJWKSURL, t.jwksURL), zap.Error(loadErr))
+		return resp, err
+	}
+	if resp != nil {
+		_ = resp.Body.Close()
+	}
+	t.cache.logger.Warn("Failed to fetch JWK Set on startup. Using cached copy.", zap.String(logJWKSURL, t.jwksURL), zap.Time("fetched", fetched), zap.Error(err))
+	return &http.Response{
+		Body:          io.NopCloser(bytes.NewReader(raw)),
+		ContentLength: int64(len(raw)),
+		Header:        http.Header{HeaderContentType: []string{ContentTypeJSON}},
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Request:       req,
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+	}, nil
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory, then renames it into place. A crash during the
+// write will not leave a partially written file behind.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), tempFilePrefix+"*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tempName := f.Name()
+	defer os.Remove(tempName) // Fails harmlessly after a successful rename.
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to close temporary file: %w", closeErr)
+	}
+
+	err = os.Rename(tempName, path)
+	if err != nil {
+		return fmt.Errorf("failed to move temporary file into place: %w", err)
+	}
+	return nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,121 @@
+package jcp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"go.uber.org/zap"
+
+	"github.com/MicahParks/jcp"
+)
+
+func TestJWKSCache(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := jcp.NewJWKSCache(dir, time.Hour, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v.", err)
+	}
+
+	raw := []byte(`{"keys":[]}`)
+	err = cache.Store(validURL, raw, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to store JWK Set: %v.", err)
+	}
+	loaded, _, err := cache.Load(validURL)
+	if err != nil {
+		t.Fatalf("Failed to load JWK Set: %v.", err)
+	}
+	if string(loaded) != string(raw) {
+		t.Fatalf("Expected cached JWK Set %s, got %s.", raw, loaded)
+	}
+
+	pretty := []byte("{\n  \"keys\": [\n    {\"kty\": \"OKP\", \"x5u\": \"https://example.com/?a=1&b=2\"}\n  ]\n}\n")
+	err = cache.Store(validURL, pretty, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to store pretty-printed JWK Set: %v.", err)
+	}
+	loaded, _, err = cache.Load(validURL)
+	if err != nil {
+		t.Fatalf("Failed to load pretty-printed JWK Set: %v.", err)
+	}
+	var want, got any
+	if json.Unmarshal(pretty, &want) != nil || json.Unmarshal(loaded, &got) != nil || !reflect.DeepEqual(want, got) {
+		t.Fatalf("Expected cached JWK Set %s, got %s.", pretty, loaded)
+	}
+
+	err = cache.Store(validURL, raw, time.Now().Add(-2*time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to store JWK Set: %v.", err)
+	}
+	_, _, err = cache.Load(validURL)
+	if !errors.Is(err, jcp.ErrCacheExpired) {
+		t.Fatalf("Expected error %v, got %v.", jcp.ErrCacheExpired, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read cache directory: %v.", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 cache file, got %d.", len(entries))
+	}
+	err = os.WriteFile(filepath.Join(dir, entries[0].Name()), []byte(`{"jwks":{"keys":[]},"checksum":"bad"}`), 0600)
+	if err != nil {
+		t.Fatalf("Failed to corrupt cache file: %v.", err)
+	}
+	_, _, err = cache.Load(validURL)
+	if !errors.Is(err, jcp.ErrCacheCorrupt) {
+		t.Fatalf("Expected error %v, got %v.", jcp.ErrCacheCorrupt, err)
+	}
+}
+
+func TestJWKSCache_Transport(t *testing.T) {
+	cache, err := jcp.NewJWKSCache(t.TempDir(), time.Hour, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v.", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jwksServer.Config.Handler.ServeHTTP(w, r)
+	}))
+	u := server.URL
+	options := keyfunc.Options{
+		Client: &http.Client{
+			Transport: cache.Transport(u, http.DefaultTransport),
+		},
+	}
+	jwks, err := keyfunc.Get(u, options)
+	if err != nil {
+		t.Fatalf("Failed to get JWK Set: %v.", err)
+	}
+	if jwks.Len() != 1 {
+		t.Fatalf("Expected 1 key, got %d.", jwks.Len())
+	}
+	server.Close()
+
+	// Simulate a cold start while the remote JWK Set resource is down.
+	options.Client = &http.Client{
+		Transport: cache.Transport(u, http.DefaultTransport),
+	}
+	jwks, err = keyfunc.Get(u, options)
+	if err != nil {
+		t.Fatalf("Failed to get JWK Set from cache: %v.", err)
+	}
+	if jwks.Len() != 1 {
+		t.Fatalf("Expected 1 cached key, got %d.", jwks.Len())
+	}
+
+	err = jwks.Refresh(context.Background(), keyfunc.RefreshOptions{})
+	if err == nil {
+		t.Fatal("Expected refresh after startup to fail without the cache.")
+	}
+}
@@ -0,0 +1,33 @@
+package jcp
+
+import (
+	"encoding/json"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// tokenClaims are the claims of a validated JWT. It holds the claims JCP understands in addition to the registered
+// claims.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	pipelineClaims
+	Act        *Actor                     `json:"act"`
+	AtHash     string                     `json:"at_hash"`
+	AuthTime   *jwt.NumericDate           `json:"auth_time"`
+	Azp        string                     `json:"azp"`
+	CHash      string                     `json:"c_hash"`
+	ClientID   string                     `json:"client_id"`
+	Cnf        *confirmation              `json:"cnf"`
+	Events     map[string]json.RawMessage `json:"events"`
+	Kubernetes *KubernetesClaims          `json:"kubernetes.io"`
+	Nonce      string                     `json:"nonce"`
+	SID        string                     `json:"sid"`
+	Toe        *jwt.NumericDate           `json:"toe"`
+	Txn        string                     `json:"txn"`
+}
+
+// confirmation is the `cnf` claim that binds a JWT to a key as defined in RFC 7800.
+type confirmation struct {
+	JKT     string `json:"jkt"`
+	X5TS256 string `json:"x5t#S256"`
+}
@@ -0,0 +1,105 @@
+package jcp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// HTTPClientConfig contains the configuration for the outbound HTTP client used to fetch a JWK Set.
+type HTTPClientConfig struct {
+	CABundle      string            `json:"caBundle"`
+	ClientCert    string            `json:"clientCert"`
+	ClientKey     string            `json:"clientKey"`
+	Headers       map[string]string `json:"headers"`
+	MinTLSVersion string            `json:"minTLSVersion"`
+	Proxy         string            `json:"proxy"`
+}
+
+// HTTPClient creates an HTTP client from the configuration. It returns nil if no client settings were given, so the
+// default client is used.
+func (h HTTPClientConfig) HTTPClient() (*http.Client, error) {
+	if h.CABundle == "" && h.ClientCert == "" && h.MinTLSVersion == "" && h.Proxy == "" {
+		return nil, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if h.Proxy != "" {
+		u, err := url.Parse(h.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse HTTP proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion: tlsVersions[h.MinTLSVersion],
+	}
+	if h.CABundle != "" {
+		roots, err := loadCertPool(h.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = roots
+	}
+	if h.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(h.ClientCert, h.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = tlsConfig
+	client := &http.Client{
+		Transport: transport,
+	}
+	return client, nil
+}
+
+// RequestFactory creates a function that adds the configured headers to requests for a JWK Set. It returns nil if no
+// headers were given, so the default request factory is used.
+func (h HTTPClientConfig) RequestFactory() func(ctx context.Context, u string) (*http.Request, error) {
+	if len(h.Headers) == 0 {
+		return nil
+	}
+	return func(ctx context.Context, u string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range h.Headers {
+			req.Header.Set(k, v)
+		}
+		return req, nil
+	}
+}
+
+func (h HTTPClientConfig) validate() error {
+	if h.Proxy != "" {
+		u, err := url.Parse(h.Proxy)
+		if err != nil {
+			return fmt.Errorf("failed to parse HTTP proxy URL: %q: %s: %w", h.Proxy, err, ErrInvalidConfig)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("invalid HTTP proxy URL scheme: %q: %w", u.Scheme, ErrInvalidConfig)
+		}
+	}
+	if h.MinTLSVersion != "" {
+		if _, ok := tlsVersions[h.MinTLSVersion]; !ok {
+			return fmt.Errorf("invalid minimum TLS version: %q: %w", h.MinTLSVersion, ErrInvalidConfig)
+		}
+	}
+	if (h.ClientCert == "") != (h.ClientKey == "") {
+		return fmt.Errorf("client certificate and client key must be given together: %w", ErrInvalidConfig)
+	}
+	return nil
+}
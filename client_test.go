@@ -0,0 +1,75 @@
+package jcp_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MicahParks/keyfunc"
+
+	"github.com/MicahParks/jcp"
+)
+
+func TestHTTPClientConfig(t *testing.T) {
+	const bearer = "Bearer " + anyNonEmptyString
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(jcp.HeaderAuthorization) != bearer || len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		jwksServer.Config.Handler.ServeHTTP(w, r)
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAnyClientCert,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	clientCert := createCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Test Client"}}, nil)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(clientCert.private)
+	if err != nil {
+		t.Fatalf("Failed to marshal private key: %v.", err)
+	}
+	config := jcp.HTTPClientConfig{
+		CABundle:   writeTemp(t, "ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})),
+		ClientCert: writeTemp(t, "client.pem", certPEM(clientCert)),
+		ClientKey:  writeTemp(t, "client.key", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})),
+		Headers: map[string]string{
+			jcp.HeaderAuthorization: bearer,
+		},
+		MinTLSVersion: "1.3",
+	}
+	client, err := config.HTTPClient()
+	if err != nil {
+		t.Fatalf("Failed to create HTTP client: %v.", err)
+	}
+
+	jwks, err := keyfunc.Get(server.URL, keyfunc.Options{
+		Client:         client,
+		RequestFactory: config.RequestFactory(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to get JWK Set: %v.", err)
+	}
+	if jwks.Len() != 1 {
+		t.Fatalf("Expected 1 key, got %d.", jwks.Len())
+	}
+
+	_, err = keyfunc.Get(server.URL, keyfunc.Options{
+		Client: client,
+	})
+	if !errors.Is(err, keyfunc.ErrInvalidHTTPStatusCode) {
+		t.Fatalf("Expected error %v without headers, got %v.", keyfunc.ErrInvalidHTTPStatusCode, err)
+	}
+
+	client, err = jcp.HTTPClientConfig{}.HTTPClient()
+	if err != nil || client != nil {
+		t.Fatalf("Expected no client and no error for empty config, got %v and %v.", client, err)
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"crypto"
+	"fmt"
 	"log"
 	"net/http"
 
@@ -34,29 +37,265 @@ func main() {
 
 	l.Info("Configuration read and validated.")
 
+	proxy, denylist, err := newProxy(config, l)
+	if err != nil {
+		l.Fatal("Failed to create proxy.", zap.Error(err))
+	}
+
+	var exchanger *jcp.Exchanger
+	if config.Exchange.Issuer != "" {
+		exchangeKeys := make(map[string]crypto.PrivateKey, len(config.Exchange.Keys))
+		for kid, k := range config.Exchange.Keys {
+			key, err := k.Key()
+			if err != nil {
+				l.Fatal("Failed to read token exchange signing key.", zap.String("kid", kid), zap.Error(err))
+			}
+			exchangeKeys[kid] = key
+		}
+		exchanger, err = jcp.NewExchanger(context.Background(), proxy, jcp.ExchangeOptions{
+			Audiences:           config.Exchange.Audiences,
+			Claims:              config.Exchange.Claims,
+			ExpressionCostLimit: config.ExpressionCostLimit,
+			Issuer:              config.Exchange.Issuer,
+			Keys:                exchangeKeys,
+			Policy:              config.Exchange.Policy,
+			RotationInterval:    config.Exchange.RotationInterval.Get(),
+			SigningKey:          config.Exchange.SigningKey,
+			TokenLifetime:       config.Exchange.TokenLifetime.Get(),
+		})
+		if err != nil {
+			l.Fatal("Failed to create token exchanger.", zap.Error(err))
+		}
+	}
+
+	handler := jcp.HTTPHandler{
+		AdminToken:       config.AdminToken,
+		ClientCertHeader: config.ForwardAuth.ClientCertHeader,
+		Denylist:         denylist,
+		Exchanger:        exchanger,
+		JWKSMaxAge:       config.JWKSMaxAge.Get(),
+		Logger:           l,
+		Proxy:            proxy,
+		RequestMaxBytes:  config.RequestMaxBytes,
+	}
+
+	http.Handle("/v1/forward-auth", handler.ForwardAuth())
+	http.Handle("/v1/jwks.json", handler.JWKS())
+	http.Handle("/v1/validate", handler.Validate())
+	if config.AdminToken != "" {
+		http.Handle("/v1/admin/revocations", handler.Revocations())
+	}
+	if exchanger != nil {
+		http.Handle("/v1/exchange", handler.Exchange())
+		http.Handle("/v1/exchange/jwks.json", handler.ExchangeJWKS())
+	}
+
+	err = http.ListenAndServe(config.ListenAddress, nil)
+	if err != nil {
+		l.Fatal("Failed to listen and serve.", zap.Error(err))
+	}
+}
+
+// newProxy creates the proxy and its denylist, if any, from the configuration.
+func newProxy(config jcp.Config, l *zap.Logger) (jcp.Proxy, *jcp.Denylist, error) {
+	var cache *jcp.JWKSCache
+	if config.CacheDir != "" {
+		c, err := jcp.NewJWKSCache(config.CacheDir, config.CacheMaxAge.Get(), l)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create JWK Set cache: %w", err)
+		}
+		cache = &c
+	}
+
 	multiple := make(map[string]keyfunc.Options, len(config.JWKS))
 	for u, jwks := range config.JWKS {
+		client, err := jwks.Client.HTTPClient()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create HTTP client for JWK Set %q: %w", u, err)
+		}
+		if cache != nil && !jcp.IsFileURL(u) {
+			transport := http.DefaultTransport
+			if client != nil {
+				transport = client.Transport
+			}
+			client = &http.Client{
+				Transport: cache.Transport(u, transport),
+			}
+		}
 		multiple[u] = keyfunc.Options{
+			Client:          client,
 			RefreshInterval: jwks.RefreshInterval.Get(),
 			RefreshTimeout:  jwks.RefreshTimeout.Get(),
+			RequestFactory:  jwks.Client.RequestFactory(),
 		}
 	}
 
-	proxy, err := jcp.NewProxy(multiple, keyfunc.MultipleOptions{})
-	if err != nil {
-		l.Fatal("Failed to create proxy.", zap.Error(err))
+	pemOptions := make(map[string]jcp.PEMOptions, len(config.PEM))
+	for u, p := range config.PEM {
+		pemOptions[u] = jcp.PEMOptions{
+			CABundle:    p.CABundle,
+			CheckExpiry: p.CheckExpiry,
+			KID:         p.KID,
+			RefreshErrorHandler: func(err error) {
+				l.Warn("Failed to refresh PEM key source.", zap.Error(err))
+			},
+			RefreshInterval: p.RefreshInterval.Get(),
+			RefreshTimeout:  p.RefreshTimeout.Get(),
+		}
 	}
 
-	handler := jcp.HTTPHandler{
-		Logger:          l,
-		Proxy:           proxy,
-		RequestMaxBytes: config.RequestMaxBytes,
+	pemMapOptions := make(map[string]jcp.PEMMapOptions, len(config.PEMMaps))
+	for u, p := range config.PEMMaps {
+		pemMapOptions[u] = jcp.PEMMapOptions{
+			CheckExpiry:      p.CheckExpiry,
+			RefreshInterval:  p.RefreshInterval.Get(),
+			RefreshRateLimit: p.RefreshRateLimit.Get(),
+			RefreshTimeout:   p.RefreshTimeout.Get(),
+		}
 	}
 
-	http.Handle("/v1/validate", handler.Validate())
+	keyURLOptions := make(map[string]jcp.KeyURLOptions, len(config.KeyURLs))
+	for template, k := range config.KeyURLs {
+		keyURLOptions[template] = jcp.KeyURLOptions{
+			MaxEntries:       k.MaxEntries,
+			RefreshRateLimit: k.RefreshRateLimit.Get(),
+			RefreshTimeout:   k.RefreshTimeout.Get(),
+		}
+	}
 
-	err = http.ListenAndServe(config.ListenAddress, nil)
+	kubernetesOptions := make(map[string]jcp.KubernetesOptions, len(config.Kubernetes))
+	for iss, k := range config.Kubernetes {
+		client, err := jcp.HTTPClientConfig{CABundle: k.CABundle}.HTTPClient()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create HTTP client for Kubernetes cluster %q: %w", iss, err)
+		}
+		kubernetesOptions[iss] = jcp.KubernetesOptions{
+			BearerTokenFile: k.BearerTokenFile,
+			Client:          client,
+			JWKSURL:         k.JWKSURL,
+			RefreshErrorHandler: func(err error) {
+				l.Warn("Failed to refresh Kubernetes JWK Set.", zap.Error(err))
+			},
+			RefreshInterval: k.RefreshInterval.Get(),
+			RefreshTimeout:  k.RefreshTimeout.Get(),
+		}
+	}
+
+	presetOptions := make(map[string]jcp.PresetOptions, len(config.Presets))
+	for profile, p := range config.Presets {
+		presetOptions[profile] = jcp.PresetOptions{
+			Issuer: p.Issuer,
+			RefreshErrorHandler: func(err error) {
+				l.Warn("Failed to refresh CI/CD preset JWK Set.", zap.Error(err))
+			},
+			RefreshInterval: p.RefreshInterval.Get(),
+			RefreshTimeout:  p.RefreshTimeout.Get(),
+		}
+	}
+
+	spiffeOptions := make(map[string]jcp.SPIFFEOptions, len(config.SPIFFE))
+	for td, s := range config.SPIFFE {
+		spiffeOptions[td] = jcp.SPIFFEOptions{
+			Bundle:           s.Bundle,
+			RefreshInterval:  s.RefreshInterval.Get(),
+			RefreshRateLimit: s.RefreshRateLimit.Get(),
+			RefreshTimeout:   s.RefreshTimeout.Get(),
+		}
+	}
+
+	var hmacKeys map[string]jcp.HMACKey
+	if config.HMAC.Enabled {
+		hmacKeys = make(map[string]jcp.HMACKey, len(config.HMAC.Keys))
+		for kid, k := range config.HMAC.Keys {
+			key, err := k.Key()
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read HMAC key %q: %w", kid, err)
+			}
+			hmacKeys[kid] = key
+		}
+	}
+
+	jweKeys := make(map[string]crypto.PrivateKey, len(config.JWE.Keys))
+	for kid, k := range config.JWE.Keys {
+		key, err := k.Key()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read JWE decryption key %q: %w", kid, err)
+		}
+		jweKeys[kid] = key
+	}
+
+	revokeSessions := false
+	for _, policy := range config.Policies {
+		revokeSessions = revokeSessions || policy.RevokeSessions
+	}
+	var denylist *jcp.Denylist
+	if config.AdminToken != "" || config.Revocation.File != "" || revokeSessions {
+		var err error
+		denylist, err = jcp.NewDenylist(jcp.DenylistOptions{
+			File:             config.Revocation.File,
+			MaxTokenLifetime: config.Revocation.MaxTokenLifetime.Get(),
+			RefreshErrorHandler: func(err error) {
+				l.Warn("Failed to reload revocations file.", zap.Error(err))
+			},
+			RefreshInterval: config.Revocation.RefreshInterval.Get(),
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create denylist: %w", err)
+		}
+	}
+
+	options := jcp.ProxyOptions{
+		Denylist: denylist,
+		DPoP: jcp.DPoPOptions{
+			ClockSkew:   config.DPoP.ClockSkew.Get(),
+			ProofMaxAge: config.DPoP.ProofMaxAge.Get(),
+		},
+		ExpressionCostLimit: config.ExpressionCostLimit,
+		HMAC:                hmacKeys,
+		Inline:              config.JWKSInline,
+		Issuers: jcp.IssuersOptions{
+			IdleTimeout: config.Issuers.IdleTimeout.Get(),
+			MaxEntries:  config.Issuers.MaxEntries,
+			Patterns:    config.Issuers.Patterns,
+			RefreshErrorHandler: func(err error) {
+				l.Warn("Failed to refresh issuer JWK Set.", zap.Error(err))
+			},
+			RefreshInterval: config.Issuers.RefreshInterval.Get(),
+			RefreshTimeout:  config.Issuers.RefreshTimeout.Get(),
+		},
+		JKU: jcp.JKUOptions{
+			AllowPrivate: config.JKU.AllowPrivate,
+			MaxEntries:   config.JKU.MaxEntries,
+			Prefixes:     config.JKU.Prefixes,
+			RefreshErrorHandler: func(err error) {
+				l.Warn("Failed to refresh jku JWK Set.", zap.Error(err))
+			},
+			RefreshInterval: config.JKU.RefreshInterval.Get(),
+			RefreshTimeout:  config.JKU.RefreshTimeout.Get(),
+		},
+		JWE: jcp.JWEOptions{
+			Algorithms:  config.JWE.Algorithms,
+			Encryptions: config.JWE.Encryptions,
+			Keys:        jweKeys,
+		},
+		KeyURLs:     keyURLOptions,
+		Kubernetes:  kubernetesOptions,
+		PEM:         pemOptions,
+		PEMMaps:     pemMapOptions,
+		Policies:    config.Policies,
+		Presets:     presetOptions,
+		ReplayStore: jcp.NewMemoryReplayStore(config.ReplayMaxEntries),
+		SPIFFE:      spiffeOptions,
+		X5C: jcp.X5COptions{
+			CABundle:     config.X5C.CABundle,
+			ExtKeyUsages: config.X5C.ExtKeyUsages,
+			Issuers:      config.X5C.Issuers,
+			Subject:      config.X5C.Subject,
+		},
+	}
+	proxy, err := jcp.NewProxyWithOptions(multiple, options)
 	if err != nil {
-		l.Fatal("Failed to listen and serve.", zap.Error(err))
+		return nil, nil, err
 	}
+	return proxy, denylist, nil
 }
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+
+	"github.com/MicahParks/jcp"
+)
+
+const (
+	replayPolicy = "replay"
+	resourceURL  = "https://resource.example.com/protected"
+	testKID      = "test-kid"
+)
+
+func TestNewProxy(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v.", err)
+	}
+	j := jwkset.NewMemory[any]()
+	err = j.Store.WriteKey(ctx, jwkset.NewKey[any](public, testKID))
+	if err != nil {
+		t.Fatalf("Failed to store key: %v.", err)
+	}
+	rawJWKS, err := j.JSONPublic(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get JWK Set: %v.", err)
+	}
+
+	config, err := jcp.Config{
+		JWKSInline: map[string]json.RawMessage{"inline": rawJWKS},
+		Policies: map[string]jcp.Policy{
+			replayPolicy: {RejectReplay: true},
+		},
+	}.DefaultsAndValidate()
+	if err != nil {
+		t.Fatalf("Failed to validate config: %v.", err)
+	}
+	proxy, _, err := newProxy(config, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	proofKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate DPoP key: %v.", err)
+	}
+	proofJWK := map[string]interface{}{
+		"crv": "P-256",
+		"kty": "EC",
+		"x":   base64.RawURLEncoding.EncodeToString(proofKey.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(proofKey.Y.FillBytes(make([]byte, 32))),
+	}
+	canonical, err := json.Marshal(proofJWK)
+	if err != nil {
+		t.Fatalf("Failed to marshal JWK: %v.", err)
+	}
+	jkt := sha256.Sum256(canonical)
+
+	sign := func(method jwt.SigningMethod, key interface{}, header map[string]interface{}, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		for k, v := range header {
+			token.Header[k] = v
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return signed
+	}
+	exp := time.Now().Add(time.Minute).Unix()
+	replayToken := sign(jwt.SigningMethodEdDSA, private, map[string]interface{}{"kid": testKID}, jwt.MapClaims{"exp": exp, "jti": "1"})
+	boundToken := sign(jwt.SigningMethodEdDSA, private, map[string]interface{}{"kid": testKID}, jwt.MapClaims{
+		"cnf": map[string]string{"jkt": base64.RawURLEncoding.EncodeToString(jkt[:])},
+		"exp": exp,
+	})
+	ath := sha256.Sum256([]byte(boundToken))
+	proof := sign(jwt.SigningMethodES256, proofKey, map[string]interface{}{"jwk": proofJWK, "typ": "dpop+jwt"}, jwt.MapClaims{
+		"ath": base64.RawURLEncoding.EncodeToString(ath[:]),
+		"htm": http.MethodGet,
+		"htu": resourceURL,
+		"iat": time.Now().Unix(),
+		"jti": "proof",
+	})
+
+	testCases := []struct {
+		args jcp.ValidateArgs
+		err  error
+		name string
+	}{
+		{
+			args: jcp.ValidateArgs{Policy: replayPolicy, Token: replayToken},
+			name: "Policy",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: replayPolicy, Token: replayToken},
+			err:  jcp.ErrReplay,
+			name: "PolicyReplay",
+		},
+		{
+			args: jcp.ValidateArgs{DPoP: proof, HTM: http.MethodGet, HTU: resourceURL, Token: boundToken},
+			name: "DPoP",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := proxy.Validate(ctx, tc.args)
+			if err != nil || tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+				}
+			}
+		})
+	}
+}
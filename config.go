@@ -1,15 +1,26 @@
 package jcp
 
 import (
+	"bytes"
+	"crypto"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/url"
+	"os"
+	"regexp"
 	"time"
 
 	"github.com/MicahParks/jsontype"
+	"github.com/MicahParks/keyfunc"
+	"github.com/google/cel-go/cel"
 )
 
 const (
+	// DefaultCacheMaxAge is the default maximum age of a cached JWK Set that can be used on startup.
+	DefaultCacheMaxAge = 24 * time.Hour
+	// DefaultFileRefreshInterval is the default time between checks for changes to a JWK Set on the local filesystem.
+	DefaultFileRefreshInterval = 10 * time.Second
 	// DefaultRefreshInterval is the default time between refreshes of the JWKS.
 	DefaultRefreshInterval = time.Hour
 	// DefaultRefreshTimeout is the default time to wait for a refresh of the JWKS before cancelling and logging an
@@ -38,27 +49,51 @@ type LogFormat string
 
 // Config contains the configuration for the JWKS client proxy.
 type Config struct {
-	JWKS            map[string]JWKSConfig `json:"jwks"`
-	ListenAddress   string                `json:"listenAddress"`
-	LogFormat       string                `json:"logFormat"`
-	RequestMaxBytes int64                 `json:"requestMaxBytes"`
+	AdminToken          string                            `json:"adminToken"`
+	CacheDir            string                            `json:"cacheDir"`
+	CacheMaxAge         *jsontype.JSONType[time.Duration] `json:"cacheMaxAge"`
+	DPoP                DPoPConfig                        `json:"dpop"`
+	Exchange            ExchangeConfig                    `json:"exchange"`
+	ExpressionCostLimit uint64                            `json:"expressionCostLimit"`
+	ForwardAuth         ForwardAuthConfig                 `json:"forwardAuth"`
+	HMAC                HMACConfig                        `json:"hmac"`
+	Issuers             IssuersConfig                     `json:"issuers"`
+	JKU                 JKUConfig                         `json:"jku"`
+	JWE                 JWEConfig                         `json:"jwe"`
+	JWKS                map[string]JWKSConfig             `json:"jwks"`
+	JWKSInline          map[string]json.RawMessage        `json:"jwksInline"`
+	JWKSMaxAge          *jsontype.JSONType[time.Duration] `json:"jwksMaxAge"`
+	KeyURLs             map[string]KeyURLConfig           `json:"keyURLs"`
+	Kubernetes          map[string]KubernetesConfig       `json:"kubernetes"`
+	ListenAddress       string                            `json:"listenAddress"`
+	LogFormat           string                            `json:"logFormat"`
+	PEM                 map[string]PEMConfig              `json:"pem"`
+	PEMMaps             map[string]PEMMapConfig           `json:"pemMaps"`
+	Policies            map[string]Policy                 `json:"policies"`
+	Presets             map[string]PresetConfig           `json:"presets"`
+	ReplayMaxEntries    int                               `json:"replayMaxEntries"`
+	RequestMaxBytes     int64                             `json:"requestMaxBytes"`
+	Revocation          RevocationConfig                  `json:"revocation"`
+	SPIFFE              map[string]SPIFFEConfig           `json:"spiffe"`
+	X5C                 X5CConfig                         `json:"x5c"`
 }
 
 // DefaultsAndValidate helps implement the jsontype.Config interface.
 func (c Config) DefaultsAndValidate() (Config, error) {
-	if len(c.JWKS) == 0 {
+	if len(c.JWKS) == 0 && len(c.JWKSInline) == 0 && len(c.PEM) == 0 && len(c.PEMMaps) == 0 && len(c.KeyURLs) == 0 && len(c.Kubernetes) == 0 && len(c.Presets) == 0 && !c.HMAC.Enabled && len(c.Issuers.Patterns) == 0 && len(c.JKU.Prefixes) == 0 && len(c.SPIFFE) == 0 && c.X5C.CABundle == "" {
 		return c, fmt.Errorf("%w: no JWKS provided", ErrInvalidConfig)
 	}
 	for k, v := range c.JWKS {
-		u, err := url.Parse(k)
+		refreshInterval, err := validateKeyURL(k)
 		if err != nil {
-			return c, fmt.Errorf("failed to parse JWK Set URL: %q: %s: %w", k, err, ErrInvalidConfig)
+			return c, err
 		}
-		if u.Scheme != "http" && u.Scheme != "https" {
-			return c, fmt.Errorf("invalid JWK Set URL scheme: %q: %w", u.Scheme, ErrInvalidConfig)
+		err = v.Client.validate()
+		if err != nil {
+			return c, fmt.Errorf("invalid HTTP client for JWK Set URL %q: %w", k, err)
 		}
 		if c.JWKS[k].RefreshInterval.Get() == 0 {
-			v.RefreshInterval = jsontype.New(DefaultRefreshInterval)
+			v.RefreshInterval = jsontype.New(refreshInterval)
 			c.JWKS[k] = v
 		}
 		if c.JWKS[k].RefreshTimeout.Get() == 0 {
@@ -66,6 +101,287 @@ func (c Config) DefaultsAndValidate() (Config, error) {
 			c.JWKS[k] = v
 		}
 	}
+	for name, raw := range c.JWKSInline {
+		_, err := keyfunc.NewJSON(raw)
+		if err != nil {
+			return c, fmt.Errorf("failed to parse inline JWK Set: %q: %s: %w", name, err, ErrInvalidConfig)
+		}
+	}
+	for pattern, p := range c.Issuers.Patterns {
+		_, err := compileIssuerPattern(pattern, p.JWKSURL)
+		if err != nil {
+			return c, fmt.Errorf("%s: %w", err, ErrInvalidConfig)
+		}
+	}
+	if c.Issuers.IdleTimeout.Get() == 0 {
+		c.Issuers.IdleTimeout = jsontype.New(DefaultIssuerIdleTimeout)
+	}
+	if c.Issuers.MaxEntries == 0 {
+		c.Issuers.MaxEntries = DefaultIssuerMaxEntries
+	} else if c.Issuers.MaxEntries < 0 {
+		return c, fmt.Errorf("issuer max entries must be positive: %d: %w", c.Issuers.MaxEntries, ErrInvalidConfig)
+	}
+	if c.Issuers.RefreshInterval.Get() == 0 {
+		c.Issuers.RefreshInterval = jsontype.New(DefaultRefreshInterval)
+	}
+	if c.Issuers.RefreshTimeout.Get() == 0 {
+		c.Issuers.RefreshTimeout = jsontype.New(DefaultRefreshTimeout)
+	}
+	for prefix, p := range c.JKU.Prefixes {
+		err := validateJKUPrefix(prefix)
+		if err != nil {
+			return c, fmt.Errorf("%s: %w", err, ErrInvalidConfig)
+		}
+		if len(p.Issuers) == 0 {
+			return c, fmt.Errorf("no issuers for jku prefix %q: %w", prefix, ErrInvalidConfig)
+		}
+	}
+	if c.JKU.MaxEntries == 0 {
+		c.JKU.MaxEntries = DefaultJKUMaxEntries
+	} else if c.JKU.MaxEntries < 0 {
+		return c, fmt.Errorf("jku max entries must be positive: %d: %w", c.JKU.MaxEntries, ErrInvalidConfig)
+	}
+	if c.JKU.RefreshInterval.Get() == 0 {
+		c.JKU.RefreshInterval = jsontype.New(DefaultRefreshInterval)
+	}
+	if c.JKU.RefreshTimeout.Get() == 0 {
+		c.JKU.RefreshTimeout = jsontype.New(DefaultRefreshTimeout)
+	}
+	for kid, key := range c.JWE.Keys {
+		if key.File == "" {
+			return c, fmt.Errorf("no file for JWE decryption key: %q: %w", kid, ErrInvalidConfig)
+		}
+	}
+	for _, alg := range c.JWE.Algorithms {
+		if !contains(DefaultJWEAlgorithms, alg) {
+			return c, fmt.Errorf("unsupported JWE algorithm: %q: %w", alg, ErrInvalidConfig)
+		}
+	}
+	for _, enc := range c.JWE.Encryptions {
+		if !contains(DefaultJWEEncryptions, enc) {
+			return c, fmt.Errorf("unsupported JWE content encryption: %q: %w", enc, ErrInvalidConfig)
+		}
+	}
+	for k, v := range c.PEM {
+		refreshInterval, err := validateKeyURL(k)
+		if err != nil {
+			return c, err
+		}
+		if v.KID == "" {
+			return c, fmt.Errorf("no key ID for PEM key source: %q: %w", k, ErrInvalidConfig)
+		}
+		if v.RefreshInterval.Get() == 0 {
+			v.RefreshInterval = jsontype.New(refreshInterval)
+		}
+		if v.RefreshTimeout.Get() == 0 {
+			v.RefreshTimeout = jsontype.New(DefaultRefreshTimeout)
+		}
+		c.PEM[k] = v
+	}
+	for k, v := range c.PEMMaps {
+		refreshInterval, err := validateKeyURL(k)
+		if err != nil {
+			return c, err
+		}
+		if v.RefreshInterval.Get() == 0 {
+			v.RefreshInterval = jsontype.New(refreshInterval)
+		}
+		if v.RefreshRateLimit.Get() == 0 {
+			v.RefreshRateLimit = jsontype.New(DefaultPEMMapRefreshRateLimit)
+		}
+		if v.RefreshTimeout.Get() == 0 {
+			v.RefreshTimeout = jsontype.New(DefaultRefreshTimeout)
+		}
+		c.PEMMaps[k] = v
+	}
+	for k, v := range c.KeyURLs {
+		err := validateKeyURLTemplate(k)
+		if err != nil {
+			return c, err
+		}
+		if v.MaxEntries == 0 {
+			v.MaxEntries = DefaultKeyURLMaxEntries
+		} else if v.MaxEntries < 0 {
+			return c, fmt.Errorf("key URL max entries must be positive: %q: %d: %w", k, v.MaxEntries, ErrInvalidConfig)
+		}
+		if v.RefreshRateLimit.Get() == 0 {
+			v.RefreshRateLimit = jsontype.New(DefaultKeyURLRefreshRateLimit)
+		}
+		if v.RefreshTimeout.Get() == 0 {
+			v.RefreshTimeout = jsontype.New(DefaultRefreshTimeout)
+		}
+		c.KeyURLs[k] = v
+	}
+	for iss, v := range c.Kubernetes {
+		err := validatePatternURL(iss)
+		if err != nil {
+			return c, fmt.Errorf("invalid Kubernetes issuer: %q: %s: %w", iss, err, ErrInvalidConfig)
+		}
+		refreshInterval := DefaultRefreshInterval
+		if v.JWKSURL != "" {
+			refreshInterval, err = validateKeyURL(v.JWKSURL)
+			if err != nil {
+				return c, err
+			}
+		}
+		if v.RefreshInterval.Get() == 0 {
+			v.RefreshInterval = jsontype.New(refreshInterval)
+		}
+		if v.RefreshTimeout.Get() == 0 {
+			v.RefreshTimeout = jsontype.New(DefaultRefreshTimeout)
+		}
+		c.Kubernetes[iss] = v
+	}
+	for profile, v := range c.Presets {
+		if !isPreset(profile) {
+			return c, fmt.Errorf("unknown CI/CD preset: %q: %w", profile, ErrInvalidConfig)
+		}
+		if v.Issuer != "" {
+			err := validatePatternURL(v.Issuer)
+			if err != nil {
+				return c, fmt.Errorf("invalid issuer for CI/CD preset %q: %s: %w", profile, err, ErrInvalidConfig)
+			}
+		}
+		if v.RefreshInterval.Get() == 0 {
+			v.RefreshInterval = jsontype.New(DefaultRefreshInterval)
+		}
+		if v.RefreshTimeout.Get() == 0 {
+			v.RefreshTimeout = jsontype.New(DefaultRefreshTimeout)
+		}
+		c.Presets[profile] = v
+	}
+	for td, v := range c.SPIFFE {
+		if !trustDomain.MatchString(td) {
+			return c, fmt.Errorf("invalid SPIFFE trust domain: %q: %w", td, ErrInvalidConfig)
+		}
+		_, err := validateKeyURL(v.Bundle)
+		if err != nil {
+			return c, err
+		}
+		if v.RefreshInterval.Get() == 0 {
+			v.RefreshInterval = jsontype.New(DefaultSPIFFERefreshInterval)
+		}
+		if v.RefreshRateLimit.Get() == 0 {
+			v.RefreshRateLimit = jsontype.New(DefaultSPIFFERefreshRateLimit)
+		}
+		if v.RefreshTimeout.Get() == 0 {
+			v.RefreshTimeout = jsontype.New(DefaultRefreshTimeout)
+		}
+		c.SPIFFE[td] = v
+	}
+	if c.HMAC.Enabled {
+		if len(c.HMAC.Keys) == 0 {
+			return c, fmt.Errorf("%w: HMAC enabled with no keys", ErrInvalidConfig)
+		}
+		for kid, key := range c.HMAC.Keys {
+			sources := 0
+			for _, source := range []string{key.Env, key.File, key.Secret} {
+				if source != "" {
+					sources++
+				}
+			}
+			if sources != 1 {
+				return c, fmt.Errorf("HMAC key must have exactly one of env, file, or secret: %q: %w", kid, ErrInvalidConfig)
+			}
+			if len(key.Issuers) == 0 {
+				return c, fmt.Errorf("HMAC key must be bound to at least one issuer: %q: %w", kid, ErrInvalidConfig)
+			}
+		}
+	}
+	if c.X5C.CABundle == "" && (len(c.X5C.ExtKeyUsages) != 0 || len(c.X5C.Issuers) != 0 || c.X5C.Subject != "") {
+		return c, fmt.Errorf("%w: x5c requirements given without a CA bundle", ErrInvalidConfig)
+	}
+	if c.X5C.CABundle != "" && len(c.X5C.Issuers) == 0 {
+		return c, fmt.Errorf("%w: x5c verification must be bound to at least one issuer", ErrInvalidConfig)
+	}
+	for _, name := range c.X5C.ExtKeyUsages {
+		if _, ok := extKeyUsages[name]; !ok {
+			return c, fmt.Errorf("unknown x5c extended key usage: %q: %w", name, ErrInvalidConfig)
+		}
+	}
+	if c.X5C.Subject != "" {
+		_, err := regexp.Compile(c.X5C.Subject)
+		if err != nil {
+			return c, fmt.Errorf("invalid x5c subject pattern: %s: %w", err, ErrInvalidConfig)
+		}
+	}
+	if c.DPoP.ClockSkew.Get() < 0 || c.DPoP.ProofMaxAge.Get() < 0 {
+		return c, fmt.Errorf("%w: DPoP durations must not be negative", ErrInvalidConfig)
+	}
+	if c.DPoP.ClockSkew.Get() == 0 {
+		c.DPoP.ClockSkew = jsontype.New(DefaultDPoPClockSkew)
+	}
+	if c.DPoP.ProofMaxAge.Get() == 0 {
+		c.DPoP.ProofMaxAge = jsontype.New(DefaultDPoPProofMaxAge)
+	}
+	if c.ExpressionCostLimit == 0 {
+		c.ExpressionCostLimit = DefaultExpressionCostLimit
+	}
+	env, err := newExpressionEnv()
+	if err != nil {
+		return c, err
+	}
+	c.Exchange, err = c.Exchange.defaultsAndValidate(env, c.ExpressionCostLimit, c.Policies)
+	if err != nil {
+		return c, err
+	}
+	for name, policy := range c.Policies {
+		for _, source := range policy.Expressions {
+			_, err := compileExpression(env, source, c.ExpressionCostLimit)
+			if err != nil {
+				return c, fmt.Errorf("policy %q: %s: %w", name, err, ErrInvalidConfig)
+			}
+		}
+		if !knownProfile(policy.Profile) {
+			return c, fmt.Errorf("unknown validation profile %q for policy %q: %w", policy.Profile, name, ErrInvalidConfig)
+		}
+		if policy.RevokeSessions && policy.Profile != ProfileLogoutToken {
+			return c, fmt.Errorf("policy %q must have the %q profile to revoke sessions: %w", name, ProfileLogoutToken, ErrInvalidConfig)
+		}
+		if (len(policy.Namespaces) != 0 || len(policy.ServiceAccounts) != 0 || policy.RequirePod) && policy.Profile != ProfileKubernetes {
+			return c, fmt.Errorf("policy %q must have the %q profile for Kubernetes requirements: %w", name, ProfileKubernetes, ErrInvalidConfig)
+		}
+		for _, pattern := range policy.SPIFFEIDs {
+			err := validateSPIFFEIDPattern(pattern)
+			if err != nil {
+				return c, fmt.Errorf("policy %q: %s: %w", name, err, ErrInvalidConfig)
+			}
+		}
+		if policy.MaxDelegationDepth < 0 {
+			return c, fmt.Errorf("policy %q maximum delegation depth must not be negative: %d: %w", name, policy.MaxDelegationDepth, ErrInvalidConfig)
+		}
+		if len(pipelinePatterns(policy)) != 0 && !isPreset(policy.Profile) {
+			return c, fmt.Errorf("policy %q must have a CI/CD profile for pipeline rules: %w", name, ErrInvalidConfig)
+		}
+		if isPreset(policy.Profile) && isHostedPreset(policy.Profile, c.Presets[policy.Profile].Issuer) && len(policy.Repositories) == 0 {
+			return c, fmt.Errorf("policy %q must have repositories for the hosted issuer of its CI/CD profile: %w", name, ErrInvalidConfig)
+		}
+		for _, pattern := range pipelinePatterns(policy) {
+			err := validatePipelinePattern(pattern)
+			if err != nil {
+				return c, fmt.Errorf("policy %q: %s: %w", name, err, ErrInvalidConfig)
+			}
+		}
+	}
+	if c.ReplayMaxEntries == 0 {
+		c.ReplayMaxEntries = DefaultReplayMaxEntries
+	} else if c.ReplayMaxEntries < 0 {
+		return c, fmt.Errorf("replay max entries must be positive: %d: %w", c.ReplayMaxEntries, ErrInvalidConfig)
+	}
+	if c.Revocation.MaxTokenLifetime.Get() == 0 {
+		c.Revocation.MaxTokenLifetime = jsontype.New(DefaultMaxTokenLifetime)
+	}
+	if c.Revocation.RefreshInterval.Get() == 0 {
+		c.Revocation.RefreshInterval = jsontype.New(DefaultFileRefreshInterval)
+	}
+	if c.CacheMaxAge.Get() == 0 {
+		c.CacheMaxAge = jsontype.New(DefaultCacheMaxAge)
+	}
+	if c.JWKSMaxAge.Get() == 0 {
+		c.JWKSMaxAge = jsontype.New(DefaultJWKSMaxAge)
+	} else if c.JWKSMaxAge.Get() < 0 {
+		return c, fmt.Errorf("JWK Set max age must not be negative: %s: %w", c.JWKSMaxAge.Get(), ErrInvalidConfig)
+	}
 	if c.ListenAddress == "" {
 		c.ListenAddress = DefaultListenAddress
 	}
@@ -84,8 +400,272 @@ func (c Config) DefaultsAndValidate() (Config, error) {
 	return c, nil
 }
 
+// DPoPConfig contains the configuration for validating DPoP proofs.
+type DPoPConfig struct {
+	ClockSkew   *jsontype.JSONType[time.Duration] `json:"clockSkew"`
+	ProofMaxAge *jsontype.JSONType[time.Duration] `json:"proofMaxAge"`
+}
+
+// ExchangeConfig contains the configuration for minting internal tokens in exchange for validated tokens. Token
+// exchange is disabled when the issuer is empty.
+type ExchangeConfig struct {
+	Audiences        []string                          `json:"audiences"`
+	Claims           map[string]string                 `json:"claims"`
+	Issuer           string                            `json:"issuer"`
+	Keys             map[string]ExchangeKeyConfig      `json:"keys"`
+	Policy           string                            `json:"policy"`
+	RotationInterval *jsontype.JSONType[time.Duration] `json:"rotationInterval"`
+	SigningKey       string                            `json:"signingKey"`
+	TokenLifetime    *jsontype.JSONType[time.Duration] `json:"tokenLifetime"`
+}
+
+func (e ExchangeConfig) defaultsAndValidate(env *cel.Env, costLimit uint64, policies map[string]Policy) (ExchangeConfig, error) {
+	if e.Issuer == "" {
+		if len(e.Audiences) != 0 || len(e.Claims) != 0 || len(e.Keys) != 0 || e.Policy != "" || e.SigningKey != "" {
+			return e, fmt.Errorf("%w: token exchange options given without an issuer", ErrInvalidConfig)
+		}
+		return e, nil
+	}
+	_, err := url.ParseRequestURI(e.Issuer)
+	if err != nil {
+		return e, fmt.Errorf("invalid token exchange issuer: %q: %s: %w", e.Issuer, err, ErrInvalidConfig)
+	}
+	if len(e.Audiences) == 0 {
+		return e, fmt.Errorf("%w: token exchange requires audiences", ErrInvalidConfig)
+	}
+	if e.Policy == "" {
+		return e, fmt.Errorf("%w: token exchange requires a policy", ErrInvalidConfig)
+	}
+	policy, ok := policies[e.Policy]
+	if !ok {
+		return e, fmt.Errorf("unknown token exchange policy: %q: %w", e.Policy, ErrInvalidConfig)
+	}
+	if len(policy.Aud) == 0 {
+		return e, fmt.Errorf("token exchange policy %q must have audiences: %w", e.Policy, ErrInvalidConfig)
+	}
+	for name, source := range e.Claims {
+		err = validateExchangeClaim(name)
+		if err != nil {
+			return e, fmt.Errorf("%s: %w", err, ErrInvalidConfig)
+		}
+		_, err = compileCEL(env, source, costLimit, nil)
+		if err != nil {
+			return e, fmt.Errorf("token exchange claim %q: %s: %w", name, err, ErrInvalidConfig)
+		}
+	}
+	for kid, key := range e.Keys {
+		if key.File == "" {
+			return e, fmt.Errorf("no file for token exchange signing key: %q: %w", kid, ErrInvalidConfig)
+		}
+	}
+	if _, ok := e.Keys[e.SigningKey]; e.SigningKey != "" && !ok {
+		return e, fmt.Errorf("unknown token exchange signing key: %q: %w", e.SigningKey, ErrInvalidConfig)
+	}
+	if e.SigningKey == "" && len(e.Keys) > 1 {
+		return e, fmt.Errorf("%w: token exchange signing key required with multiple keys", ErrInvalidConfig)
+	}
+	if e.RotationInterval.Get() < 0 || e.TokenLifetime.Get() < 0 {
+		return e, fmt.Errorf("%w: token exchange durations must not be negative", ErrInvalidConfig)
+	}
+	if e.RotationInterval.Get() == 0 {
+		e.RotationInterval = jsontype.New(DefaultExchangeRotationInterval)
+	}
+	if e.TokenLifetime.Get() == 0 {
+		e.TokenLifetime = jsontype.New(DefaultExchangeTokenLifetime)
+	}
+	return e, nil
+}
+
+// ExchangeKeyConfig contains the configuration for a single token exchange signing key.
+type ExchangeKeyConfig struct {
+	File string `json:"file"`
+}
+
+// Key reads the Ed25519, ECDSA, or RSA private key from its PEM encoded file.
+func (e ExchangeKeyConfig) Key() (crypto.PrivateKey, error) {
+	data, err := os.ReadFile(e.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token exchange signing key file: %w", err)
+	}
+	key, err := parsePrivateKeyPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token exchange signing key file: %s: %w", err, ErrInvalidConfig)
+	}
+	return key, nil
+}
+
+// ForwardAuthConfig contains the configuration for the ForwardAuth endpoint.
+type ForwardAuthConfig struct {
+	ClientCertHeader string `json:"clientCertHeader"`
+}
+
+// HMACConfig contains the configuration for verifying JWTs signed with a shared secret.
+type HMACConfig struct {
+	Enabled bool                     `json:"enabled"`
+	Keys    map[string]HMACKeyConfig `json:"keys"`
+}
+
+// HMACKeyConfig contains the configuration for a single shared secret. Exactly one of Env, File, or Secret is used.
+type HMACKeyConfig struct {
+	Env     string   `json:"env"`
+	File    string   `json:"file"`
+	Issuers []string `json:"issuers"`
+	Secret  string   `json:"secret"`
+}
+
+// Key reads the shared secret from its configured source. Trailing newlines are trimmed from secrets read from a file.
+func (h HMACKeyConfig) Key() (HMACKey, error) {
+	key := HMACKey{
+		Issuers: h.Issuers,
+	}
+	switch {
+	case h.Env != "":
+		secret, ok := os.LookupEnv(h.Env)
+		if !ok {
+			return HMACKey{}, fmt.Errorf("environment variable %q for HMAC key not set: %w", h.Env, ErrInvalidConfig)
+		}
+		key.Secret = []byte(secret)
+	case h.File != "":
+		secret, err := os.ReadFile(h.File)
+		if err != nil {
+			return HMACKey{}, fmt.Errorf("failed to read HMAC key file: %w", err)
+		}
+		key.Secret = bytes.TrimRight(secret, "\r\n")
+	default:
+		key.Secret = []byte(h.Secret)
+	}
+	return key, nil
+}
+
+// IssuersConfig contains the configuration for verifying JWTs from issuers matching a pattern.
+type IssuersConfig struct {
+	IdleTimeout     *jsontype.JSONType[time.Duration] `json:"idleTimeout"`
+	MaxEntries      int                               `json:"maxEntries"`
+	Patterns        map[string]IssuerPattern          `json:"patterns"`
+	RefreshInterval *jsontype.JSONType[time.Duration] `json:"refreshInterval"`
+	RefreshTimeout  *jsontype.JSONType[time.Duration] `json:"refreshTimeout"`
+}
+
+// JKUConfig contains the configuration for verifying JWTs with the JWK Set their `jku` header points to.
+type JKUConfig struct {
+	AllowPrivate    bool                              `json:"allowPrivate"`
+	MaxEntries      int                               `json:"maxEntries"`
+	Prefixes        map[string]JKUPrefix              `json:"prefixes"`
+	RefreshInterval *jsontype.JSONType[time.Duration] `json:"refreshInterval"`
+	RefreshTimeout  *jsontype.JSONType[time.Duration] `json:"refreshTimeout"`
+}
+
+// JWEConfig contains the configuration for decrypting encrypted JWTs.
+type JWEConfig struct {
+	Algorithms  []string                `json:"algorithms"`
+	Encryptions []string                `json:"encryptions"`
+	Keys        map[string]JWEKeyConfig `json:"keys"`
+}
+
+// JWEKeyConfig contains the configuration for a single JWE decryption key.
+type JWEKeyConfig struct {
+	File string `json:"file"`
+}
+
+// Key reads the RSA or ECDSA private key from its PEM encoded file.
+func (j JWEKeyConfig) Key() (crypto.PrivateKey, error) {
+	data, err := os.ReadFile(j.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWE decryption key file: %w", err)
+	}
+	key, err := parsePrivateKeyPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWE decryption key file: %s: %w", err, ErrInvalidConfig)
+	}
+	return key, nil
+}
+
 // JWKSConfig contains the configuration for a JWKS.
 type JWKSConfig struct {
+	Client          HTTPClientConfig                  `json:"client"`
+	RefreshInterval *jsontype.JSONType[time.Duration] `json:"refreshInterval"`
+	RefreshTimeout  *jsontype.JSONType[time.Duration] `json:"refreshTimeout"`
+}
+
+// KeyURLConfig contains the configuration for a key URL template with one PEM encoded public key per key ID.
+type KeyURLConfig struct {
+	MaxEntries       int                               `json:"maxEntries"`
+	RefreshRateLimit *jsontype.JSONType[time.Duration] `json:"refreshRateLimit"`
+	RefreshTimeout   *jsontype.JSONType[time.Duration] `json:"refreshTimeout"`
+}
+
+// KubernetesConfig contains the configuration for verifying the service account tokens of a Kubernetes cluster.
+type KubernetesConfig struct {
+	BearerTokenFile string                            `json:"bearerTokenFile"`
+	CABundle        string                            `json:"caBundle"`
+	JWKSURL         string                            `json:"jwksURL"`
+	RefreshInterval *jsontype.JSONType[time.Duration] `json:"refreshInterval"`
+	RefreshTimeout  *jsontype.JSONType[time.Duration] `json:"refreshTimeout"`
+}
+
+// PEMConfig contains the configuration for a PEM encoded public key or X.509 certificate chain.
+type PEMConfig struct {
+	CABundle        string                            `json:"caBundle"`
+	CheckExpiry     bool                              `json:"checkExpiry"`
+	KID             string                            `json:"kid"`
+	RefreshInterval *jsontype.JSONType[time.Duration] `json:"refreshInterval"`
+	RefreshTimeout  *jsontype.JSONType[time.Duration] `json:"refreshTimeout"`
+}
+
+// PEMMapConfig contains the configuration for a JSON object mapping key IDs to PEM encoded X.509 certificates or public
+// keys.
+type PEMMapConfig struct {
+	CheckExpiry      bool                              `json:"checkExpiry"`
+	RefreshInterval  *jsontype.JSONType[time.Duration] `json:"refreshInterval"`
+	RefreshRateLimit *jsontype.JSONType[time.Duration] `json:"refreshRateLimit"`
+	RefreshTimeout   *jsontype.JSONType[time.Duration] `json:"refreshTimeout"`
+}
+
+// PresetConfig contains the configuration for verifying the tokens of a CI/CD provider.
+type PresetConfig struct {
+	Issuer          string                            `json:"issuer"`
 	RefreshInterval *jsontype.JSONType[time.Duration] `json:"refreshInterval"`
 	RefreshTimeout  *jsontype.JSONType[time.Duration] `json:"refreshTimeout"`
 }
+
+// RevocationConfig contains the configuration for the Denylist of revoked JWTs.
+type RevocationConfig struct {
+	File             string                            `json:"file"`
+	MaxTokenLifetime *jsontype.JSONType[time.Duration] `json:"maxTokenLifetime"`
+	RefreshInterval  *jsontype.JSONType[time.Duration] `json:"refreshInterval"`
+}
+
+// SPIFFEConfig contains the configuration for the trust bundle of a SPIFFE trust domain.
+type SPIFFEConfig struct {
+	Bundle           string                            `json:"bundle"`
+	RefreshInterval  *jsontype.JSONType[time.Duration] `json:"refreshInterval"`
+	RefreshRateLimit *jsontype.JSONType[time.Duration] `json:"refreshRateLimit"`
+	RefreshTimeout   *jsontype.JSONType[time.Duration] `json:"refreshTimeout"`
+}
+
+// X5CConfig contains the configuration for verifying JWTs with the certificate chain in their `x5c` header.
+type X5CConfig struct {
+	CABundle     string   `json:"caBundle"`
+	ExtKeyUsages []string `json:"extKeyUsages"`
+	Issuers      []string `json:"issuers"`
+	Subject      string   `json:"subject"`
+}
+
+// validateKeyURL validates the URL of a key source and returns its default refresh interval.
+func validateKeyURL(k string) (time.Duration, error) {
+	u, err := url.Parse(k)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse JWK Set URL: %q: %s: %w", k, err, ErrInvalidConfig)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return DefaultRefreshInterval, nil
+	case schemeFile:
+		if (u.Host != "" && u.Host != "localhost") || u.Path == "" {
+			return 0, fmt.Errorf("JWK Set file URL must have an absolute path: %q: %w", k, ErrInvalidConfig)
+		}
+		return DefaultFileRefreshInterval, nil
+	default:
+		return 0, fmt.Errorf("invalid JWK Set URL scheme: %q: %w", u.Scheme, ErrInvalidConfig)
+	}
+}
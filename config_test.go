@@ -1,8 +1,10 @@
 package jcp_test
 
 import (
+	"encoding/json"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/MicahParks/jsontype"
 
@@ -54,6 +56,451 @@ func TestConfig_DefaultsAndValidate(t *testing.T) {
 			err:  jcp.ErrInvalidConfig,
 			name: "InvalidURLScheme",
 		},
+		{
+			config: jcp.Config{
+				JWKS: map[string]jcp.JWKSConfig{
+					"file:///etc/jcp/jwks.json": {},
+				},
+			},
+			expected: jcp.Config{
+				JWKS: map[string]jcp.JWKSConfig{
+					"file:///etc/jcp/jwks.json": {
+						RefreshInterval: jsontype.New(jcp.DefaultFileRefreshInterval),
+						RefreshTimeout:  jsontype.New(jcp.DefaultRefreshTimeout),
+					},
+				},
+				ListenAddress:   jcp.DefaultListenAddress,
+				LogFormat:       jcp.DefaultLogFormat,
+				RequestMaxBytes: jcp.DefaultRequestMaxBytes,
+			},
+			name: "FileURL",
+		},
+		{
+			config: jcp.Config{
+				JWKS: map[string]jcp.JWKSConfig{
+					"file://relative/jwks.json": {},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "FileURLRelative",
+		},
+		{
+			config: jcp.Config{
+				JWKSInline: map[string]json.RawMessage{
+					anyNonEmptyString: json.RawMessage(`{"keys":[]}`),
+				},
+			},
+			expected: jcp.Config{
+				ListenAddress:   jcp.DefaultListenAddress,
+				LogFormat:       jcp.DefaultLogFormat,
+				RequestMaxBytes: jcp.DefaultRequestMaxBytes,
+			},
+			name: "InlineOnly",
+		},
+		{
+			config: jcp.Config{
+				JWKSInline: map[string]json.RawMessage{
+					anyNonEmptyString: json.RawMessage(anyOtherString),
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "InlineInvalid",
+		},
+		{
+			config: jcp.Config{
+				PEM: map[string]jcp.PEMConfig{
+					validURL: {},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "PEMNoKID",
+		},
+		{
+			config: jcp.Config{
+				KeyURLs: map[string]jcp.KeyURLConfig{
+					validURL: {},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "KeyURLNoPlaceholder",
+		},
+		{
+			config: jcp.Config{
+				SPIFFE: map[string]jcp.SPIFFEConfig{
+					"Example.org": {Bundle: validURL},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "SPIFFEInvalidTrustDomain",
+		},
+		{
+			config: jcp.Config{
+				Kubernetes: map[string]jcp.KubernetesConfig{
+					"kubernetes.default.svc": {},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "KubernetesInvalidIssuer",
+		},
+		{
+			config: jcp.Config{
+				JWKS: map[string]jcp.JWKSConfig{
+					validURL: {},
+				},
+				Policies: map[string]jcp.Policy{
+					anyNonEmptyString: {Namespaces: []string{anyOtherString}},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "KubernetesRequirementsWithoutProfile",
+		},
+		{
+			config: jcp.Config{
+				Presets: map[string]jcp.PresetConfig{
+					anyNonEmptyString: {},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "UnknownPreset",
+		},
+		{
+			config: jcp.Config{
+				Policies: map[string]jcp.Policy{
+					anyNonEmptyString: {Refs: []string{"refs/heads/main"}},
+				},
+				Presets: map[string]jcp.PresetConfig{
+					jcp.ProfileGitHubActions: {},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "PipelineRulesWithoutPreset",
+		},
+		{
+			config: jcp.Config{
+				Policies: map[string]jcp.Policy{
+					anyNonEmptyString: {Profile: jcp.ProfileGitHubActions, Refs: []string{"refs/heads/main"}},
+				},
+				Presets: map[string]jcp.PresetConfig{
+					jcp.ProfileGitHubActions: {},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "HostedPresetWithoutRepositories",
+		},
+		{
+			config: jcp.Config{
+				JWKS: map[string]jcp.JWKSConfig{
+					validURL: {},
+				},
+				Policies: map[string]jcp.Policy{
+					anyNonEmptyString: {MaxDelegationDepth: -1},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "NegativeMaxDelegationDepth",
+		},
+		{
+			config: jcp.Config{
+				JWKS: map[string]jcp.JWKSConfig{
+					validURL: {},
+				},
+				JWKSMaxAge: jsontype.New(-time.Minute),
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "NegativeJWKSMaxAge",
+		},
+		{
+			config: jcp.Config{
+				JWKS: map[string]jcp.JWKSConfig{
+					validURL: {},
+				},
+				Policies: map[string]jcp.Policy{
+					anyNonEmptyString: {Expressions: []string{"claims.tenant =="}},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "InvalidExpression",
+		},
+		{
+			config: jcp.Config{
+				JWKS: map[string]jcp.JWKSConfig{
+					validURL: {},
+				},
+				Policies: map[string]jcp.Policy{
+					anyNonEmptyString: {Expressions: []string{"size(claims)"}},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "ExpressionNotBool",
+		},
+		{
+			config: jcp.Config{
+				Exchange: jcp.ExchangeConfig{
+					Audiences: []string{validURL},
+				},
+				JWKS: map[string]jcp.JWKSConfig{
+					validURL: {},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "ExchangeWithoutIssuer",
+		},
+		{
+			config: jcp.Config{
+				Exchange: jcp.ExchangeConfig{
+					Audiences:  []string{validURL},
+					Issuer:     validURL,
+					Keys:       map[string]jcp.ExchangeKeyConfig{testKID: {File: anyNonEmptyString}},
+					Policy:     anyNonEmptyString,
+					SigningKey: anyOtherString,
+				},
+				JWKS: map[string]jcp.JWKSConfig{
+					validURL: {},
+				},
+				Policies: map[string]jcp.Policy{
+					anyNonEmptyString: {Aud: []string{validURL}},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "ExchangeUnknownSigningKey",
+		},
+		{
+			config: jcp.Config{
+				Exchange: jcp.ExchangeConfig{
+					Audiences: []string{validURL},
+					Claims:    map[string]string{"exp": "claims.exp"},
+					Issuer:    validURL,
+					Policy:    anyNonEmptyString,
+				},
+				JWKS: map[string]jcp.JWKSConfig{
+					validURL: {},
+				},
+				Policies: map[string]jcp.Policy{
+					anyNonEmptyString: {Aud: []string{validURL}},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "ExchangeReservedClaim",
+		},
+		{
+			config: jcp.Config{
+				Exchange: jcp.ExchangeConfig{
+					Audiences: []string{validURL},
+					Issuer:    validURL,
+				},
+				JWKS: map[string]jcp.JWKSConfig{
+					validURL: {},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "ExchangeNoPolicy",
+		},
+		{
+			config: jcp.Config{
+				Exchange: jcp.ExchangeConfig{
+					Audiences: []string{validURL},
+					Issuer:    validURL,
+					Policy:    anyNonEmptyString,
+				},
+				JWKS: map[string]jcp.JWKSConfig{
+					validURL: {},
+				},
+				Policies: map[string]jcp.Policy{
+					anyNonEmptyString: {},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "ExchangePolicyWithoutAudience",
+		},
+		{
+			config: jcp.Config{
+				JWKS: map[string]jcp.JWKSConfig{
+					validURL: {},
+				},
+				Policies: map[string]jcp.Policy{
+					anyNonEmptyString: {SPIFFEIDs: []string{"https://example.org/workload"}},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "SPIFFEIDPatternNotSPIFFE",
+		},
+		{
+			config: jcp.Config{
+				JWKS: map[string]jcp.JWKSConfig{
+					validURL: {
+						Client: jcp.HTTPClientConfig{
+							MinTLSVersion: "1.4",
+						},
+					},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "InvalidMinTLSVersion",
+		},
+		{
+			config: jcp.Config{
+				JWKS: map[string]jcp.JWKSConfig{
+					validURL: {
+						Client: jcp.HTTPClientConfig{
+							ClientCert: anyNonEmptyString,
+						},
+					},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "ClientCertWithoutKey",
+		},
+		{
+			config: jcp.Config{
+				HMAC: jcp.HMACConfig{
+					Enabled: true,
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "HMACNoKeys",
+		},
+		{
+			config: jcp.Config{
+				HMAC: jcp.HMACConfig{
+					Enabled: true,
+					Keys: map[string]jcp.HMACKeyConfig{
+						anyNonEmptyString: {Secret: anyNonEmptyString},
+					},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "HMACNoIssuers",
+		},
+		{
+			config: jcp.Config{
+				DPoP: jcp.DPoPConfig{
+					ProofMaxAge: jsontype.New(-time.Minute),
+				},
+				JWKS: map[string]jcp.JWKSConfig{
+					validURL: {},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "DPoPNegativeProofMaxAge",
+		},
+		{
+			config: jcp.Config{
+				JWE: jcp.JWEConfig{
+					Algorithms: []string{"RSA1_5"},
+				},
+				JWKS: map[string]jcp.JWKSConfig{
+					validURL: {},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "JWEUnsupportedAlgorithm",
+		},
+		{
+			config: jcp.Config{
+				JKU: jcp.JKUConfig{
+					Prefixes: map[string]jcp.JKUPrefix{
+						"https://partner.example.com": {Issuers: []string{anyNonEmptyString}},
+					},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "JKUPrefixNoPath",
+		},
+		{
+			config: jcp.Config{
+				JKU: jcp.JKUConfig{
+					Prefixes: map[string]jcp.JKUPrefix{
+						"https://partner.example.com/tenants/": {},
+					},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "JKUPrefixNoIssuers",
+		},
+		{
+			config: jcp.Config{
+				Issuers: jcp.IssuersConfig{
+					Patterns: map[string]jcp.IssuerPattern{
+						"https://{tenant}.idp.example.com/": {},
+					},
+				},
+			},
+			expected: jcp.Config{
+				ListenAddress:   jcp.DefaultListenAddress,
+				LogFormat:       jcp.DefaultLogFormat,
+				RequestMaxBytes: jcp.DefaultRequestMaxBytes,
+			},
+			name: "IssuerPatternsOnly",
+		},
+		{
+			config: jcp.Config{
+				Issuers: jcp.IssuersConfig{
+					Patterns: map[string]jcp.IssuerPattern{
+						"https://{tenant}.idp.example.com/": {JWKSURL: "https://keys.example.com/{region}"},
+					},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "IssuerTemplateUnknownPlaceholder",
+		},
+		{
+			config: jcp.Config{
+				JWE: jcp.JWEConfig{
+					Keys: map[string]jcp.JWEKeyConfig{
+						anyNonEmptyString: {},
+					},
+				},
+				JWKS: map[string]jcp.JWKSConfig{
+					validURL: {},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "JWEKeyNoFile",
+		},
+		{
+			config: jcp.Config{
+				X5C: jcp.X5CConfig{
+					CABundle: anyNonEmptyString,
+					Issuers:  []string{validURL},
+					Subject:  "(",
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "X5CInvalidSubject",
+		},
+		{
+			config: jcp.Config{
+				JWKS: map[string]jcp.JWKSConfig{
+					validURL: {},
+				},
+				X5C: jcp.X5CConfig{
+					ExtKeyUsages: []string{"codeSigning"},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "X5CNoCABundle",
+		},
+		{
+			config: jcp.Config{
+				X5C: jcp.X5CConfig{
+					CABundle: anyNonEmptyString,
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "X5CNoIssuers",
+		},
+		{
+			config: jcp.Config{
+				JWKS: map[string]jcp.JWKSConfig{
+					validURL: {},
+				},
+				Policies: map[string]jcp.Policy{
+					anyNonEmptyString: {Profile: anyOtherString},
+				},
+			},
+			err:  jcp.ErrInvalidConfig,
+			name: "UnknownPolicyProfile",
+		},
 		{
 			config: jcp.Config{
 				JWKS: map[string]jcp.JWKSConfig{
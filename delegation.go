@@ -0,0 +1,44 @@
+package jcp
+
+import (
+	"errors"
+	"fmt"
+)
+
+const actClaim = "act"
+
+// ErrDelegation is returned when a JWT's delegation chain, its `act` claim, is not allowed by the policy.
+var ErrDelegation = errors.New("delegation chain check failed")
+
+// Actor is the `act` claim as defined in RFC 8693 Section 4.1. It is the current actor and Act is the prior actor in the
+// delegation chain, if any.
+type Actor struct {
+	Act *Actor `json:"act,omitempty"`
+	Iss string `json:"iss,omitempty"`
+	Sub string `json:"sub"`
+}
+
+// checkDelegation confirms the delegation chain is allowed by the policy. Every actor in the chain, not just the current
+// actor, must be allowed.
+func checkDelegation(policy Policy, claims *tokenClaims) error {
+	if claims.Act == nil {
+		return nil
+	}
+	if policy.RejectDelegation {
+		return fmt.Errorf("%w: claim %q is not allowed", ErrDelegation, actClaim)
+	}
+	depth := 0
+	for actor := claims.Act; actor != nil; actor = actor.Act {
+		depth++
+		if policy.MaxDelegationDepth != 0 && depth > policy.MaxDelegationDepth {
+			return fmt.Errorf("%w: delegation depth is more than %d", ErrDelegation, policy.MaxDelegationDepth)
+		}
+		if actor.Sub == "" {
+			return fmt.Errorf("%w: each %q must have a %q", ErrDelegation, actClaim, subClaim)
+		}
+		if len(policy.Actors) != 0 && !contains(policy.Actors, actor.Sub) {
+			return fmt.Errorf("%w: actor %q is not allowed", ErrDelegation, actor.Sub)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package jcp_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/MicahParks/jcp"
+)
+
+const (
+	delegationPolicy = "delegation"
+	noDelegation     = "noDelegation"
+)
+
+func TestProxy_Delegation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	proxy, err := jcp.NewProxyWithOptions(map[string]keyfunc.Options{jwksServer.URL: {}}, jcp.ProxyOptions{
+		Policies: map[string]jcp.Policy{
+			delegationPolicy: {
+				Actors:             []string{"gateway", "orders"},
+				MaxDelegationDepth: 2,
+			},
+			noDelegation: {
+				RejectDelegation: true,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	sign := func(act interface{}) string {
+		claims := jwt.MapClaims{
+			"exp": time.Now().Add(time.Minute).Unix(),
+			"sub": "user@example.com",
+		}
+		if act != nil {
+			claims["act"] = act
+		}
+		j := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		j.Header[headerKID] = testKID
+		token, err := j.SignedString(privateKey)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return token
+	}
+	chain := map[string]interface{}{
+		"sub": "gateway",
+		"act": map[string]interface{}{"iss": "https://issuer.example.com", "sub": "orders"},
+	}
+
+	testCases := []struct {
+		act  *jcp.Actor
+		args jcp.ValidateArgs
+		err  error
+		name string
+	}{
+		{
+			act:  &jcp.Actor{Act: &jcp.Actor{Iss: "https://issuer.example.com", Sub: "orders"}, Sub: "gateway"},
+			args: jcp.ValidateArgs{Policy: delegationPolicy, Token: sign(chain)},
+			name: "AllowedChain",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: noDelegation, Token: sign(nil)},
+			name: "NoDelegation",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: noDelegation, Token: sign(chain)},
+			err:  jcp.ErrDelegation,
+			name: "DelegationRejected",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: delegationPolicy, Token: sign(map[string]interface{}{
+				"sub": "gateway",
+				"act": map[string]interface{}{"sub": "orders", "act": map[string]interface{}{"sub": "gateway"}},
+			})},
+			err:  jcp.ErrDelegation,
+			name: "TooDeep",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: delegationPolicy, Token: sign(map[string]interface{}{
+				"sub": "gateway",
+				"act": map[string]interface{}{"sub": "admin"},
+			})},
+			err:  jcp.ErrDelegation,
+			name: "PriorActorNotAllowed",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: delegationPolicy, Token: sign(map[string]interface{}{"iss": "https://issuer.example.com"})},
+			err:  jcp.ErrDelegation,
+			name: "ActorWithoutSub",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := proxy.Validate(ctx, tc.args)
+			if err != nil || tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+				}
+				return
+			}
+			if (results.Act == nil) != (tc.act == nil) || (tc.act != nil && (results.Act.Sub != tc.act.Sub || results.Act.Act == nil || *results.Act.Act != *tc.act.Act)) {
+				t.Fatalf("Unexpected delegation chain in results: %+v.", results.Act)
+			}
+		})
+	}
+}
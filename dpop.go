@@ -0,0 +1,146 @@
+package jcp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// DefaultDPoPClockSkew is the default amount of time a DPoP proof's `iat` claim may be in the future.
+	DefaultDPoPClockSkew = 30 * time.Second
+	// DefaultDPoPProofMaxAge is the default amount of time after a DPoP proof's `iat` claim that it is accepted.
+	DefaultDPoPProofMaxAge = 5 * time.Minute
+	dpopType               = "dpop+jwt"
+	headerJWK              = "jwk"
+	headerTyp              = "typ"
+)
+
+// ErrDPoP is returned when a DPoP proof is missing or invalid.
+var ErrDPoP = errors.New("DPoP proof validation failed")
+
+// dpopMethods are the asymmetric signing algorithms allowed for DPoP proofs.
+var dpopMethods = []string{
+	jwt.SigningMethodEdDSA.Alg(),
+	jwt.SigningMethodES256.Alg(),
+	jwt.SigningMethodES384.Alg(),
+	jwt.SigningMethodES512.Alg(),
+	jwt.SigningMethodPS256.Alg(),
+	jwt.SigningMethodPS384.Alg(),
+	jwt.SigningMethodPS512.Alg(),
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodRS384.Alg(),
+	jwt.SigningMethodRS512.Alg(),
+}
+
+// DPoPOptions are the options for validating DPoP proofs as defined in RFC 9449.
+type DPoPOptions struct {
+	// ClockSkew is the amount of time a DPoP proof's `iat` claim may be in the future.
+	ClockSkew time.Duration
+	// ProofMaxAge is the amount of time after a DPoP proof's `iat` claim that it is accepted.
+	ProofMaxAge time.Duration
+}
+
+type dpopClaims struct {
+	ATH string           `json:"ath"`
+	HTM string           `json:"htm"`
+	HTU string           `json:"htu"`
+	IAT *jwt.NumericDate `json:"iat"`
+	JTI string           `json:"jti"`
+}
+
+// Valid helps implement the jwt.Claims interface. The time based claims of a DPoP proof are checked separately, so a
+// clock skew can be allowed for.
+func (d dpopClaims) Valid() error {
+	return nil
+}
+
+// checkDPoP validates the DPoP proof in the arguments against the access token. An access token bound to a key with the
+// `cnf.jkt` claim requires a proof. A proof given with an access token that is not bound to a key is rejected. It
+// returns the record of the proof's ID, if a proof was given.
+func (p proxy) checkDPoP(args ValidateArgs, claims *tokenClaims) (*replayRecord, error) {
+	jkt := ""
+	if claims.Cnf != nil {
+		jkt = claims.Cnf.JKT
+	}
+	if args.DPoP == "" {
+		if jkt != "" {
+			return nil, fmt.Errorf("%w: access token is DPoP bound but no proof was given", ErrDPoP)
+		}
+		return nil, nil
+	}
+	if jkt == "" {
+		return nil, fmt.Errorf("%w: proof given for an access token that is not DPoP bound", ErrDPoP)
+	}
+
+	var thumbprint string
+	var proof dpopClaims
+	parser := jwt.NewParser(jwt.WithValidMethods(dpopMethods))
+	t, err := parser.ParseWithClaims(args.DPoP, &proof, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header[headerTyp].(string); typ != dpopType {
+			return nil, fmt.Errorf("%w: header %q must be %q", ErrDPoP, headerTyp, dpopType)
+		}
+		var public interface{}
+		var err error
+		public, thumbprint, err = parsePublicJWK(token.Header[headerJWK])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrDPoP, err)
+		}
+		return public, nil
+	})
+	if err != nil || !t.Valid {
+		return nil, fmt.Errorf("%w: failed to parse proof: %s", ErrDPoP, err)
+	}
+
+	if thumbprint != jkt {
+		return nil, fmt.Errorf("%w: proof key does not match access token %q claim", ErrDPoP, "cnf.jkt")
+	}
+	if args.HTM == "" || proof.HTM != args.HTM {
+		return nil, fmt.Errorf("%w: %q claim does not match HTTP method", ErrDPoP, "htm")
+	}
+	if !sameHTU(proof.HTU, args.HTU) {
+		return nil, fmt.Errorf("%w: %q claim does not match HTTP target URI", ErrDPoP, "htu")
+	}
+	ath := sha256.Sum256([]byte(args.Token))
+	if proof.ATH != base64.RawURLEncoding.EncodeToString(ath[:]) {
+		return nil, fmt.Errorf("%w: %q claim does not match access token hash", ErrDPoP, "ath")
+	}
+	if proof.IAT == nil {
+		return nil, fmt.Errorf("%w: %q claim is required", ErrDPoP, "iat")
+	}
+	now := time.Now()
+	if proof.IAT.After(now.Add(p.dpop.ClockSkew)) || proof.IAT.Add(p.dpop.ProofMaxAge).Before(now) {
+		return nil, fmt.Errorf("%w: %q claim is outside of the acceptable window", ErrDPoP, "iat")
+	}
+	if proof.JTI == "" {
+		return nil, fmt.Errorf("%w: %q claim is required", ErrDPoP, jtiClaim)
+	}
+	if p.replayStore == nil {
+		return nil, fmt.Errorf("%w: DPoP proof validation requires a replay store", ErrNoConfiguration)
+	}
+	return &replayRecord{
+		expires:  proof.IAT.Add(p.dpop.ProofMaxAge + p.dpop.ClockSkew),
+		key:      "dpop\x00" + jkt + "\x00" + proof.JTI,
+		replayed: fmt.Errorf("%w: proof has already been used: %s", ErrDPoP, ErrReplay),
+	}, nil
+}
+
+// sameHTU compares a DPoP proof's `htu` claim to the HTTP target URI without query and fragment parts as described in
+// RFC 9449 Section 4.3.
+func sameHTU(htu, target string) bool {
+	a, err := url.Parse(htu)
+	if err != nil || htu == "" {
+		return false
+	}
+	b, err := url.Parse(target)
+	if err != nil || target == "" {
+		return false
+	}
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Host, b.Host) && a.EscapedPath() == b.EscapedPath()
+}
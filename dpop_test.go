@@ -0,0 +1,243 @@
+package jcp_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/MicahParks/jcp"
+)
+
+const (
+	dpopHTU = "https://resource.example.com/protected"
+	dpopTyp = "dpop+jwt"
+)
+
+func TestProxy_DPoP(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	proxy, err := jcp.NewProxyWithOptions(map[string]keyfunc.Options{jwksServer.URL: {}}, jcp.ProxyOptions{
+		ReplayStore: jcp.NewMemoryReplayStore(0),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	proofKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate DPoP key: %v.", err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate DPoP key: %v.", err)
+	}
+	publicJWK := func(key *ecdsa.PrivateKey) map[string]interface{} {
+		return map[string]interface{}{
+			"crv": "P-256",
+			"kty": "EC",
+			"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+		}
+	}
+	// The members of an EC JWK marshal in the lexicographic order required by RFC 7638.
+	canonical, err := json.Marshal(publicJWK(proofKey))
+	if err != nil {
+		t.Fatalf("Failed to marshal JWK: %v.", err)
+	}
+	sum := sha256.Sum256(canonical)
+	jkt := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	exp := jwt.NewNumericDate(time.Now().Add(time.Minute))
+	signAccess := func(claims jwt.MapClaims) string {
+		j := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		j.Header[headerKID] = testKID
+		token, err := j.SignedString(privateKey)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return token
+	}
+	bound := signAccess(jwt.MapClaims{"cnf": map[string]string{"jkt": jkt}, "exp": exp})
+	unbound := signAccess(jwt.MapClaims{"exp": exp})
+	boundJTI := signAccess(jwt.MapClaims{"cnf": map[string]string{"jkt": jkt}, "exp": exp, "jti": "stolen"})
+
+	ath := func(token string) string {
+		s := sha256.Sum256([]byte(token))
+		return base64.RawURLEncoding.EncodeToString(s[:])
+	}
+	type proofParams struct {
+		claims jwt.MapClaims
+		jwk    interface{}
+		key    interface{}
+		method jwt.SigningMethod
+		typ    string
+	}
+	signProof := func(p proofParams) string {
+		if p.method == nil {
+			p.method = jwt.SigningMethodES256
+		}
+		if p.key == nil {
+			p.key = proofKey
+		}
+		if p.jwk == nil {
+			p.jwk = publicJWK(proofKey)
+		}
+		if p.typ == "" {
+			p.typ = dpopTyp
+		}
+		j := jwt.NewWithClaims(p.method, p.claims)
+		j.Header["jwk"] = p.jwk
+		j.Header["typ"] = p.typ
+		token, err := j.SignedString(p.key)
+		if err != nil {
+			t.Fatalf("Failed to sign DPoP proof: %v.", err)
+		}
+		return token
+	}
+	proofClaims := func(jti string) jwt.MapClaims {
+		return jwt.MapClaims{
+			"ath": ath(bound),
+			"htm": http.MethodGet,
+			"htu": dpopHTU,
+			"iat": time.Now().Unix(),
+			"jti": jti,
+		}
+	}
+	with := func(claims jwt.MapClaims, key string, value interface{}) jwt.MapClaims {
+		claims[key] = value
+		return claims
+	}
+	privateJWK := publicJWK(proofKey)
+	privateJWK["d"] = base64.RawURLEncoding.EncodeToString(proofKey.D.Bytes())
+
+	good := signProof(proofParams{claims: proofClaims("1")})
+	args := func(token, proof string) jcp.ValidateArgs {
+		return jcp.ValidateArgs{DPoP: proof, HTM: http.MethodGet, HTU: dpopHTU + "?query=ignored#fragment", Token: token}
+	}
+	rejectReplay := func(a jcp.ValidateArgs) jcp.ValidateArgs {
+		a.RejectReplay = true
+		return a
+	}
+
+	testCases := []struct {
+		args jcp.ValidateArgs
+		err  error
+		name string
+	}{
+		{
+			args: args(bound, good),
+			name: "Valid",
+		},
+		{
+			args: args(bound, good),
+			err:  jcp.ErrDPoP,
+			name: "Replay",
+		},
+		{
+			args: args(unbound, ""),
+			name: "UnboundWithoutProof",
+		},
+		{
+			args: args(bound, ""),
+			err:  jcp.ErrDPoP,
+			name: "BoundWithoutProof",
+		},
+		{
+			args: args(unbound, signProof(proofParams{claims: with(proofClaims("2"), "ath", ath(unbound))})),
+			err:  jcp.ErrDPoP,
+			name: "UnboundWithProof",
+		},
+		{
+			args: args(bound, signProof(proofParams{claims: proofClaims("3"), typ: "JWT"})),
+			err:  jcp.ErrDPoP,
+			name: "WrongTyp",
+		},
+		{
+			args: args(bound, signProof(proofParams{claims: proofClaims("4"), jwk: publicJWK(otherKey), key: otherKey})),
+			err:  jcp.ErrDPoP,
+			name: "WrongKey",
+		},
+		{
+			args: args(bound, signProof(proofParams{claims: proofClaims("5"), jwk: privateJWK})),
+			err:  jcp.ErrDPoP,
+			name: "PrivateJWK",
+		},
+		{
+			args: args(bound, signProof(proofParams{claims: proofClaims("6"), key: otherKey})),
+			err:  jcp.ErrDPoP,
+			name: "BadSignature",
+		},
+		{
+			args: args(bound, signProof(proofParams{claims: proofClaims("7"), key: []byte(hmacSecret), method: jwt.SigningMethodHS256})),
+			err:  jcp.ErrDPoP,
+			name: "SymmetricAlg",
+		},
+		{
+			args: args(bound, signProof(proofParams{claims: with(proofClaims("8"), "htm", http.MethodPost)})),
+			err:  jcp.ErrDPoP,
+			name: "WrongHTM",
+		},
+		{
+			args: args(bound, signProof(proofParams{claims: with(proofClaims("9"), "htu", "https://resource.example.com/other")})),
+			err:  jcp.ErrDPoP,
+			name: "WrongHTU",
+		},
+		{
+			args: args(bound, signProof(proofParams{claims: with(proofClaims("10"), "ath", ath(unbound))})),
+			err:  jcp.ErrDPoP,
+			name: "WrongATH",
+		},
+		{
+			args: args(bound, signProof(proofParams{claims: with(proofClaims("11"), "iat", time.Now().Add(-time.Hour).Unix())})),
+			err:  jcp.ErrDPoP,
+			name: "Stale",
+		},
+		{
+			args: args(bound, signProof(proofParams{claims: with(proofClaims("12"), "iat", time.Now().Add(time.Hour).Unix())})),
+			err:  jcp.ErrDPoP,
+			name: "Future",
+		},
+		{
+			args: args(bound, signProof(proofParams{claims: with(proofClaims("13"), "iat", time.Now().Add(10*time.Second).Unix())})),
+			name: "WithinClockSkew",
+		},
+		{
+			args: args(bound, signProof(proofParams{claims: with(proofClaims(""), "jti", "")})),
+			err:  jcp.ErrDPoP,
+			name: "NoJTI",
+		},
+		{
+			args: rejectReplay(args(boundJTI, "")),
+			err:  jcp.ErrDPoP,
+			name: "StolenWithoutProof",
+		},
+		{
+			args: rejectReplay(args(boundJTI, signProof(proofParams{claims: with(proofClaims("14"), "ath", ath(boundJTI))}))),
+			name: "JTINotRecordedForFailedProof",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := proxy.Validate(ctx, tc.args)
+			if err != nil || tc.err != nil {
+				if errors.Is(err, tc.err) {
+					return
+				}
+				t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+			}
+		})
+	}
+}
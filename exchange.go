@@ -0,0 +1,436 @@
+package jcp
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultExchangeRotationInterval is the default time a generated signing key is used for before it is rotated.
+	DefaultExchangeRotationInterval = 24 * time.Hour
+	// DefaultExchangeTokenLifetime is the default lifetime of a minted token.
+	DefaultExchangeTokenLifetime = 5 * time.Minute
+	// GrantTypeTokenExchange is the OAuth 2.0 grant type of a token exchange as defined in RFC 8693.
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	// TokenTypeAccessToken is the token type of an OAuth 2.0 access token as defined in RFC 8693.
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	// TokenTypeIDToken is the token type of an OpenID Connect ID token as defined in RFC 8693.
+	TokenTypeIDToken = "urn:ietf:params:oauth:token-type:id_token"
+	// TokenTypeJWT is the token type of a JWT as defined in RFC 8693.
+	TokenTypeJWT    = "urn:ietf:params:oauth:token-type:jwt"
+	nbfClaim        = "nbf"
+	tokenTypeBearer = "Bearer"
+)
+
+var (
+	// ErrExchange is returned when a token exchange request is not allowed.
+	ErrExchange = errors.New("token exchange failed")
+	// ErrExchangeTarget is returned when a token exchange requests an audience that is not allowed.
+	ErrExchangeTarget = errors.New("token exchange audience not allowed")
+)
+
+// reservedExchangeClaims are set by the Exchanger and can not be given by the claims template.
+var reservedExchangeClaims = []string{audClaim, expClaim, iatClaim, issClaim, jtiClaim, nbfClaim}
+
+// ExchangeArgs are the arguments of a token exchange.
+type ExchangeArgs struct {
+	// Audience are the audiences the minted token is for. Every configured audience is used when empty.
+	Audience []string
+	// SubjectToken is the token to exchange. It is validated by the Proxy.
+	SubjectToken string
+	// SubjectTokenType is the RFC 8693 token type of the subject token. It must be a JWT, access token, or ID token.
+	SubjectTokenType string
+}
+
+// ExchangeOptions are the options for minting internal tokens in exchange for validated tokens.
+type ExchangeOptions struct {
+	// Audiences are the audiences minted tokens can be for.
+	Audiences []string
+	// Claims is a template mapping the names of claims of minted tokens to CEL expressions. The expressions can use the
+	// subject token's `header` and `claims`. A claim is left out when its expression is `null`. The `sub` claim is
+	// copied from the subject token unless it is in the template.
+	Claims map[string]string
+	// ExpressionCostLimit is the maximum runtime cost of evaluating a single claim expression.
+	// DefaultExpressionCostLimit is used when zero.
+	ExpressionCostLimit uint64
+	// Issuer is the `iss` claim of minted tokens.
+	Issuer string
+	// Keys is a map of key IDs to Ed25519, ECDSA, or RSA private keys for signing minted tokens. All of them are
+	// published. An Ed25519 key is generated and rotated every RotationInterval when empty. Generated keys are only held
+	// in memory by this Exchanger, so Keys must be given when more than one instance mints tokens for the same issuer.
+	Keys map[string]crypto.PrivateKey
+	// Policy is the policy subject tokens are validated with. It must require an audience, so tokens issued for other
+	// services can not be exchanged. Required.
+	Policy string
+	// RotationInterval is the time a generated signing key is used for. The next key is published a rotation before it
+	// is used and a retired key is published until the tokens it signed expire. DefaultExchangeRotationInterval is used
+	// when zero.
+	RotationInterval time.Duration
+	// SigningKey is the key ID of the key in Keys that signs minted tokens. It is needed when there is more than one key.
+	SigningKey string
+	// TokenLifetime is the lifetime of minted tokens. DefaultExchangeTokenLifetime is used when zero.
+	TokenLifetime time.Duration
+}
+
+// exchangeKey is a key that signs minted tokens.
+type exchangeKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey
+}
+
+// verifier is a Proxy that can return its policies and the claims of a token it validated.
+type verifier interface {
+	Proxy
+	policy(name string) (Policy, error)
+	verifiedToken(token string) (*jwt.Token, jwt.MapClaims, error)
+}
+
+// Exchanger mints internal tokens in exchange for tokens validated by a Proxy, in the style of RFC 8693. It publishes
+// the public keys of its signing keys as a JWK Set.
+type Exchanger struct {
+	audiences []string
+	claims    map[string]expression
+	current   exchangeKey
+	issuer    string
+	jwks      jwkset.JWKSet[any]
+	lifetime  time.Duration
+	mux       sync.Mutex
+	next      exchangeKey
+	policy    string
+	proxy     verifier
+	retired   map[string]time.Time
+	rotated   time.Time
+	rotation  time.Duration
+}
+
+// NewExchanger creates a new Exchanger. The Proxy must be created by NewProxy.
+func NewExchanger(ctx context.Context, p Proxy, options ExchangeOptions) (*Exchanger, error) {
+	v, ok := p.(verifier)
+	if !ok {
+		return nil, fmt.Errorf("%w: the token exchange proxy must be created by NewProxy", ErrNoConfiguration)
+	}
+	if options.Issuer == "" {
+		return nil, fmt.Errorf("%w: no token exchange issuer", ErrInvalidConfig)
+	}
+	if len(options.Audiences) == 0 {
+		return nil, fmt.Errorf("%w: no token exchange audiences", ErrInvalidConfig)
+	}
+	if options.Policy == "" {
+		return nil, fmt.Errorf("%w: no token exchange policy", ErrInvalidConfig)
+	}
+	policy, err := v.policy(options.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("%w: token exchange policy: %s", ErrInvalidConfig, err)
+	}
+	if len(policy.Aud) == 0 {
+		return nil, fmt.Errorf("%w: token exchange policy %q has no audiences", ErrInvalidConfig, options.Policy)
+	}
+	if options.ExpressionCostLimit == 0 {
+		options.ExpressionCostLimit = DefaultExpressionCostLimit
+	}
+	if options.RotationInterval == 0 {
+		options.RotationInterval = DefaultExchangeRotationInterval
+	}
+	if options.TokenLifetime == 0 {
+		options.TokenLifetime = DefaultExchangeTokenLifetime
+	}
+	env, err := newExpressionEnv()
+	if err != nil {
+		return nil, err
+	}
+	e := &Exchanger{
+		audiences: options.Audiences,
+		claims:    make(map[string]expression, len(options.Claims)),
+		issuer:    options.Issuer,
+		jwks:      jwkset.NewMemory[any](),
+		lifetime:  options.TokenLifetime,
+		policy:    options.Policy,
+		proxy:     v,
+		retired:   make(map[string]time.Time),
+	}
+	for name, source := range options.Claims {
+		err = validateExchangeClaim(name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+		}
+		e.claims[name], err = compileCEL(env, source, options.ExpressionCostLimit, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: token exchange claim %q: %s", ErrInvalidConfig, name, err)
+		}
+	}
+
+	if len(options.Keys) == 0 {
+		e.rotation = options.RotationInterval
+		e.current, err = e.generate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		e.next, err = e.generate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		e.rotated = time.Now()
+		return e, nil
+	}
+	kids := make([]string, 0, len(options.Keys))
+	for kid := range options.Keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+	if options.SigningKey == "" {
+		if len(kids) != 1 {
+			return nil, fmt.Errorf("%w: a token exchange signing key is required with multiple keys", ErrInvalidConfig)
+		}
+		options.SigningKey = kids[0]
+	}
+	for _, kid := range kids {
+		key, err := newExchangeKey(kid, options.Keys[kid])
+		if err != nil {
+			return nil, err
+		}
+		err = e.publish(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if kid == options.SigningKey {
+			e.current = key
+		}
+	}
+	if e.current.kid == "" {
+		return nil, fmt.Errorf("%w: token exchange signing key %q not found", ErrInvalidConfig, options.SigningKey)
+	}
+	return e, nil
+}
+
+// Exchange validates the subject token and mints an internal token for it.
+func (e *Exchanger) Exchange(ctx context.Context, args ExchangeArgs) (ExchangeResults, error) {
+	switch args.SubjectTokenType {
+	case TokenTypeAccessToken, TokenTypeIDToken, TokenTypeJWT:
+	default:
+		return ExchangeResults{}, fmt.Errorf("%w: unsupported subject token type %q", ErrExchange, args.SubjectTokenType)
+	}
+	aud := args.Audience
+	if len(aud) == 0 {
+		aud = e.audiences
+	}
+	for _, a := range aud {
+		if !contains(e.audiences, a) {
+			return ExchangeResults{}, fmt.Errorf("%w: %q", ErrExchangeTarget, a)
+		}
+	}
+
+	_, err := e.proxy.Validate(ctx, ValidateArgs{
+		Policy: e.policy,
+		Token:  args.SubjectToken,
+	})
+	if err != nil {
+		return ExchangeResults{}, err
+	}
+	token, subject, err := e.proxy.verifiedToken(args.SubjectToken)
+	if err != nil {
+		return ExchangeResults{}, err
+	}
+
+	claims := jwt.MapClaims{}
+	if sub, ok := subject[subClaim]; ok {
+		claims[subClaim] = sub
+	}
+	vars := map[string]interface{}{
+		"claims":  map[string]interface{}(subject),
+		"header":  token.Header,
+		"request": map[string]interface{}{},
+	}
+	for name, expr := range e.claims {
+		value, err := expr.value(ctx, vars)
+		if err != nil {
+			return ExchangeResults{}, fmt.Errorf("%w: claim %q: %s", ErrExchange, name, err)
+		}
+		if value == nil {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+	if sub, _ := claims[subClaim].(string); sub == "" {
+		return ExchangeResults{}, fmt.Errorf("%w: claim %q is required", ErrExchange, subClaim)
+	}
+
+	key, err := e.signingKey(ctx)
+	if err != nil {
+		return ExchangeResults{}, err
+	}
+	now := time.Now()
+	claims[audClaim] = aud
+	claims[expClaim] = now.Add(e.lifetime).Unix()
+	claims[iatClaim] = now.Unix()
+	claims[issClaim] = e.issuer
+	claims[jtiClaim] = uuid.NewString()
+	claims[nbfClaim] = now.Unix()
+	j := jwt.NewWithClaims(key.method, claims)
+	j.Header[headerKID] = key.kid
+	signed, err := j.SignedString(key.private)
+	if err != nil {
+		return ExchangeResults{}, fmt.Errorf("failed to sign exchanged token: %w", err)
+	}
+	return ExchangeResults{
+		AccessToken:     signed,
+		ExpiresIn:       int64(e.lifetime / time.Second),
+		IssuedTokenType: TokenTypeAccessToken,
+		TokenType:       tokenTypeBearer,
+	}, nil
+}
+
+// JWKS returns the JWK Set of the public keys of the signing keys.
+func (e *Exchanger) JWKS(ctx context.Context) (json.RawMessage, error) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	err := e.rotate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return e.jwks.JSONPublic(ctx)
+}
+
+// signingKey returns the current signing key, rotating generated keys first when needed.
+func (e *Exchanger) signingKey(ctx context.Context) (exchangeKey, error) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	err := e.rotate(ctx)
+	if err != nil {
+		return exchangeKey{}, err
+	}
+	return e.current, nil
+}
+
+// rotate replaces the current generated key with the next one once it has been used for the rotation interval and
+// removes retired keys once the tokens they signed have expired. It must be called with the lock held.
+func (e *Exchanger) rotate(ctx context.Context) error {
+	now := time.Now()
+	for kid, expires := range e.retired {
+		if now.After(expires) {
+			_, err := e.jwks.Store.DeleteKey(ctx, kid)
+			if err != nil {
+				return fmt.Errorf("failed to remove retired token exchange key: %w", err)
+			}
+			delete(e.retired, kid)
+		}
+	}
+	if e.rotation == 0 || now.Sub(e.rotated) < e.rotation {
+		return nil
+	}
+	next, err := e.generate(ctx)
+	if err != nil {
+		return err
+	}
+	e.retired[e.current.kid] = now.Add(e.lifetime)
+	e.current = e.next
+	e.next = next
+	e.rotated = now
+	return nil
+}
+
+// generate creates and publishes an Ed25519 signing key.
+func (e *Exchanger) generate(ctx context.Context) (exchangeKey, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return exchangeKey{}, fmt.Errorf("failed to generate token exchange key: %w", err)
+	}
+	key := exchangeKey{
+		kid:     uuid.NewString(),
+		method:  jwt.SigningMethodEdDSA,
+		private: private,
+	}
+	err = e.publish(ctx, key)
+	if err != nil {
+		return exchangeKey{}, err
+	}
+	return key, nil
+}
+
+// publish adds the public key of the signing key to the JWK Set.
+func (e *Exchanger) publish(ctx context.Context, key exchangeKey) error {
+	signer, ok := key.private.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("%w: token exchange key %q can not sign", ErrInvalidConfig, key.kid)
+	}
+	meta := jwkset.NewKey[any](signer.Public(), key.kid)
+	meta.ALG = jwkset.ALG(key.method.Alg())
+	err := e.jwks.Store.WriteKey(ctx, meta)
+	if err != nil {
+		return fmt.Errorf("failed to publish token exchange key %q: %w", key.kid, err)
+	}
+	return nil
+}
+
+// newExchangeKey returns the signing key with the JWT signing method for its type.
+func newExchangeKey(kid string, private crypto.PrivateKey) (exchangeKey, error) {
+	var method jwt.SigningMethod
+	switch key := private.(type) {
+	case ed25519.PrivateKey:
+		method = jwt.SigningMethodEdDSA
+	case *ecdsa.PrivateKey:
+		switch key.Curve.Params().BitSize {
+		case 256:
+			method = jwt.SigningMethodES256
+		case 384:
+			method = jwt.SigningMethodES384
+		case 521:
+			method = jwt.SigningMethodES512
+		default:
+			return exchangeKey{}, fmt.Errorf("%w: unsupported curve for token exchange key %q", ErrInvalidConfig, kid)
+		}
+	case *rsa.PrivateKey:
+		method = jwt.SigningMethodRS256
+	default:
+		return exchangeKey{}, fmt.Errorf("%w: unsupported token exchange key type %T for key ID %q", ErrInvalidConfig, private, kid)
+	}
+	return exchangeKey{
+		kid:     kid,
+		method:  method,
+		private: private,
+	}, nil
+}
+
+// validateExchangeClaim confirms the claim can be given by the claims template.
+func validateExchangeClaim(name string) error {
+	if name == "" || contains(reservedExchangeClaims, name) {
+		return fmt.Errorf("token exchange claim %q can not be templated", name)
+	}
+	return nil
+}
+
+// verifiedToken returns the header and claims of a token the proxy validated. Encrypted tokens are decrypted again.
+func (p proxy) verifiedToken(token string) (*jwt.Token, jwt.MapClaims, error) {
+	raw := token
+	if isJWE(raw) {
+		if p.jwe == nil {
+			return nil, nil, fmt.Errorf("%w: encrypted tokens are not accepted", ErrJWE)
+		}
+		var err error
+		raw, err = p.jwe.decrypt(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	claims := jwt.MapClaims{}
+	t, _, err := jwt.NewParser().ParseUnverified(raw, claims)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse validated token: %w", err)
+	}
+	return t, claims, nil
+}
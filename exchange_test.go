@@ -0,0 +1,324 @@
+package jcp_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+
+	"github.com/MicahParks/jcp"
+)
+
+const (
+	exchangeAud    = "https://api.example.com"
+	exchangePolicy = "exchange"
+	internalAud    = "https://orders.internal"
+	internalIssuer = "https://jcp.internal"
+)
+
+func TestHTTPHandler_Exchange(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	proxy, err := jcp.NewProxyWithOptions(map[string]keyfunc.Options{jwksServer.URL: {}}, jcp.ProxyOptions{
+		Policies: map[string]jcp.Policy{
+			exchangePolicy: {Aud: []string{exchangeAud}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+	exchanger, err := jcp.NewExchanger(ctx, proxy, jcp.ExchangeOptions{
+		Audiences: []string{internalAud, "https://billing.internal"},
+		Claims: map[string]string{
+			"email":  "has(claims.email) ? claims.email : null",
+			"tenant": "claims.org",
+		},
+		Issuer: internalIssuer,
+		Policy: exchangePolicy,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create exchanger: %v.", err)
+	}
+	handler := jcp.HTTPHandler{
+		Exchanger:       exchanger,
+		Logger:          zap.NewNop(),
+		Proxy:           proxy,
+		RequestMaxBytes: jcp.DefaultRequestMaxBytes,
+	}
+
+	j := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+		"aud": exchangeAud,
+		"exp": time.Now().Add(time.Minute).Unix(),
+		"org": "acme",
+		"sub": "user@example.com",
+	})
+	j.Header[headerKID] = testKID
+	subjectToken, err := j.SignedString(privateKey)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v.", err)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ExchangeJWKS().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/exchange/jwks.json", nil))
+	jwks, err := keyfunc.NewJSON(w.Body.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to parse exchange JWK Set: %v.", err)
+	}
+
+	testCases := []struct {
+		errorCode string
+		form      url.Values
+		name      string
+		status    int
+	}{
+		{
+			form: url.Values{"grant_type": {jcp.GrantTypeTokenExchange}, "subject_token": {subjectToken}, "subject_token_type": {jcp.TokenTypeAccessToken}, "audience": {internalAud}},
+			name: "Exchanged",
+		},
+		{
+			errorCode: "invalid_target",
+			form:      url.Values{"grant_type": {jcp.GrantTypeTokenExchange}, "subject_token": {subjectToken}, "subject_token_type": {jcp.TokenTypeJWT}, "audience": {"https://other.example.com"}},
+			name:      "AudienceNotAllowed",
+			status:    http.StatusBadRequest,
+		},
+		{
+			errorCode: "unsupported_grant_type",
+			form:      url.Values{"grant_type": {"client_credentials"}, "subject_token": {subjectToken}, "subject_token_type": {jcp.TokenTypeJWT}},
+			name:      "GrantType",
+			status:    http.StatusBadRequest,
+		},
+		{
+			errorCode: "invalid_request",
+			form:      url.Values{"grant_type": {jcp.GrantTypeTokenExchange}, "subject_token": {subjectToken}, "subject_token_type": {"urn:ietf:params:oauth:token-type:saml2"}},
+			name:      "SubjectTokenType",
+			status:    http.StatusBadRequest,
+		},
+		{
+			errorCode: "invalid_request",
+			form:      url.Values{"grant_type": {jcp.GrantTypeTokenExchange}, "subject_token": {anyOtherString}, "subject_token_type": {jcp.TokenTypeJWT}},
+			name:      "InvalidSubjectToken",
+			status:    http.StatusBadRequest,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/exchange", strings.NewReader(tc.form.Encode()))
+			r.Header.Set(jcp.HeaderContentType, jcp.ContentTypeForm)
+			handler.Exchange().ServeHTTP(w, r)
+			if tc.status == 0 {
+				tc.status = http.StatusOK
+			}
+			if w.Code != tc.status {
+				t.Fatalf("Expected status code %d, got %d: %s.", tc.status, w.Code, w.Body.String())
+			}
+			if w.Header().Get(jcp.HeaderCacheControl) != "no-store" {
+				t.Fatalf("Expected the response not to be stored.")
+			}
+			if tc.errorCode != "" {
+				var resp jcp.ExchangeErrorResponse
+				err := json.Unmarshal(w.Body.Bytes(), &resp)
+				if err != nil || resp.Error != tc.errorCode {
+					t.Fatalf("Expected error %q, got %q.", tc.errorCode, w.Body.String())
+				}
+				return
+			}
+
+			var resp jcp.ExchangeResults
+			err := json.Unmarshal(w.Body.Bytes(), &resp)
+			if err != nil {
+				t.Fatalf("Failed to parse response: %v.", err)
+			}
+			if resp.IssuedTokenType != jcp.TokenTypeAccessToken || resp.TokenType != "Bearer" || resp.ExpiresIn != int64(jcp.DefaultExchangeTokenLifetime/time.Second) {
+				t.Fatalf("Unexpected response: %+v.", resp)
+			}
+			claims := jwt.MapClaims{}
+			_, err = jwt.ParseWithClaims(resp.AccessToken, claims, jwks.Keyfunc)
+			if err != nil {
+				t.Fatalf("Failed to verify minted token with the exchange JWK Set: %v.", err)
+			}
+			if !claims.VerifyIssuer(internalIssuer, true) || !claims.VerifyAudience(internalAud, true) || claims.VerifyAudience("https://billing.internal", true) {
+				t.Fatalf("Unexpected registered claims: %v.", claims)
+			}
+			if claims["sub"] != "user@example.com" || claims["tenant"] != "acme" || claims["jti"] == nil {
+				t.Fatalf("Unexpected claims: %v.", claims)
+			}
+			if _, ok := claims["email"]; ok {
+				t.Fatalf("Expected a null claim to be left out.")
+			}
+		})
+	}
+}
+
+func TestExchanger_Rotation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	proxy, err := jcp.NewProxyWithOptions(map[string]keyfunc.Options{jwksServer.URL: {}}, jcp.ProxyOptions{
+		Policies: map[string]jcp.Policy{
+			exchangePolicy: {Aud: []string{exchangeAud}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+	exchanger, err := jcp.NewExchanger(ctx, proxy, jcp.ExchangeOptions{
+		Audiences:        []string{internalAud},
+		Issuer:           internalIssuer,
+		Policy:           exchangePolicy,
+		RotationInterval: 100 * time.Millisecond,
+		TokenLifetime:    100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create exchanger: %v.", err)
+	}
+
+	j := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.RegisteredClaims{Audience: jwt.ClaimStrings{exchangeAud}, Subject: anyNonEmptyString})
+	j.Header[headerKID] = testKID
+	subjectToken, err := j.SignedString(privateKey)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v.", err)
+	}
+	exchange := func() string {
+		results, err := exchanger.Exchange(ctx, jcp.ExchangeArgs{SubjectToken: subjectToken, SubjectTokenType: jcp.TokenTypeJWT})
+		if err != nil {
+			t.Fatalf("Failed to exchange token: %v.", err)
+		}
+		token, _, err := jwt.NewParser().ParseUnverified(results.AccessToken, jwt.MapClaims{})
+		if err != nil {
+			t.Fatalf("Failed to parse minted token: %v.", err)
+		}
+		return token.Header[headerKID].(string)
+	}
+	published := func() map[string]bool {
+		raw, err := exchanger.JWKS(ctx)
+		if err != nil {
+			t.Fatalf("Failed to get exchange JWK Set: %v.", err)
+		}
+		jwks, err := keyfunc.NewJSON(raw)
+		if err != nil {
+			t.Fatalf("Failed to parse exchange JWK Set: %v.", err)
+		}
+		kids := make(map[string]bool)
+		for _, kid := range jwks.KIDs() {
+			kids[kid] = true
+		}
+		return kids
+	}
+
+	first := exchange()
+	before := published()
+	if len(before) != 2 || !before[first] {
+		t.Fatalf("Expected the current and next keys to be published, got %v.", before)
+	}
+	time.Sleep(150 * time.Millisecond)
+	second := exchange()
+	if second == first || !before[second] {
+		t.Fatalf("Expected rotation to the published next key.")
+	}
+	if !published()[first] {
+		t.Fatalf("Expected the retired key to be published until its tokens expire.")
+	}
+	time.Sleep(150 * time.Millisecond)
+	if published()[first] {
+		t.Fatalf("Expected the retired key to be removed after its tokens expire.")
+	}
+}
+
+func TestNewExchanger_Keys(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	proxy, err := jcp.NewProxyWithOptions(map[string]keyfunc.Options{jwksServer.URL: {}}, jcp.ProxyOptions{
+		Policies: map[string]jcp.Policy{
+			anyNonEmptyString: {},
+			exchangePolicy:    {Aud: []string{exchangeAud}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+	current, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v.", err)
+	}
+	previous, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v.", err)
+	}
+	keys := map[string]crypto.PrivateKey{"current": current, "previous": previous}
+
+	testCases := []struct {
+		err     error
+		name    string
+		options jcp.ExchangeOptions
+	}{
+		{
+			name:    "SigningKey",
+			options: jcp.ExchangeOptions{Audiences: []string{internalAud}, Issuer: internalIssuer, Keys: keys, Policy: exchangePolicy, SigningKey: "current"},
+		},
+		{
+			err:     jcp.ErrInvalidConfig,
+			name:    "NoSigningKey",
+			options: jcp.ExchangeOptions{Audiences: []string{internalAud}, Issuer: internalIssuer, Keys: keys, Policy: exchangePolicy},
+		},
+		{
+			err:     jcp.ErrInvalidConfig,
+			name:    "ReservedClaim",
+			options: jcp.ExchangeOptions{Audiences: []string{internalAud}, Claims: map[string]string{"iss": "claims.iss"}, Issuer: internalIssuer, Policy: exchangePolicy},
+		},
+		{
+			err:     jcp.ErrInvalidConfig,
+			name:    "NoPolicy",
+			options: jcp.ExchangeOptions{Audiences: []string{internalAud}, Issuer: internalIssuer, Keys: keys, SigningKey: "current"},
+		},
+		{
+			err:     jcp.ErrInvalidConfig,
+			name:    "PolicyWithoutAudience",
+			options: jcp.ExchangeOptions{Audiences: []string{internalAud}, Issuer: internalIssuer, Keys: keys, Policy: anyNonEmptyString, SigningKey: "current"},
+		},
+		{
+			err:     jcp.ErrInvalidConfig,
+			name:    "UnknownPolicy",
+			options: jcp.ExchangeOptions{Audiences: []string{internalAud}, Issuer: internalIssuer, Keys: keys, Policy: anyOtherString, SigningKey: "current"},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			exchanger, err := jcp.NewExchanger(ctx, proxy, tc.options)
+			if err != nil || tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+				}
+				return
+			}
+			raw, err := exchanger.JWKS(ctx)
+			if err != nil {
+				t.Fatalf("Failed to get exchange JWK Set: %v.", err)
+			}
+			jwks, err := keyfunc.NewJSON(raw)
+			if err != nil {
+				t.Fatalf("Failed to parse exchange JWK Set: %v.", err)
+			}
+			if len(jwks.KIDs()) != 2 {
+				t.Fatalf("Expected every configured key to be published, got %v.", jwks.KIDs())
+			}
+		})
+	}
+}
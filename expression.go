@@ -0,0 +1,135 @@
+package jcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/cel-go/cel"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// DefaultExpressionCostLimit is the default maximum runtime cost of evaluating a single expression.
+	DefaultExpressionCostLimit = 100000
+	// expressionMaxLength is the maximum number of code points in an expression.
+	expressionMaxLength = 4096
+)
+
+// ErrExpression is returned when an expression does not evaluate to true.
+var ErrExpression = errors.New("expression check failed")
+
+// expression is a compiled CEL expression.
+type expression struct {
+	program cel.Program
+	source  string
+}
+
+// newExpressionEnv creates the CEL environment of expressions. The `header` and `claims` variables are the verified
+// JWT's header and claims and the `request` variable is the variables given by the caller.
+func newExpressionEnv() (*cel.Env, error) {
+	env, err := cel.NewEnv(
+		cel.CrossTypeNumericComparisons(true),
+		cel.ParserExpressionSizeLimit(expressionMaxLength),
+		cel.Variable("claims", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("header", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create expression environment: %w", err)
+	}
+	return env, nil
+}
+
+// compileExpression compiles the source of an expression that must evaluate to a bool. Evaluating the expression fails
+// when its runtime cost is more than costLimit.
+func compileExpression(env *cel.Env, source string, costLimit uint64) (expression, error) {
+	return compileCEL(env, source, costLimit, cel.BoolType)
+}
+
+// compileCEL compiles the source of an expression that must evaluate to the output type when it is not nil.
+func compileCEL(env *cel.Env, source string, costLimit uint64, output *cel.Type) (expression, error) {
+	ast, issues := env.Compile(source)
+	if issues.Err() != nil {
+		return expression{}, fmt.Errorf("invalid expression %q: %s", source, issues.Err())
+	}
+	if output != nil && !ast.OutputType().IsExactType(output) && !ast.OutputType().IsExactType(cel.DynType) {
+		return expression{}, fmt.Errorf("expression %q must evaluate to a %s, not %s", source, output, ast.OutputType())
+	}
+	program, err := env.Program(ast, cel.CostLimit(costLimit), cel.InterruptCheckFrequency(100))
+	if err != nil {
+		return expression{}, fmt.Errorf("invalid expression %q: %s", source, err)
+	}
+	return expression{
+		program: program,
+		source:  source,
+	}, nil
+}
+
+// eval confirms the expression evaluates to true. A missing claim or variable fails, so `has()` is used for optional
+// ones.
+func (e expression) eval(ctx context.Context, vars map[string]interface{}) error {
+	out, _, err := e.program.ContextEval(ctx, vars)
+	if err != nil {
+		return fmt.Errorf("%w: expression %q failed: %s", ErrExpression, e.source, err)
+	}
+	if ok, _ := out.Value().(bool); !ok {
+		return fmt.Errorf("%w: expression %q is not true", ErrExpression, e.source)
+	}
+	return nil
+}
+
+// value evaluates the expression to a JSON compatible value. A `null` result is nil.
+func (e expression) value(ctx context.Context, vars map[string]interface{}) (interface{}, error) {
+	out, _, err := e.program.ContextEval(ctx, vars)
+	if err != nil {
+		return nil, fmt.Errorf("expression %q failed: %s", e.source, err)
+	}
+	native, err := out.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+	if err != nil {
+		return nil, fmt.Errorf("expression %q is not a JSON value: %s", e.source, err)
+	}
+	return native.(*structpb.Value).AsInterface(), nil
+}
+
+// checkExpressions confirms the expressions of the policy and of the request evaluate to true. The request's
+// expressions are compiled for each request.
+func (p proxy) checkExpressions(ctx context.Context, args ValidateArgs, policyName string, raw string, token *jwt.Token) error {
+	policyExpressions := p.expressions[policyName]
+	if len(policyExpressions) == 0 && len(args.Expressions) == 0 {
+		return nil
+	}
+	claims := jwt.MapClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(raw, claims)
+	if err != nil {
+		return fmt.Errorf("%w: failed to parse claims: %s", ErrExpression, err)
+	}
+	request := args.Variables
+	if request == nil {
+		request = map[string]interface{}{}
+	}
+	vars := map[string]interface{}{
+		"claims":  map[string]interface{}(claims),
+		"header":  token.Header,
+		"request": request,
+	}
+	for _, e := range policyExpressions {
+		err = e.eval(ctx, vars)
+		if err != nil {
+			return err
+		}
+	}
+	for _, source := range args.Expressions {
+		e, err := compileExpression(p.expressionEnv, source, p.expressionCostLimit)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrExpression, err)
+		}
+		err = e.eval(ctx, vars)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
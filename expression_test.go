@@ -0,0 +1,110 @@
+package jcp_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/MicahParks/jcp"
+)
+
+const tenantAdmin = "tenantAdmin"
+
+func TestProxy_Expressions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	proxy, err := jcp.NewProxyWithOptions(map[string]keyfunc.Options{jwksServer.URL: {}}, jcp.ProxyOptions{
+		ExpressionCostLimit: 1000,
+		Policies: map[string]jcp.Policy{
+			tenantAdmin: {
+				Expressions: []string{
+					"claims.tenant == request.tenant && 'admin' in claims.roles",
+					"header.alg == 'EdDSA'",
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	sign := func(roles ...string) string {
+		j := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+			"exp":    time.Now().Add(time.Minute).Unix(),
+			"roles":  roles,
+			"tenant": "acme",
+		})
+		j.Header[headerKID] = testKID
+		token, err := j.SignedString(privateKey)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return token
+	}
+	admin := sign("admin", "user")
+	user := sign("user")
+
+	testCases := []struct {
+		args jcp.ValidateArgs
+		err  error
+		name string
+	}{
+		{
+			args: jcp.ValidateArgs{Policy: tenantAdmin, Token: admin, Variables: map[string]interface{}{"tenant": "acme"}},
+			name: "PolicyTrue",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: tenantAdmin, Token: user, Variables: map[string]interface{}{"tenant": "acme"}},
+			err:  jcp.ErrExpression,
+			name: "PolicyFalse",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: tenantAdmin, Token: admin, Variables: map[string]interface{}{"tenant": "other"}},
+			err:  jcp.ErrExpression,
+			name: "OtherTenant",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: tenantAdmin, Token: admin},
+			err:  jcp.ErrExpression,
+			name: "MissingVariable",
+		},
+		{
+			args: jcp.ValidateArgs{Expressions: []string{"claims.exp > 0 && size(claims.roles) == 2"}, Token: admin},
+			name: "RequestTrue",
+		},
+		{
+			args: jcp.ValidateArgs{Expressions: []string{"has(claims.email)"}, Token: admin},
+			err:  jcp.ErrExpression,
+			name: "RequestFalse",
+		},
+		{
+			args: jcp.ValidateArgs{Expressions: []string{"claims.tenant"}, Token: admin},
+			err:  jcp.ErrExpression,
+			name: "RequestNotBool",
+		},
+		{
+			args: jcp.ValidateArgs{Expressions: []string{"claims.tenant +"}, Token: admin},
+			err:  jcp.ErrExpression,
+			name: "RequestInvalid",
+		},
+		{
+			args: jcp.ValidateArgs{Expressions: []string{"[1, 2, 3, 4, 5, 6, 7, 8, 9, 10].all(x, [1, 2, 3, 4, 5, 6, 7, 8, 9, 10].all(y, [1, 2, 3, 4, 5, 6, 7, 8, 9, 10].all(z, x + y + z > 0)))"}, Token: admin},
+			err:  jcp.ErrExpression,
+			name: "CostLimit",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := proxy.Validate(ctx, tc.args)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+			}
+		})
+	}
+}
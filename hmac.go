@@ -0,0 +1,103 @@
+package jcp
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// HMACMinKeyBytes is the minimum size of an HMAC shared secret as required for HS256 by RFC 7518 Section 3.2.
+const HMACMinKeyBytes = 32
+
+var (
+	// ErrAlgorithmConfusion is returned when the key found for a JWT does not match the type of its `alg` header.
+	ErrAlgorithmConfusion = errors.New("key type does not match JWT alg header")
+	// ErrHMACNotAllowed is returned when a JWT signed with HMAC can not be verified with any configured shared secret.
+	ErrHMACNotAllowed = errors.New("HMAC signed JWT not allowed")
+)
+
+// HMACKey is a symmetric key used to verify JWTs signed with a shared secret.
+type HMACKey struct {
+	// Issuers is the set of `iss` claim values this key is bound to. A JWT from any other issuer will not be verified
+	// with this key.
+	Issuers []string
+	// Secret is the raw shared secret.
+	Secret []byte
+}
+
+type hmacKeySource struct {
+	kids []string
+	keys map[string]HMACKey
+}
+
+func newHMACKeySource(keys map[string]HMACKey) (hmacKeySource, error) {
+	h := hmacKeySource{
+		keys: make(map[string]HMACKey, len(keys)),
+	}
+	for kid, key := range keys {
+		if len(key.Secret) < HMACMinKeyBytes {
+			return hmacKeySource{}, fmt.Errorf("%w: HMAC key %q must be at least %d bytes", ErrInvalidConfig, kid, HMACMinKeyBytes)
+		}
+		if len(key.Issuers) == 0 {
+			return hmacKeySource{}, fmt.Errorf("%w: HMAC key %q is not bound to any issuers", ErrInvalidConfig, kid)
+		}
+		h.keys[kid] = key
+		h.kids = append(h.kids, kid)
+	}
+	sort.Strings(h.kids)
+	return h, nil
+}
+
+// Keyfunc helps implement the keyfuncer interface. If the JWT has a `kid` header, only that key is considered.
+// Otherwise, the first key bound to the JWT's issuer is used.
+func (h hmacKeySource) Keyfunc(token *jwt.Token) (interface{}, error) {
+	iss := tokenIssuer(token)
+	if kid, ok := token.Header[headerKID].(string); ok {
+		key, ok := h.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrHMACNotAllowed, keyfunc.ErrKIDNotFound)
+		}
+		if !contains(key.Issuers, iss) {
+			return nil, fmt.Errorf("%w: key %q is not bound to issuer %q", ErrHMACNotAllowed, kid, iss)
+		}
+		return key.Secret, nil
+	}
+	for _, kid := range h.kids {
+		key := h.keys[kid]
+		if contains(key.Issuers, iss) {
+			return key.Secret, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no key bound to issuer %q", ErrHMACNotAllowed, iss)
+}
+
+func isHMAC(method jwt.SigningMethod) bool {
+	_, ok := method.(*jwt.SigningMethodHMAC)
+	return ok
+}
+
+func tokenIssuer(token *jwt.Token) string {
+	switch claims := token.Claims.(type) {
+	case *jwt.RegisteredClaims:
+		return claims.Issuer
+	case *tokenClaims:
+		return claims.Issuer
+	case jwt.MapClaims:
+		iss, _ := claims[issClaim].(string)
+		return iss
+	default:
+		return ""
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package jcp_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/MicahParks/jcp"
+)
+
+const (
+	hmacKID    = "my-hmac-key-id"
+	hmacSecret = "an HMAC shared secret with at least 32 bytes"
+)
+
+func TestProxy_HMAC(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// A JWK Set with a symmetric key that must never be used to verify an asymmetric alg.
+	octJWKS := json.RawMessage(fmt.Sprintf(`{"keys":[{"kty":"oct","kid":%q,"k":%q}]}`, hmacKID, base64.RawURLEncoding.EncodeToString([]byte(hmacSecret))))
+	inline := map[string]json.RawMessage{
+		anyNonEmptyString: octJWKS,
+	}
+
+	enabled, err := jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+		HMAC: map[string]jcp.HMACKey{
+			hmacKID: {
+				Issuers: []string{anyNonEmptyString},
+				Secret:  []byte(hmacSecret),
+			},
+		},
+		Inline: inline,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+	disabled, err := jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{Inline: inline})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	_, err = jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+		HMAC: map[string]jcp.HMACKey{
+			hmacKID: {
+				Issuers: []string{anyNonEmptyString},
+				Secret:  []byte("short"),
+			},
+		},
+	})
+	if !errors.Is(err, jcp.ErrInvalidConfig) {
+		t.Fatalf("Expected error %v for short secret, got %v.", jcp.ErrInvalidConfig, err)
+	}
+
+	signHMAC := func(kid, iss string) string {
+		j := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Issuer: iss})
+		if kid != "" {
+			j.Header[headerKID] = kid
+		}
+		token, err := j.SignedString([]byte(hmacSecret))
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return token
+	}
+	ecPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v.", err)
+	}
+	j := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.RegisteredClaims{Issuer: anyNonEmptyString})
+	j.Header[headerKID] = hmacKID
+	confused, err := j.SignedString(ecPrivate)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v.", err)
+	}
+
+	testCases := []struct {
+		err   error
+		name  string
+		proxy jcp.Proxy
+		token string
+	}{
+		{
+			name:  "KID",
+			proxy: enabled,
+			token: signHMAC(hmacKID, anyNonEmptyString),
+		},
+		{
+			name:  "NoKID",
+			proxy: enabled,
+			token: signHMAC("", anyNonEmptyString),
+		},
+		{
+			err:   jcp.ErrHMACNotAllowed,
+			name:  "WrongIssuer",
+			proxy: enabled,
+			token: signHMAC(hmacKID, anyOtherString),
+		},
+		{
+			err:   jcp.ErrHMACNotAllowed,
+			name:  "Disabled",
+			proxy: disabled,
+			token: signHMAC(hmacKID, anyNonEmptyString),
+		},
+		{
+			err:   jcp.ErrAlgorithmConfusion,
+			name:  "AlgorithmConfusion",
+			proxy: enabled,
+			token: confused,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.proxy.Validate(ctx, jcp.ValidateArgs{Token: tc.token})
+			if err != nil || tc.err != nil {
+				if errors.Is(err, tc.err) {
+					return
+				}
+				t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestHMACKeyConfig_Key(t *testing.T) {
+	const env = "JCP_TEST_HMAC_SECRET"
+	t.Setenv(env, hmacSecret)
+	file := writeTemp(t, "secret", []byte(hmacSecret+"\n"))
+
+	for _, config := range []jcp.HMACKeyConfig{{Env: env}, {File: file}, {Secret: hmacSecret}} {
+		key, err := config.Key()
+		if err != nil {
+			t.Fatalf("Failed to read HMAC key: %v.", err)
+		}
+		if string(key.Secret) != hmacSecret {
+			t.Fatalf("Expected secret %q, got %q.", hmacSecret, key.Secret)
+		}
+	}
+
+	_, err := jcp.HMACKeyConfig{Env: env + "_UNSET"}.Key()
+	if !errors.Is(err, jcp.ErrInvalidConfig) {
+		t.Fatalf("Expected error %v, got %v.", jcp.ErrInvalidConfig, err)
+	}
+}
@@ -1,11 +1,15 @@
 package jcp
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
@@ -13,99 +17,511 @@ import (
 )
 
 const (
+	// ContentTypeForm is the HTTP header value for Content-Type for URL encoded forms.
+	ContentTypeForm = "application/x-www-form-urlencoded"
 	// ContentTypeJSON is the HTTP header value for Content-Type for JSON.
 	ContentTypeJSON = "application/json"
+	// HeaderAuthorization is the HTTP header for Authorization.
+	HeaderAuthorization = "Authorization"
+	// HeaderCacheControl is the HTTP header for Cache-Control.
+	HeaderCacheControl = "Cache-Control"
 	// HeaderContentType is the HTTP header for Content-Type.
 	HeaderContentType = "Content-Type"
+	// HeaderDPoP is the HTTP header for a DPoP proof.
+	HeaderDPoP = "DPoP"
+	// HeaderETag is the HTTP header for ETag.
+	HeaderETag = "ETag"
+	// HeaderForwardedHost is the HTTP header a reverse proxy forwards the original host in.
+	HeaderForwardedHost = "X-Forwarded-Host"
+	// HeaderForwardedMethod is the HTTP header a reverse proxy forwards the original HTTP method in.
+	HeaderForwardedMethod = "X-Forwarded-Method"
+	// HeaderForwardedProto is the HTTP header a reverse proxy forwards the original scheme in.
+	HeaderForwardedProto = "X-Forwarded-Proto"
+	// HeaderForwardedURI is the HTTP header a reverse proxy forwards the original request URI in.
+	HeaderForwardedURI = "X-Forwarded-Uri"
+	// HeaderIfNoneMatch is the HTTP header for If-None-Match.
+	HeaderIfNoneMatch = "If-None-Match"
+	bearerPrefix      = "Bearer "
+	cacheNoStore      = "no-store"
+	dpopPrefix        = "DPoP "
 	logReqUUID        = "reqUUID"
+	queryIssuer       = "iss"
+	queryPolicy       = "policy"
 )
 
 // HTTPHandler is the HTTP handler for the Proxy.
 type HTTPHandler struct {
+	AdminToken string
+	// ClientCertHeader is the HTTP header the ForwardAuth handler reads the client certificate from. When empty, client
+	// certificates are not read. The header must only be set by a trusted reverse proxy.
+	ClientCertHeader string
+	Denylist         *Denylist
+	// Exchanger mints internal tokens for the token exchange handler.
+	Exchanger *Exchanger
+	// JWKSMaxAge is the duration clients may cache the JWK Set handler's response for. DefaultJWKSMaxAge is used when
+	// zero.
+	JWKSMaxAge      time.Duration
 	Logger          *zap.Logger
 	Proxy           Proxy
 	RequestMaxBytes int64
 }
 
+// validationFailures are errors caused by the token or the validation arguments, as opposed to an internal failure.
+var validationFailures = []error{
+	ErrAZP,
+	ErrAuthTime,
+	ErrCertificateBinding,
+	ErrClaimCheck,
+	ErrDelegation,
+	ErrDPoP,
+	ErrEventType,
+	ErrExpression,
+	ErrJWE,
+	ErrKubernetes,
+	ErrNonce,
+	ErrPipeline,
+	ErrProfile,
+	ErrReplay,
+	ErrRevoked,
+	ErrSPIFFE,
+	ErrTokenHash,
+	ErrTokenLifetime,
+	ErrUnknownPolicy,
+	ErrUnknownProfile,
+}
+
 // Validate creates an HTTP handler for the associated Proxy method.
-//
-// If more HTTP handlers are added:
-// * Use a middleware for HTTP request metadata method, content type, body limiting, etc.
 func (h HTTPHandler) Validate() http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		ctx := request.Context()
 
-		reqUUID, err := uuid.NewRandom()
-		if err != nil {
-			h.errorResponse(http.StatusInternalServerError, err, "Failed to generate UUID.", RequestMeta{}, writer)
+		reqMeta, ok := h.requestMeta(writer)
+		if !ok {
 			return
 		}
-		reqMeta := RequestMeta{
-			UUID: reqUUID,
-		}
 
 		if request.Method != http.MethodPost {
-			h.errorResponse(http.StatusMethodNotAllowed, err, "Incorrect HTTP method.", reqMeta, writer)
+			h.errorResponse(http.StatusMethodNotAllowed, nil, "Incorrect HTTP method.", reqMeta, writer)
 			return
 		}
 
-		contentType := request.Header.Get(HeaderContentType)
-		if contentType != ContentTypeJSON {
-			h.errorResponse(http.StatusBadRequest, err, fmt.Sprintf("Incorrect %s. Expected %s.", HeaderContentType, ContentTypeJSON), reqMeta, writer)
+		var req ValidateRequest
+		if !h.readJSON(writer, request, reqMeta, &req) {
 			return
 		}
 
-		readCloser := http.MaxBytesReader(writer, request.Body, h.RequestMaxBytes)
-		//goland:noinspection GoUnhandledErrorResult
-		defer readCloser.Close()
-
-		body, err := io.ReadAll(readCloser)
+		results, err := h.Proxy.Validate(ctx, req.Args)
 		if err != nil {
-			h.errorResponse(http.StatusRequestEntityTooLarge, nil, "Failed to read ", reqMeta, writer)
+			if isValidationFailure(err) {
+				msg := fmt.Sprintf("Failed to validate token: %v.", err)
+				h.errorResponse(http.StatusBadRequest, err, msg, reqMeta, writer)
+				return
+			}
+			h.errorResponse(http.StatusInternalServerError, err, "Failed to perform verification.", reqMeta, writer)
 			return
 		}
 
-		var req ValidateRequest
-		err = json.Unmarshal(body, &req)
-		if err != nil {
-			h.errorResponse(http.StatusBadRequest, nil, "", reqMeta, writer)
+		resp := ValidateResponse{
+			Results: results,
+			Meta:    reqMeta,
+		}
+		if !h.writeJSON(writer, reqMeta, resp) {
 			return
 		}
 
-		results, err := h.Proxy.Validate(ctx, req.Args)
+		h.Logger.Info("Successfully verified token.", zap.String(logReqUUID, reqMeta.UUID.String()))
+	})
+}
+
+// ForwardAuth creates an HTTP handler for reverse proxies that authenticate requests by forwarding them, such as
+// Traefik's ForwardAuth, NGINX's auth_request, and Envoy's ext_authz. The token is read from the Authorization header
+// with the Bearer or DPoP scheme. A DPoP proof is read from the DPoP header and checked against the forwarded HTTP
+// method and URI. The client certificate is read from ClientCertHeader. A policy can be selected with the policy query
+// parameter. A 200 status code allows the request and a 401 status code denies it.
+func (h HTTPHandler) ForwardAuth() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := request.Context()
+
+		reqMeta, ok := h.requestMeta(writer)
+		if !ok {
+			return
+		}
+
+		authorization := request.Header.Get(HeaderAuthorization)
+		args := ValidateArgs{
+			Policy: request.URL.Query().Get(queryPolicy),
+		}
+		switch {
+		case strings.HasPrefix(authorization, bearerPrefix):
+			args.Token = strings.TrimPrefix(authorization, bearerPrefix)
+		case strings.HasPrefix(authorization, dpopPrefix):
+			args.Token = strings.TrimPrefix(authorization, dpopPrefix)
+		}
+		if args.Token == "" {
+			h.errorResponse(http.StatusUnauthorized, nil, "Missing bearer token.", reqMeta, writer)
+			return
+		}
+		if proof := request.Header.Get(HeaderDPoP); proof != "" {
+			args.DPoP = proof
+			args.HTM = request.Header.Get(HeaderForwardedMethod)
+			args.HTU = request.Header.Get(HeaderForwardedProto) + "://" + request.Header.Get(HeaderForwardedHost) + request.Header.Get(HeaderForwardedURI)
+		}
+		if h.ClientCertHeader != "" {
+			if value := request.Header.Get(h.ClientCertHeader); value != "" {
+				var err error
+				args.ClientCert, err = forwardedClientCert(value)
+				if err != nil {
+					h.errorResponse(http.StatusUnauthorized, err, fmt.Sprintf("Failed to read client certificate: %v.", err), reqMeta, writer)
+					return
+				}
+			}
+		}
+
+		results, err := h.Proxy.Validate(ctx, args)
 		if err != nil {
-			var jwtErr *jwt.ValidationError
-			if errors.As(err, &jwtErr) || errors.Is(err, ErrClaimCheck) {
+			if isValidationFailure(err) {
 				msg := fmt.Sprintf("Failed to validate token: %v.", err)
-				h.errorResponse(http.StatusBadRequest, err, msg, reqMeta, writer)
+				h.errorResponse(http.StatusUnauthorized, err, msg, reqMeta, writer)
 				return
 			}
 			h.errorResponse(http.StatusInternalServerError, err, "Failed to perform verification.", reqMeta, writer)
 			return
 		}
 
-		resp := ValidateResponse{
+		if !h.writeJSON(writer, reqMeta, ValidateResponse{
 			Results: results,
 			Meta:    reqMeta,
+		}) {
+			return
+		}
+
+		h.Logger.Info("Successfully verified forwarded token.", zap.String(logReqUUID, reqMeta.UUID.String()))
+	})
+}
+
+// Exchange creates an HTTP handler for token exchange in the style of RFC 8693. The URL encoded form must have the
+// token exchange `grant_type`, a `subject_token` of a JWT token type, and optionally the requested `audience`. The
+// subject token is validated with the Exchanger's policy before an internal token is minted. Errors use the format of
+// RFC 6749 Section 5.2.
+func (h HTTPHandler) Exchange() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := request.Context()
+
+		reqMeta, ok := h.requestMeta(writer)
+		if !ok {
+			return
+		}
+
+		if h.Exchanger == nil {
+			h.errorResponse(http.StatusNotFound, nil, "No token exchange configured.", reqMeta, writer)
+			return
+		}
+		if request.Method != http.MethodPost {
+			h.exchangeError(http.StatusMethodNotAllowed, nil, "invalid_request", "Incorrect HTTP method.", reqMeta, writer)
+			return
+		}
+		mediaType, _, _ := mime.ParseMediaType(request.Header.Get(HeaderContentType))
+		if mediaType != ContentTypeForm {
+			h.exchangeError(http.StatusBadRequest, nil, "invalid_request", fmt.Sprintf("Incorrect %s. Expected %s.", HeaderContentType, ContentTypeForm), reqMeta, writer)
+			return
+		}
+		request.Body = http.MaxBytesReader(writer, request.Body, h.RequestMaxBytes)
+		err := request.ParseForm()
+		if err != nil {
+			h.exchangeError(http.StatusBadRequest, err, "invalid_request", "Failed to parse request body.", reqMeta, writer)
+			return
+		}
+		if grantType := request.PostForm.Get("grant_type"); grantType != GrantTypeTokenExchange {
+			h.exchangeError(http.StatusBadRequest, nil, "unsupported_grant_type", fmt.Sprintf("Unsupported grant type %q.", grantType), reqMeta, writer)
+			return
+		}
+		args := ExchangeArgs{
+			Audience:         request.PostForm["audience"],
+			SubjectToken:     request.PostForm.Get("subject_token"),
+			SubjectTokenType: request.PostForm.Get("subject_token_type"),
+		}
+		if args.SubjectToken == "" {
+			h.exchangeError(http.StatusBadRequest, nil, "invalid_request", "Missing subject token.", reqMeta, writer)
+			return
+		}
+
+		results, err := h.Exchanger.Exchange(ctx, args)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrExchangeTarget):
+				h.exchangeError(http.StatusBadRequest, err, "invalid_target", fmt.Sprintf("Failed to exchange token: %v.", err), reqMeta, writer)
+			case errors.Is(err, ErrExchange) || isValidationFailure(err):
+				h.exchangeError(http.StatusBadRequest, err, "invalid_request", fmt.Sprintf("Failed to exchange token: %v.", err), reqMeta, writer)
+			default:
+				h.exchangeError(http.StatusInternalServerError, err, "server_error", "Failed to exchange token.", reqMeta, writer)
+			}
+			return
+		}
+
+		writer.Header().Set(HeaderCacheControl, cacheNoStore)
+		if !h.writeJSON(writer, reqMeta, results) {
+			return
+		}
+
+		h.Logger.Info("Successfully exchanged token.", zap.String(logReqUUID, reqMeta.UUID.String()))
+	})
+}
+
+// ExchangeJWKS creates an HTTP handler for the JWK Set of the Exchanger's signing keys.
+func (h HTTPHandler) ExchangeJWKS() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		reqMeta, ok := h.requestMeta(writer)
+		if !ok {
+			return
 		}
 
-		data, err := json.Marshal(resp)
+		if h.Exchanger == nil {
+			h.errorResponse(http.StatusNotFound, nil, "No token exchange configured.", reqMeta, writer)
+			return
+		}
+		if request.Method != http.MethodGet {
+			h.errorResponse(http.StatusMethodNotAllowed, nil, "Incorrect HTTP method.", reqMeta, writer)
+			return
+		}
+
+		jwks, err := h.Exchanger.JWKS(request.Context())
 		if err != nil {
-			h.errorResponse(http.StatusInternalServerError, nil, "Failed to JSON marshal response.", reqMeta, writer)
+			h.errorResponse(http.StatusInternalServerError, err, "Failed to get JWK Set.", reqMeta, writer)
 			return
 		}
 
 		writer.Header().Set(HeaderContentType, ContentTypeJSON)
-		_, err = writer.Write(data)
+		_, err = writer.Write(jwks)
 		if err != nil {
-			h.errorResponse(http.StatusInternalServerError, nil, "Failed to write response.", reqMeta, writer)
+			h.Logger.Error("Failed to write response.", zap.Error(err), zap.String(logReqUUID, reqMeta.UUID.String()))
+		}
+	})
+}
+
+// JWKS creates an HTTP handler for the JWK Set of the public keys the Proxy holds, so clients and other JCP instances
+// can use it as a mirror of the upstream JWK Sets. The iss query parameter selects the keys of the JWK Set held for
+// that issuer instead. Requests with a matching If-None-Match header get a 304 status code.
+func (h HTTPHandler) JWKS() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		reqMeta, ok := h.requestMeta(writer)
+		if !ok {
 			return
 		}
 
-		h.Logger.Info("Successfully verified token.", zap.String(logReqUUID, reqMeta.UUID.String()))
+		if request.Method != http.MethodGet {
+			h.errorResponse(http.StatusMethodNotAllowed, nil, "Incorrect HTTP method.", reqMeta, writer)
+			return
+		}
+		publisher, ok := h.Proxy.(jwksPublisher)
+		if !ok {
+			h.errorResponse(http.StatusNotFound, nil, "No JWK Set published.", reqMeta, writer)
+			return
+		}
+
+		jwks, err := publisher.publicJWKS(request.URL.Query().Get(queryIssuer))
+		if err != nil {
+			if errors.Is(err, ErrUntrustedIssuer) {
+				h.errorResponse(http.StatusNotFound, err, "No JWK Set for the issuer.", reqMeta, writer)
+				return
+			}
+			h.errorResponse(http.StatusInternalServerError, err, "Failed to get JWK Set.", reqMeta, writer)
+			return
+		}
+
+		maxAge := h.JWKSMaxAge
+		if maxAge == 0 {
+			maxAge = DefaultJWKSMaxAge
+		}
+		etag := `"` + checksum(jwks) + `"`
+		writer.Header().Set(HeaderCacheControl, fmt.Sprintf("public, max-age=%d", int64(maxAge/time.Second)))
+		writer.Header().Set(HeaderETag, etag)
+		if etagMatches(request.Header.Get(HeaderIfNoneMatch), etag) {
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writer.Header().Set(HeaderContentType, ContentTypeJSON)
+		_, err = writer.Write(jwks)
+		if err != nil {
+			h.Logger.Error("Failed to write response.", zap.Error(err), zap.String(logReqUUID, reqMeta.UUID.String()))
+		}
+	})
+}
+
+// Revocations creates an HTTP handler to manage the Denylist. Requests must carry the admin token as a bearer token.
+// GET lists the revocations, POST adds a revocation, and DELETE removes a revocation.
+func (h HTTPHandler) Revocations() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		reqMeta, ok := h.requestMeta(writer)
+		if !ok {
+			return
+		}
+
+		if !h.authorizedAdmin(request) {
+			h.errorResponse(http.StatusUnauthorized, nil, "Missing or incorrect admin token.", reqMeta, writer)
+			return
+		}
+		if h.Denylist == nil {
+			h.errorResponse(http.StatusNotFound, nil, "No denylist configured.", reqMeta, writer)
+			return
+		}
+
+		var results []Revocation
+		switch request.Method {
+		case http.MethodGet:
+			results = h.Denylist.Revocations()
+		case http.MethodPost:
+			var req RevocationRequest
+			if !h.readJSON(writer, request, reqMeta, &req) {
+				return
+			}
+			r, err := h.Denylist.Revoke(req.Args)
+			if err != nil {
+				if errors.Is(err, ErrInvalidRevocation) {
+					h.errorResponse(http.StatusBadRequest, err, fmt.Sprintf("Failed to add revocation: %v.", err), reqMeta, writer)
+					return
+				}
+				h.errorResponse(http.StatusInternalServerError, err, "Failed to add revocation.", reqMeta, writer)
+				return
+			}
+			results = []Revocation{r}
+			h.Logger.Info("Added revocation.", zap.String(logReqUUID, reqMeta.UUID.String()), zap.Any("revocation", r))
+		case http.MethodDelete:
+			var req RevocationRequest
+			if !h.readJSON(writer, request, reqMeta, &req) {
+				return
+			}
+			removed, err := h.Denylist.Remove(req.Args)
+			if err != nil {
+				h.errorResponse(http.StatusInternalServerError, err, "Failed to remove revocation.", reqMeta, writer)
+				return
+			}
+			if !removed {
+				h.errorResponse(http.StatusNotFound, nil, "Revocation not found.", reqMeta, writer)
+				return
+			}
+			results = []Revocation{req.Args}
+			h.Logger.Info("Removed revocation.", zap.String(logReqUUID, reqMeta.UUID.String()), zap.Any("revocation", req.Args))
+		default:
+			h.errorResponse(http.StatusMethodNotAllowed, nil, "Incorrect HTTP method.", reqMeta, writer)
+			return
+		}
+
+		h.writeJSON(writer, reqMeta, RevocationsResponse{
+			Meta:    reqMeta,
+			Results: results,
+		})
 	})
 }
 
+func (h HTTPHandler) authorizedAdmin(request *http.Request) bool {
+	if h.AdminToken == "" {
+		return false
+	}
+	expected := []byte(bearerPrefix + h.AdminToken)
+	actual := []byte(request.Header.Get(HeaderAuthorization))
+	return subtle.ConstantTimeCompare(expected, actual) == 1
+}
+
+// etagMatches reports whether the If-None-Match header matches the ETag using the weak comparison of RFC 9110 Section
+// 13.1.2.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func (h HTTPHandler) requestMeta(writer http.ResponseWriter) (RequestMeta, bool) {
+	reqUUID, err := uuid.NewRandom()
+	if err != nil {
+		h.errorResponse(http.StatusInternalServerError, err, "Failed to generate UUID.", RequestMeta{}, writer)
+		return RequestMeta{}, false
+	}
+	reqMeta := RequestMeta{
+		UUID: reqUUID,
+	}
+	return reqMeta, true
+}
+
+// readJSON reads the JSON request body into v. It writes an error response and returns false on failure.
+func (h HTTPHandler) readJSON(writer http.ResponseWriter, request *http.Request, reqMeta RequestMeta, v any) bool {
+	contentType := request.Header.Get(HeaderContentType)
+	if contentType != ContentTypeJSON {
+		h.errorResponse(http.StatusBadRequest, nil, fmt.Sprintf("Incorrect %s. Expected %s.", HeaderContentType, ContentTypeJSON), reqMeta, writer)
+		return false
+	}
+
+	readCloser := http.MaxBytesReader(writer, request.Body, h.RequestMaxBytes)
+	//goland:noinspection GoUnhandledErrorResult
+	defer readCloser.Close()
+
+	body, err := io.ReadAll(readCloser)
+	if err != nil {
+		h.errorResponse(http.StatusRequestEntityTooLarge, err, "Failed to read request body.", reqMeta, writer)
+		return false
+	}
+
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		h.errorResponse(http.StatusBadRequest, err, "Failed to JSON parse request body.", reqMeta, writer)
+		return false
+	}
+	return true
+}
+
+// writeJSON writes v as the JSON response body. It writes an error response and returns false on failure.
+func (h HTTPHandler) writeJSON(writer http.ResponseWriter, reqMeta RequestMeta, v any) bool {
+	data, err := json.Marshal(v)
+	if err != nil {
+		h.errorResponse(http.StatusInternalServerError, err, "Failed to JSON marshal response.", reqMeta, writer)
+		return false
+	}
+
+	writer.Header().Set(HeaderContentType, ContentTypeJSON)
+	_, err = writer.Write(data)
+	if err != nil {
+		h.Logger.Error("Failed to write response.", zap.Error(err), zap.String(logReqUUID, reqMeta.UUID.String()))
+		return false
+	}
+	return true
+}
+
+func isValidationFailure(err error) bool {
+	var jwtErr *jwt.ValidationError
+	if errors.As(err, &jwtErr) {
+		return true
+	}
+	for _, target := range validationFailures {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// exchangeError writes a token exchange error response in the format of RFC 6749 Section 5.2.
+func (h HTTPHandler) exchangeError(code int, err error, oauthErr, description string, meta RequestMeta, writer http.ResponseWriter) {
+	h.Logger.Info("Sending token exchange error response.", zap.String(logReqUUID, meta.UUID.String()), zap.Int("code", code), zap.String("message", description), zap.Error(err))
+	writer.Header().Set(HeaderCacheControl, cacheNoStore)
+	writer.Header().Set(HeaderContentType, ContentTypeJSON)
+	writer.WriteHeader(code)
+	data, err := json.Marshal(ExchangeErrorResponse{
+		Error:            oauthErr,
+		ErrorDescription: description,
+	})
+	if err != nil {
+		h.Logger.Error("Failed to JSON to encode error response.", zap.Error(err), zap.String(logReqUUID, meta.UUID.String()))
+		data = []byte(`{"error":"server_error"}`)
+	}
+	_, err = writer.Write(data)
+	if err != nil {
+		h.Logger.Error("Failed to write error response.", zap.Error(err), zap.String(logReqUUID, meta.UUID.String()))
+	}
+}
+
 func (h HTTPHandler) errorResponse(code int, err error, message string, meta RequestMeta, writer http.ResponseWriter) {
 	h.Logger.Info("Sending error response.", zap.String(logReqUUID, meta.UUID.String()), zap.Int("code", code), zap.String("message", message), zap.Error(err))
 	writer.Header().Set(HeaderContentType, ContentTypeJSON)
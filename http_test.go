@@ -54,7 +54,7 @@ func TestProxy(t *testing.T) {
 	multiple := map[string]keyfunc.Options{
 		jwksServer.URL: {},
 	}
-	proxy, err := jcp.NewProxy(multiple, keyfunc.MultipleOptions{})
+	proxy, err := jcp.NewProxyWithOptions(multiple, jcp.ProxyOptions{})
 	if err != nil {
 		t.Fatalf("Failed to create proxy: %v.", err)
 	}
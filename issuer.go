@@ -0,0 +1,268 @@
+package jcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// DefaultIssuerIdleTimeout is the default duration after which a JWK Set for an issuer pattern is removed if unused.
+	DefaultIssuerIdleTimeout = 24 * time.Hour
+	// DefaultIssuerMaxEntries is the default maximum number of JWK Sets for issuer patterns held at once.
+	DefaultIssuerMaxEntries = 1000
+	discoveryPath           = "/.well-known/openid-configuration"
+)
+
+// ErrUntrustedIssuer is returned when a JWT's `iss` claim does not match any issuer pattern or its JWK Set can not be
+// found.
+var ErrUntrustedIssuer = errors.New("issuer is not trusted")
+
+// issuerPlaceholder matches the named placeholders of an issuer pattern, such as `{tenant}`.
+var issuerPlaceholder = regexp.MustCompile(`\{([A-Za-z0-9_]+)}`)
+
+// IssuerPattern is how the JWK Set of the issuers matching a pattern is found.
+type IssuerPattern struct {
+	// JWKSURL is a URL template for the JWK Set, such as `https://{tenant}.idp.example.com/keys`. The placeholders are
+	// replaced with their values from the issuer. OpenID Connect discovery is used when empty.
+	JWKSURL string `json:"jwksURL"`
+}
+
+// IssuersOptions are the options for verifying JWTs from issuers matching a pattern, such as
+// `https://{tenant}.idp.example.com/`. A placeholder matches letters, digits, hyphens, and underscores, so it can not
+// span a dot or a slash. JWTs from a matching issuer are only verified with its JWK Set. JWTs from issuers that do not
+// match a pattern fall through to the proxy's other key sources, such as its remote JWK Sets, and are rejected when
+// there are none.
+type IssuersOptions struct {
+	// Client is the HTTP client used for discovery and to get the JWK Sets.
+	Client *http.Client
+	// IdleTimeout is the duration after which an unused JWK Set is removed. DefaultIssuerIdleTimeout is used when zero.
+	IdleTimeout time.Duration
+	// MaxEntries is the maximum number of JWK Sets held at once. The least recently used JWK Set is removed when full.
+	// DefaultIssuerMaxEntries is used when zero.
+	MaxEntries int
+	// Patterns is a map of issuer patterns to how their JWK Sets are found.
+	Patterns map[string]IssuerPattern
+	// RefreshErrorHandler consumes errors that happen during a background refresh.
+	RefreshErrorHandler keyfunc.ErrorHandler
+	// RefreshInterval is the duration between background refreshes of each JWK Set.
+	RefreshInterval time.Duration
+	// RefreshTimeout is the timeout for discovery and fetching a JWK Set.
+	RefreshTimeout time.Duration
+}
+
+type issuerPattern struct {
+	issuer  *regexp.Regexp
+	jwksURL string
+	pattern string
+}
+
+// issuerKeySource lazily finds and fetches the JWK Sets of issuers matching a pattern and holds them in a least
+// recently used cache. Failed discovery and fetches are remembered for failureTTL.
+type issuerKeySource struct {
+	cache    *lru[*keyfunc.JWKS]
+	failures *failures
+	options  IssuersOptions
+	patterns []issuerPattern
+}
+
+func newIssuerKeySource(options IssuersOptions) (*issuerKeySource, error) {
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	if options.IdleTimeout == 0 {
+		options.IdleTimeout = DefaultIssuerIdleTimeout
+	}
+	if options.MaxEntries <= 0 {
+		options.MaxEntries = DefaultIssuerMaxEntries
+	}
+	if options.RefreshTimeout == 0 {
+		options.RefreshTimeout = defaultFetchTimeout
+	}
+	s := &issuerKeySource{
+		cache:    newLRU(options.MaxEntries, options.IdleTimeout, (*keyfunc.JWKS).EndBackground),
+		failures: newFailures(options.MaxEntries, failureTTL),
+		options:  options,
+	}
+	for pattern, p := range options.Patterns {
+		compiled, err := compileIssuerPattern(pattern, p.JWKSURL)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+		}
+		s.patterns = append(s.patterns, compiled)
+	}
+	sort.Slice(s.patterns, func(i, j int) bool {
+		return s.patterns[i].pattern < s.patterns[j].pattern
+	})
+	return s, nil
+}
+
+// Keyfunc helps implement the keyfuncer interface. JWTs from issuers that do not match a pattern are rejected without
+// any requests being made.
+func (s *issuerKeySource) Keyfunc(token *jwt.Token) (interface{}, error) {
+	iss := tokenIssuer(token)
+	p, values, ok := s.match(iss)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q does not match any issuer pattern", ErrUntrustedIssuer, iss)
+	}
+	jwks, err := s.get(p, iss, values)
+	if err != nil {
+		return nil, err
+	}
+	return jwks.Keyfunc(token)
+}
+
+// get returns the JWK Set for the issuer, fetching it when it is not held and did not recently fail to fetch.
+func (s *issuerKeySource) get(p issuerPattern, iss string, values []string) (*keyfunc.JWKS, error) {
+	err := s.failures.get(iss)
+	if err != nil {
+		return nil, err
+	}
+	return s.cache.get(iss, func() (*keyfunc.JWKS, error) {
+		jwks, err := s.fetch(p, iss, values)
+		if err != nil {
+			s.failures.add(iss, err)
+			return nil, err
+		}
+		return jwks, nil
+	})
+}
+
+// matches reports whether the JWT's issuer matches a pattern.
+func (s *issuerKeySource) matches(token *jwt.Token) bool {
+	_, _, ok := s.match(tokenIssuer(token))
+	return ok
+}
+
+// match returns the first pattern the issuer matches and the values of its placeholders.
+func (s *issuerKeySource) match(iss string) (issuerPattern, []string, bool) {
+	for _, p := range s.patterns {
+		values := p.issuer.FindStringSubmatch(iss)
+		if values != nil {
+			return p, values, true
+		}
+	}
+	return issuerPattern{}, nil, false
+}
+
+func (s *issuerKeySource) fetch(p issuerPattern, iss string, values []string) (*keyfunc.JWKS, error) {
+	var u string
+	if p.jwksURL != "" {
+		u = issuerPlaceholder.ReplaceAllStringFunc(p.jwksURL, func(placeholder string) string {
+			name := placeholder[1 : len(placeholder)-1]
+			return values[p.issuer.SubexpIndex(name)]
+		})
+	} else {
+		var err error
+		u, err = discover(s.options.Client, s.options.RefreshTimeout, iss)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrUntrustedIssuer, err)
+		}
+	}
+	jwks, err := keyfunc.Get(u, keyfunc.Options{
+		Client:              s.options.Client,
+		RefreshErrorHandler: s.options.RefreshErrorHandler,
+		RefreshInterval:     s.options.RefreshInterval,
+		RefreshTimeout:      s.options.RefreshTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get JWK Set %q for issuer %q: %s", ErrUntrustedIssuer, u, iss, err)
+	}
+	return jwks, nil
+}
+
+// discover returns the `jwks_uri` from the issuer's OpenID Connect discovery document. The document must be for the same
+// issuer, as required by OpenID Connect Discovery 1.0 Section 4.3.
+func discover(client *http.Client, timeout time.Duration, iss string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	data, err := fetch(ctx, client, strings.TrimSuffix(iss, "/")+discoveryPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get discovery document for issuer %q: %w", iss, err)
+	}
+	var metadata struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	err = json.Unmarshal(data, &metadata)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse discovery document for issuer %q: %w", iss, err)
+	}
+	if metadata.Issuer != iss {
+		return "", fmt.Errorf("discovery document is for issuer %q, not %q", metadata.Issuer, iss)
+	}
+	if metadata.JWKSURI == "" {
+		return "", fmt.Errorf("discovery document for issuer %q has no %q", iss, "jwks_uri")
+	}
+	return metadata.JWKSURI, nil
+}
+
+// compileIssuerPattern compiles an issuer pattern into an anchored regular expression with a named group for each
+// placeholder. The JWK Set URL template can only use placeholders from the issuer pattern.
+func compileIssuerPattern(pattern, jwksURL string) (issuerPattern, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	names := make(map[string]bool)
+	last := 0
+	for _, loc := range issuerPlaceholder.FindAllStringSubmatchIndex(pattern, -1) {
+		name := pattern[loc[2]:loc[3]]
+		if names[name] {
+			return issuerPattern{}, fmt.Errorf("issuer pattern %q repeats placeholder %q", pattern, name)
+		}
+		names[name] = true
+		expr.WriteString(regexp.QuoteMeta(pattern[last:loc[0]]))
+		expr.WriteString("(?P<" + name + ">[A-Za-z0-9_-]+)")
+		last = loc[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(pattern[last:]))
+	expr.WriteString("$")
+
+	err := validatePatternURL(pattern)
+	if err != nil {
+		return issuerPattern{}, fmt.Errorf("invalid issuer pattern %q: %s", pattern, err)
+	}
+	if jwksURL != "" {
+		err = validatePatternURL(jwksURL)
+		if err != nil {
+			return issuerPattern{}, fmt.Errorf("invalid JWK Set URL template %q: %s", jwksURL, err)
+		}
+		for _, match := range issuerPlaceholder.FindAllStringSubmatch(jwksURL, -1) {
+			if !names[match[1]] {
+				return issuerPattern{}, fmt.Errorf("JWK Set URL template %q uses placeholder %q, which is not in issuer pattern %q", jwksURL, match[1], pattern)
+			}
+		}
+	}
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return issuerPattern{}, fmt.Errorf("failed to compile issuer pattern %q: %s", pattern, err)
+	}
+	return issuerPattern{
+		issuer:  re,
+		jwksURL: jwksURL,
+		pattern: pattern,
+	}, nil
+}
+
+// validatePatternURL confirms the pattern is an HTTP or HTTPS URL with a host once its placeholders are filled in.
+func validatePatternURL(pattern string) error {
+	u, err := url.Parse(issuerPlaceholder.ReplaceAllString(pattern, "x"))
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("must be an HTTP or HTTPS URL with a host")
+	}
+	return nil
+}
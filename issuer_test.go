@@ -0,0 +1,191 @@
+package jcp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/MicahParks/jcp"
+)
+
+func TestProxy_IssuerPatterns(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := http.Get(jwksServer.URL)
+	if err != nil {
+		t.Fatalf("Failed to get JWK Set: %v.", err)
+	}
+	rawJWKS, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to read JWK Set: %v.", err)
+	}
+
+	var mux sync.Mutex
+	fetches := make(map[string]int)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		fetches[r.URL.Path]++
+		mux.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/.well-known/openid-configuration") {
+			iss := server.URL + strings.TrimSuffix(r.URL.Path, "/.well-known/openid-configuration")
+			if strings.HasSuffix(iss, "/impostor") {
+				iss = server.URL + "/discovery/other"
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"issuer":   iss,
+				"jwks_uri": server.URL + "/keys",
+			})
+			return
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer server.Close()
+	fetched := func(path string) int {
+		mux.Lock()
+		defer mux.Unlock()
+		return fetches[path]
+	}
+
+	proxy, err := jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+		Issuers: jcp.IssuersOptions{
+			IdleTimeout: 100 * time.Millisecond,
+			Patterns: map[string]jcp.IssuerPattern{
+				server.URL + "/discovery/{tenant}": {},
+				server.URL + "/template/{tenant}":  {JWKSURL: server.URL + "/jwks/{tenant}.json"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	sign := func(iss string) string {
+		j := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"iss": iss})
+		j.Header[headerKID] = testKID
+		token, err := j.SignedString(privateKey)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return token
+	}
+
+	testCases := []struct {
+		err   error
+		name  string
+		token string
+	}{
+		{
+			name:  "Discovery",
+			token: sign(server.URL + "/discovery/a"),
+		},
+		{
+			name:  "Template",
+			token: sign(server.URL + "/template/a"),
+		},
+		{
+			err:   jcp.ErrUntrustedIssuer,
+			name:  "DiscoveryIssuerMismatch",
+			token: sign(server.URL + "/discovery/impostor"),
+		},
+		{
+			err:   jcp.ErrUntrustedIssuer,
+			name:  "DiscoveryFailureCached",
+			token: sign(server.URL + "/discovery/impostor"),
+		},
+		{
+			err:   jcp.ErrUntrustedIssuer,
+			name:  "Unmatched",
+			token: sign(server.URL + "/other/a"),
+		},
+		{
+			err:   jcp.ErrUntrustedIssuer,
+			name:  "PlaceholderSpansSlash",
+			token: sign(server.URL + "/template/a/b"),
+		},
+		{
+			err:   jcp.ErrUntrustedIssuer,
+			name:  "NoIssuer",
+			token: sign(""),
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := proxy.Validate(ctx, jcp.ValidateArgs{Token: tc.token})
+			if err != nil || tc.err != nil {
+				if errors.Is(err, tc.err) {
+					return
+				}
+				t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+			}
+		})
+	}
+	if n := fetched("/jwks/a.json"); n != 1 {
+		t.Fatalf("Expected the templated JWK Set to be fetched once, got %d.", n)
+	}
+	if n := fetched("/discovery/impostor/.well-known/openid-configuration"); n != 1 {
+		t.Fatalf("Expected a failed discovery to be fetched once, got %d.", n)
+	}
+	if n := fetched("/other/a/.well-known/openid-configuration"); n != 0 {
+		t.Fatalf("Expected an unmatched issuer to not be fetched, got %d.", n)
+	}
+
+	_, err = proxy.Validate(ctx, jcp.ValidateArgs{Token: sign(server.URL + "/template/a")})
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v.", err)
+	}
+	if n := fetched("/jwks/a.json"); n != 1 {
+		t.Fatalf("Expected the templated JWK Set to be cached, got %d fetches.", n)
+	}
+	time.Sleep(200 * time.Millisecond)
+	_, err = proxy.Validate(ctx, jcp.ValidateArgs{Token: sign(server.URL + "/template/a")})
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v.", err)
+	}
+	if n := fetched("/jwks/a.json"); n != 2 {
+		t.Fatalf("Expected the idle JWK Set to be fetched again, got %d fetches.", n)
+	}
+
+	mixed, err := jcp.NewProxyWithOptions(map[string]keyfunc.Options{jwksServer.URL: {}}, jcp.ProxyOptions{
+		Issuers: jcp.IssuersOptions{
+			Patterns: map[string]jcp.IssuerPattern{
+				server.URL + "/discovery/{tenant}": {},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+	_, err = mixed.Validate(ctx, jcp.ValidateArgs{Token: sign(anyNonEmptyString)})
+	if err != nil {
+		t.Fatalf("Expected an unmatched issuer to use the other key sources, got error %v.", err)
+	}
+	_, err = mixed.Validate(ctx, jcp.ValidateArgs{Token: sign(server.URL + "/discovery/impostor")})
+	if !errors.Is(err, jcp.ErrUntrustedIssuer) {
+		t.Fatalf("Expected a matching issuer to not use the other key sources, got error %v.", err)
+	}
+
+	for _, patterns := range []map[string]jcp.IssuerPattern{
+		{"{tenant}.idp.example.com": {}},
+		{"https://{tenant}.idp.example.com/": {JWKSURL: "https://{region}.keys.example.com/{tenant}"}},
+		{"https://{tenant}.{tenant}.example.com/": {}},
+	} {
+		_, err = jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{Issuers: jcp.IssuersOptions{Patterns: patterns}})
+		if !errors.Is(err, jcp.ErrInvalidConfig) {
+			t.Fatalf("Expected error %v for patterns %v, got error %v.", jcp.ErrInvalidConfig, patterns, err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package jcp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// DefaultJKUMaxEntries is the default maximum number of JWK Sets from `jku` headers held at once.
+	DefaultJKUMaxEntries = 100
+	headerJKU            = "jku"
+)
+
+var (
+	// ErrJKU is returned when a JWT's `jku` header is not allowed or its JWK Set can not be fetched.
+	ErrJKU = errors.New("jku header rejected")
+	// errPrivateAddress is returned when a `jku` URL resolves to a private, loopback, or link-local address.
+	errPrivateAddress = errors.New("refusing to connect to a private address")
+)
+
+// JKUPrefix is the configuration for a URL prefix `jku` headers may start with.
+type JKUPrefix struct {
+	// Issuers is the set of `iss` claim values JWTs with a `jku` header starting with this prefix may have. A JWT from
+	// any other issuer is rejected, so a JWK Set from this prefix can not be used to sign JWTs for issuers that have
+	// their own keys. Required.
+	Issuers []string `json:"issuers"`
+}
+
+// JKUOptions are the options for verifying JWTs with the JWK Set their `jku` header points to. Only URLs starting with
+// one of the allowed prefixes are fetched.
+type JKUOptions struct {
+	// AllowPrivate allows fetching JWK Sets from private, loopback, and link-local addresses.
+	AllowPrivate bool
+	// MaxEntries is the maximum number of JWK Sets held at once. The least recently used JWK Set is removed when full.
+	// DefaultJKUMaxEntries is used when zero.
+	MaxEntries int
+	// Prefixes map the URL prefixes a `jku` header must start with, such as `https://partner.example.com/tenants/`, to
+	// the issuers bound to them. The `jku` header is ignored when empty.
+	Prefixes map[string]JKUPrefix
+	// RefreshErrorHandler consumes errors that happen during a background refresh.
+	RefreshErrorHandler keyfunc.ErrorHandler
+	// RefreshInterval is the duration between background refreshes of each JWK Set.
+	RefreshInterval time.Duration
+	// RefreshTimeout is the timeout for fetching a JWK Set.
+	RefreshTimeout time.Duration
+}
+
+// jkuKeySource lazily fetches the JWK Sets of allowed `jku` URLs and holds them in a least recently used cache. Failed
+// fetches are remembered for failureTTL.
+type jkuKeySource struct {
+	cache    *lru[*keyfunc.JWKS]
+	client   *http.Client
+	failures *failures
+	options  JKUOptions
+}
+
+func newJKUKeySource(options JKUOptions) (*jkuKeySource, error) {
+	for prefix, p := range options.Prefixes {
+		err := validateJKUPrefix(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+		}
+		if len(p.Issuers) == 0 {
+			return nil, fmt.Errorf("%w: no issuers for jku prefix %q", ErrInvalidConfig, prefix)
+		}
+	}
+	if options.MaxEntries <= 0 {
+		options.MaxEntries = DefaultJKUMaxEntries
+	}
+	if options.RefreshTimeout == 0 {
+		options.RefreshTimeout = defaultFetchTimeout
+	}
+	return &jkuKeySource{
+		cache:    newLRU(options.MaxEntries, 0, (*keyfunc.JWKS).EndBackground),
+		client:   jkuClient(options.AllowPrivate),
+		failures: newFailures(options.MaxEntries, failureTTL),
+		options:  options,
+	}, nil
+}
+
+// Keyfunc helps implement the keyfuncer interface.
+func (j *jkuKeySource) Keyfunc(token *jwt.Token) (interface{}, error) {
+	u, _ := token.Header[headerJKU].(string)
+	if !j.allowed(u, tokenIssuer(token)) {
+		return nil, fmt.Errorf("%w: %q is not allowed for issuer %q", ErrJKU, u, tokenIssuer(token))
+	}
+	jwks, err := j.get(u)
+	if err != nil {
+		return nil, err
+	}
+	return jwks.Keyfunc(token)
+}
+
+// allowed reports whether the URL is in canonical form and starts with a prefix the issuer is bound to. Requiring the
+// canonical form prevents a prefix from matching a different host or path than it appears to.
+func (j *jkuKeySource) allowed(u, iss string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.String() != u || parsed.User != nil || parsed.Fragment != "" {
+		return false
+	}
+	for _, segment := range strings.Split(parsed.Path, "/") {
+		if segment == "." || segment == ".." {
+			return false
+		}
+	}
+	for prefix, p := range j.options.Prefixes {
+		if strings.HasPrefix(u, prefix) && contains(p.Issuers, iss) {
+			return true
+		}
+	}
+	return false
+}
+
+// get returns the JWK Set for the URL, fetching it when it is not held and did not recently fail to fetch.
+func (j *jkuKeySource) get(u string) (*keyfunc.JWKS, error) {
+	err := j.failures.get(u)
+	if err != nil {
+		return nil, err
+	}
+	return j.cache.get(u, func() (*keyfunc.JWKS, error) {
+		jwks, err := keyfunc.Get(u, keyfunc.Options{
+			Client:              j.client,
+			RefreshErrorHandler: j.options.RefreshErrorHandler,
+			RefreshInterval:     j.options.RefreshInterval,
+			RefreshTimeout:      j.options.RefreshTimeout,
+		})
+		if err != nil {
+			err = fmt.Errorf("%w: failed to get JWK Set %q: %s", ErrJKU, u, err)
+			j.failures.add(u, err)
+			return nil, err
+		}
+		return jwks, nil
+	})
+}
+
+// hasJKU reports whether the JWT has a `jku` header.
+func hasJKU(token *jwt.Token) bool {
+	_, ok := token.Header[headerJKU]
+	return ok
+}
+
+// jkuClient creates the HTTP client for fetching JWK Sets from `jku` URLs. Redirects are not followed and environment
+// proxies are not used, so the address checked is the address connected to.
+func jkuClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+	}
+	if !allowPrivate {
+		dialer.Control = refusePrivate
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Transport: transport,
+	}
+}
+
+// refusePrivate is called after DNS resolution and before connecting, so DNS rebinding can not bypass it.
+func refusePrivate(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%w: %q", errPrivateAddress, host)
+	}
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s", errPrivateAddress, ip)
+	}
+	return nil
+}
+
+// validateJKUPrefix confirms the prefix includes the scheme, host, and the start of a path, so it can only match URLs
+// on that host.
+func validateJKUPrefix(prefix string) error {
+	u, err := url.Parse(prefix)
+	if err != nil {
+		return fmt.Errorf("failed to parse jku prefix %q: %s", prefix, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || !strings.HasPrefix(u.Path, "/") || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("jku prefix %q must be an HTTP or HTTPS URL with a host and a path", prefix)
+	}
+	return nil
+}
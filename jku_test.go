@@ -0,0 +1,215 @@
+package jcp_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/MicahParks/jcp"
+)
+
+const (
+	headerJKU = "jku"
+	jkuIssuer = "https://partner.example.com"
+)
+
+func TestProxy_JKU(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := http.Get(jwksServer.URL)
+	if err != nil {
+		t.Fatalf("Failed to get JWK Set: %v.", err)
+	}
+	rawJWKS, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to read JWK Set: %v.", err)
+	}
+
+	var mux sync.Mutex
+	fetches := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		fetches[r.URL.Path]++
+		mux.Unlock()
+		if strings.HasPrefix(r.URL.Path, "/redirect/") {
+			http.Redirect(w, r, jwksServer.URL, http.StatusFound)
+			return
+		}
+		if r.URL.Path == "/tenants/missing/jwks.json" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Path == "/tenants/symmetric/jwks.json" {
+			_, _ = fmt.Fprintf(w, `{"keys":[{"kty":"oct","kid":%q,"k":"c2VjcmV0"}]}`, testKID)
+			return
+		}
+		_, _ = w.Write(rawJWKS)
+	}))
+	defer server.Close()
+	fetched := func(path string) int {
+		mux.Lock()
+		defer mux.Unlock()
+		return fetches[path]
+	}
+
+	prefix := server.URL + "/tenants/"
+	proxy, err := jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+		JKU: jcp.JKUOptions{
+			AllowPrivate: true,
+			MaxEntries:   1,
+			Prefixes: map[string]jcp.JKUPrefix{
+				prefix:                    {Issuers: []string{jkuIssuer}},
+				server.URL + "/redirect/": {Issuers: []string{jkuIssuer}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	signWithIssuer := func(jku, iss string) string {
+		j := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.RegisteredClaims{Issuer: iss})
+		j.Header[headerKID] = testKID
+		j.Header[headerJKU] = jku
+		token, err := j.SignedString(privateKey)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return token
+	}
+	sign := func(jku string) string {
+		return signWithIssuer(jku, jkuIssuer)
+	}
+
+	testCases := []struct {
+		err   error
+		name  string
+		token string
+	}{
+		{
+			name:  "Allowed",
+			token: sign(prefix + "a/jwks.json"),
+		},
+		{
+			name:  "Cached",
+			token: sign(prefix + "a/jwks.json"),
+		},
+		{
+			name:  "Evicts",
+			token: sign(prefix + "b/jwks.json"),
+		},
+		{
+			name:  "Refetched",
+			token: sign(prefix + "a/jwks.json"),
+		},
+		{
+			err:   jcp.ErrJKU,
+			name:  "IssuerNotAllowed",
+			token: signWithIssuer(prefix+"a/jwks.json", anyOtherString),
+		},
+		{
+			err:   jcp.ErrJKU,
+			name:  "NotAllowed",
+			token: sign(server.URL + "/other/jwks.json"),
+		},
+		{
+			err:   jcp.ErrJKU,
+			name:  "DotSegment",
+			token: sign(prefix + "../other/jwks.json"),
+		},
+		{
+			err:   jcp.ErrJKU,
+			name:  "OtherHost",
+			token: sign(strings.Replace(prefix, "127.0.0.1", "127.0.0.1.example.com", 1) + "a/jwks.json"),
+		},
+		{
+			err:   jcp.ErrJKU,
+			name:  "Redirect",
+			token: sign(server.URL + "/redirect/jwks.json"),
+		},
+		{
+			err:   jcp.ErrJKU,
+			name:  "Empty",
+			token: sign(""),
+		},
+		{
+			err:   jcp.ErrJKU,
+			name:  "FetchFailed",
+			token: sign(prefix + "missing/jwks.json"),
+		},
+		{
+			err:   jcp.ErrJKU,
+			name:  "FetchFailedCached",
+			token: sign(prefix + "missing/jwks.json"),
+		},
+		{
+			err:   jcp.ErrAlgorithmConfusion,
+			name:  "Symmetric",
+			token: sign(prefix + "symmetric/jwks.json"),
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := proxy.Validate(ctx, jcp.ValidateArgs{Token: tc.token})
+			if err != nil || tc.err != nil {
+				if errors.Is(err, tc.err) {
+					return
+				}
+				t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+			}
+		})
+	}
+	if n := fetched("/tenants/a/jwks.json"); n != 2 {
+		t.Fatalf("Expected the evicted JWK Set to be fetched twice, got %d.", n)
+	}
+	if n := fetched("/other/jwks.json"); n != 0 {
+		t.Fatalf("Expected a JWK Set that is not allowed to not be fetched, got %d.", n)
+	}
+	if n := fetched("/tenants/missing/jwks.json"); n != 1 {
+		t.Fatalf("Expected a JWK Set that failed to be fetched once, got %d.", n)
+	}
+
+	private, err := jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+		JKU: jcp.JKUOptions{
+			Prefixes: map[string]jcp.JKUPrefix{
+				prefix: {Issuers: []string{jkuIssuer}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+	_, err = private.Validate(ctx, jcp.ValidateArgs{Token: sign(prefix + "c/jwks.json")})
+	if !errors.Is(err, jcp.ErrJKU) {
+		t.Fatalf("Expected error %v, got error %v.", jcp.ErrJKU, err)
+	}
+	if n := fetched("/tenants/c/jwks.json"); n != 0 {
+		t.Fatalf("Expected a private address to not be fetched, got %d.", n)
+	}
+
+	for _, prefixes := range []map[string]jcp.JKUPrefix{
+		{"https://partner.example.com": {Issuers: []string{jkuIssuer}}},
+		{prefix: {}},
+	} {
+		_, err = jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+			JKU: jcp.JKUOptions{
+				Prefixes: prefixes,
+			},
+		})
+		if !errors.Is(err, jcp.ErrInvalidConfig) {
+			t.Fatalf("Expected error %v, got error %v.", jcp.ErrInvalidConfig, err)
+		}
+	}
+}
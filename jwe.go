@@ -0,0 +1,174 @@
+package jcp
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-jose/go-jose/v3"
+)
+
+const (
+	headerEnc        = "enc"
+	pemECPrivateKey  = "EC PRIVATE KEY"
+	pemPrivateKey    = "PRIVATE KEY"
+	pemRSAPrivateKey = "RSA PRIVATE KEY"
+)
+
+var (
+	// ErrJWE is returned when an encrypted JWT can not be decrypted or is not allowed.
+	ErrJWE = errors.New("JWE decryption failed")
+
+	// DefaultJWEAlgorithms are the JWE key management algorithms allowed when none are configured. RSA1_5 is excluded
+	// as it is vulnerable to padding oracle attacks.
+	DefaultJWEAlgorithms = []string{
+		string(jose.ECDH_ES),
+		string(jose.ECDH_ES_A128KW),
+		string(jose.ECDH_ES_A192KW),
+		string(jose.ECDH_ES_A256KW),
+		string(jose.RSA_OAEP),
+		string(jose.RSA_OAEP_256),
+	}
+	// DefaultJWEEncryptions are the JWE content encryption algorithms allowed when none are configured.
+	DefaultJWEEncryptions = []string{
+		string(jose.A128CBC_HS256),
+		string(jose.A128GCM),
+		string(jose.A192CBC_HS384),
+		string(jose.A192GCM),
+		string(jose.A256CBC_HS512),
+		string(jose.A256GCM),
+	}
+)
+
+// JWEOptions are the options for decrypting JWTs encrypted as JWE compact serialization. The decrypted payload must be a
+// signed JWT, which is then validated as usual.
+type JWEOptions struct {
+	// Algorithms is the allow-list of JWE `alg` header values. DefaultJWEAlgorithms is used when empty.
+	Algorithms []string
+	// Encryptions is the allow-list of JWE `enc` header values. DefaultJWEEncryptions is used when empty.
+	Encryptions []string
+	// Keys is a map of key IDs to RSA or ECDSA private keys used for decryption.
+	Keys map[string]crypto.PrivateKey
+}
+
+// jweDecrypter decrypts nested JWTs.
+type jweDecrypter struct {
+	algorithms  []string
+	encryptions []string
+	kids        []string
+	keys        map[string]crypto.PrivateKey
+}
+
+func newJWEDecrypter(options JWEOptions) (*jweDecrypter, error) {
+	if len(options.Algorithms) == 0 {
+		options.Algorithms = DefaultJWEAlgorithms
+	}
+	if len(options.Encryptions) == 0 {
+		options.Encryptions = DefaultJWEEncryptions
+	}
+	for _, alg := range options.Algorithms {
+		if !contains(DefaultJWEAlgorithms, alg) {
+			return nil, fmt.Errorf("%w: unsupported JWE algorithm %q", ErrInvalidConfig, alg)
+		}
+	}
+	for _, enc := range options.Encryptions {
+		if !contains(DefaultJWEEncryptions, enc) {
+			return nil, fmt.Errorf("%w: unsupported JWE content encryption %q", ErrInvalidConfig, enc)
+		}
+	}
+	d := &jweDecrypter{
+		algorithms:  options.Algorithms,
+		encryptions: options.Encryptions,
+		keys:        make(map[string]crypto.PrivateKey, len(options.Keys)),
+	}
+	for kid, key := range options.Keys {
+		switch key.(type) {
+		case *ecdsa.PrivateKey, *rsa.PrivateKey:
+		default:
+			return nil, fmt.Errorf("%w: unsupported JWE decryption key type %T for key ID %q", ErrInvalidConfig, key, kid)
+		}
+		d.keys[kid] = key
+		d.kids = append(d.kids, kid)
+	}
+	sort.Strings(d.kids)
+	return d, nil
+}
+
+// decrypt decrypts the JWE and returns the nested JWT. The JWE's `alg` and `enc` headers must be allowed before any
+// decryption is attempted. A JWE without a `kid` header is only accepted when there is a single decryption key.
+func (d *jweDecrypter) decrypt(token string) (string, error) {
+	obj, err := jose.ParseEncrypted(token)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrJWE, err)
+	}
+	if !contains(d.algorithms, obj.Header.Algorithm) {
+		return "", fmt.Errorf("%w: algorithm %q is not allowed", ErrJWE, obj.Header.Algorithm)
+	}
+	enc, _ := obj.Header.ExtraHeaders[headerEnc].(string)
+	if !contains(d.encryptions, enc) {
+		return "", fmt.Errorf("%w: content encryption %q is not allowed", ErrJWE, enc)
+	}
+
+	kid := obj.Header.KeyID
+	if kid == "" {
+		if len(d.kids) != 1 {
+			return "", fmt.Errorf("%w: header %q is required with multiple decryption keys", ErrJWE, headerKID)
+		}
+		kid = d.kids[0]
+	}
+	key, ok := d.keys[kid]
+	if !ok {
+		return "", fmt.Errorf("%w: decryption key ID %q not found", ErrJWE, kid)
+	}
+	plaintext, err := obj.Decrypt(key)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrJWE, err)
+	}
+
+	nested := string(plaintext)
+	if strings.Count(nested, ".") != 2 {
+		return "", fmt.Errorf("%w: payload is not a signed JWT", ErrJWE)
+	}
+	return nested, nil
+}
+
+// parsePrivateKeyPEM parses an RSA or ECDSA private key in PKCS #8, PKCS #1, or SEC 1 PEM encoding.
+func parsePrivateKeyPEM(data []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	switch block.Type {
+	case pemPrivateKey:
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS #8 private key: %w", err)
+		}
+		return key, nil
+	case pemRSAPrivateKey:
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS #1 private key: %w", err)
+		}
+		return key, nil
+	case pemECPrivateKey:
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SEC 1 private key: %w", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+}
+
+// isJWE reports whether the token uses JWE compact serialization, which has five parts instead of three.
+func isJWE(token string) bool {
+	return strings.Count(token, ".") == 4
+}
@@ -0,0 +1,188 @@
+package jcp_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/MicahParks/jcp"
+)
+
+const (
+	ecJWEKID  = "ec-encryption-key"
+	rsaJWEKID = "rsa-encryption-key"
+)
+
+func TestProxy_JWE(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v.", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key: %v.", err)
+	}
+
+	// Load one of the keys from a PEM file like the configuration does.
+	der, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal RSA key: %v.", err)
+	}
+	loaded, err := jcp.JWEKeyConfig{
+		File: writeTemp(t, "jwe.pem", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	}.Key()
+	if err != nil {
+		t.Fatalf("Failed to load JWE key: %v.", err)
+	}
+
+	proxy, err := jcp.NewProxyWithOptions(map[string]keyfunc.Options{jwksServer.URL: {}}, jcp.ProxyOptions{
+		JWE: jcp.JWEOptions{
+			Algorithms:  []string{string(jose.ECDH_ES_A256KW), string(jose.RSA_OAEP_256)},
+			Encryptions: []string{string(jose.A256GCM)},
+			Keys: map[string]crypto.PrivateKey{
+				ecJWEKID:  ecKey,
+				rsaJWEKID: loaded,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	sign := func(key interface{}) string {
+		j := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"sub": anyNonEmptyString})
+		j.Header[headerKID] = testKID
+		token, err := j.SignedString(key)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return token
+	}
+	signed := sign(privateKey)
+	encrypt := func(alg jose.KeyAlgorithm, enc jose.ContentEncryption, key interface{}, kid, payload string) string {
+		encrypter, err := jose.NewEncrypter(enc, jose.Recipient{Algorithm: alg, Key: key, KeyID: kid}, (&jose.EncrypterOptions{}).WithContentType("JWT"))
+		if err != nil {
+			t.Fatalf("Failed to create encrypter: %v.", err)
+		}
+		obj, err := encrypter.Encrypt([]byte(payload))
+		if err != nil {
+			t.Fatalf("Failed to encrypt token: %v.", err)
+		}
+		token, err := obj.CompactSerialize()
+		if err != nil {
+			t.Fatalf("Failed to serialize token: %v.", err)
+		}
+		return token
+	}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key: %v.", err)
+	}
+	_, otherSigner, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v.", err)
+	}
+
+	testCases := []struct {
+		err   error
+		name  string
+		token string
+	}{
+		{
+			name:  "RSA",
+			token: encrypt(jose.RSA_OAEP_256, jose.A256GCM, &rsaKey.PublicKey, rsaJWEKID, signed),
+		},
+		{
+			name:  "ECDH",
+			token: encrypt(jose.ECDH_ES_A256KW, jose.A256GCM, &ecKey.PublicKey, ecJWEKID, signed),
+		},
+		{
+			err:   jcp.ErrJWE,
+			name:  "NoKID",
+			token: encrypt(jose.RSA_OAEP_256, jose.A256GCM, &rsaKey.PublicKey, "", signed),
+		},
+		{
+			err:   jcp.ErrJWE,
+			name:  "UnknownKID",
+			token: encrypt(jose.RSA_OAEP_256, jose.A256GCM, &rsaKey.PublicKey, anyNonEmptyString, signed),
+		},
+		{
+			err:   jcp.ErrJWE,
+			name:  "WrongKey",
+			token: encrypt(jose.ECDH_ES_A256KW, jose.A256GCM, &otherKey.PublicKey, ecJWEKID, signed),
+		},
+		{
+			err:   jcp.ErrJWE,
+			name:  "AlgorithmNotAllowed",
+			token: encrypt(jose.RSA_OAEP, jose.A256GCM, &rsaKey.PublicKey, rsaJWEKID, signed),
+		},
+		{
+			err:   jcp.ErrJWE,
+			name:  "RSA1_5",
+			token: encrypt(jose.RSA1_5, jose.A256GCM, &rsaKey.PublicKey, rsaJWEKID, signed),
+		},
+		{
+			err:   jcp.ErrJWE,
+			name:  "EncryptionNotAllowed",
+			token: encrypt(jose.RSA_OAEP_256, jose.A128CBC_HS256, &rsaKey.PublicKey, rsaJWEKID, signed),
+		},
+		{
+			err:   jcp.ErrJWE,
+			name:  "NotNested",
+			token: encrypt(jose.RSA_OAEP_256, jose.A256GCM, &rsaKey.PublicKey, rsaJWEKID, `{"sub":"unsigned"}`),
+		},
+		{
+			err:   jwt.ErrEd25519Verification,
+			name:  "NestedBadSignature",
+			token: encrypt(jose.RSA_OAEP_256, jose.A256GCM, &rsaKey.PublicKey, rsaJWEKID, sign(otherSigner)),
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := proxy.Validate(ctx, jcp.ValidateArgs{Token: tc.token})
+			if err != nil || tc.err != nil {
+				if errors.Is(err, tc.err) {
+					return
+				}
+				t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+			}
+		})
+	}
+
+	noJWE, err := jcp.NewProxyWithOptions(map[string]keyfunc.Options{jwksServer.URL: {}}, jcp.ProxyOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+	_, err = noJWE.Validate(ctx, jcp.ValidateArgs{Token: encrypt(jose.RSA_OAEP_256, jose.A256GCM, &rsaKey.PublicKey, rsaJWEKID, signed)})
+	if !errors.Is(err, jcp.ErrJWE) {
+		t.Fatalf("Expected error %v, got error %v.", jcp.ErrJWE, err)
+	}
+
+	_, err = jcp.NewProxyWithOptions(map[string]keyfunc.Options{jwksServer.URL: {}}, jcp.ProxyOptions{
+		JWE: jcp.JWEOptions{
+			Algorithms: []string{string(jose.RSA1_5)},
+			Keys:       map[string]crypto.PrivateKey{rsaJWEKID: rsaKey},
+		},
+	})
+	if !errors.Is(err, jcp.ErrInvalidConfig) {
+		t.Fatalf("Expected error %v, got error %v.", jcp.ErrInvalidConfig, err)
+	}
+}
@@ -0,0 +1,144 @@
+package jcp
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const (
+	ktyEC  = "EC"
+	ktyOKP = "OKP"
+	ktyOct = "oct"
+	ktyRSA = "RSA"
+)
+
+// ErrInvalidJWK is returned when a JWK is malformed or is not a public key.
+var ErrInvalidJWK = errors.New("invalid JWK")
+
+// privateJWKMembers are the JWK members that only appear in private keys.
+var privateJWKMembers = []string{"d", "dp", "dq", "k", "oth", "p", "q", "qi"}
+
+// jwk is a public JSON Web Key as defined in RFC 7517.
+type jwk struct {
+	Crv string `json:"crv"`
+	E   string `json:"e"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parsePublicJWK parses a public JWK, such as one embedded in a JWT header, into its cryptographic key and its RFC 7638
+// thumbprint.
+func parsePublicJWK(raw interface{}) (public interface{}, thumbprint string, err error) {
+	members, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, "", fmt.Errorf("%w: not a JSON object", ErrInvalidJWK)
+	}
+	for _, member := range privateJWKMembers {
+		if _, ok = members[member]; ok {
+			return nil, "", fmt.Errorf("%w: contains private member %q", ErrInvalidJWK, member)
+		}
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrInvalidJWK, err)
+	}
+	var k jwk
+	err = json.Unmarshal(data, &k)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrInvalidJWK, err)
+	}
+
+	// The required members for each key type in lexicographic order as defined in RFC 7638 Section 3.2.
+	var required interface{}
+	switch k.Kty {
+	case ktyEC:
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, "", fmt.Errorf("%w: unsupported curve %q", ErrInvalidJWK, k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, "", err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, "", err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, "", fmt.Errorf("%w: point is not on curve", ErrInvalidJWK)
+		}
+		public = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		required = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{k.Crv, k.Kty, k.X, k.Y}
+	case ktyOKP:
+		if k.Crv != "Ed25519" {
+			return nil, "", fmt.Errorf("%w: unsupported curve %q", ErrInvalidJWK, k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, "", fmt.Errorf("%w: invalid Ed25519 public key", ErrInvalidJWK)
+		}
+		public = ed25519.PublicKey(x)
+		required = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{k.Crv, k.Kty, k.X}
+	case ktyRSA:
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, "", err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, "", err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, "", fmt.Errorf("%w: RSA exponent too large", ErrInvalidJWK)
+		}
+		public = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		required = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.Kty, k.N}
+	default:
+		return nil, "", fmt.Errorf("%w: unsupported key type %q", ErrInvalidJWK, k.Kty)
+	}
+
+	canonical, err := json.Marshal(required)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrInvalidJWK, err)
+	}
+	sum := sha256.Sum256(canonical)
+	return public, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("%w: invalid base64url encoded integer", ErrInvalidJWK)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,122 @@
+package jcp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// DefaultKeyURLMaxEntries is the default maximum number of keys held at once for a key URL template.
+	DefaultKeyURLMaxEntries = 100
+	// DefaultKeyURLRefreshRateLimit is the default minimum duration between fetches of a key ID that failed to fetch.
+	DefaultKeyURLRefreshRateLimit = time.Minute
+	kidPlaceholder                = "{kid}"
+)
+
+// keyURLKID limits the key IDs put in a key URL, so a JWT can not change the path or host of the request.
+var keyURLKID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// KeyURLOptions are the options for a key source that publishes one PEM encoded public key per key ID, such as AWS
+// Application Load Balancers. The key URL is a template with a `{kid}` placeholder, such as
+// `https://public-keys.auth.elb.us-east-1.amazonaws.com/{kid}`.
+type KeyURLOptions struct {
+	// Client is the HTTP client used to get the keys via HTTP.
+	Client *http.Client
+	// MaxEntries is the maximum number of keys held at once. The least recently used key is removed when full.
+	// DefaultKeyURLMaxEntries is used when zero.
+	MaxEntries int
+	// RefreshRateLimit is the minimum duration between fetches of a key ID that failed to fetch, such as an unknown key
+	// ID. DefaultKeyURLRefreshRateLimit is used when zero.
+	RefreshRateLimit time.Duration
+	// RefreshTimeout is the timeout for fetching a key.
+	RefreshTimeout time.Duration
+}
+
+// keyURLKeySource lazily fetches the key for each key ID and holds them in a least recently used cache. The key for a
+// key ID is not expected to change. Failed fetches are remembered for the refresh rate limit.
+type keyURLKeySource struct {
+	cache    *lru[interface{}]
+	failures *failures
+	options  KeyURLOptions
+	template string
+}
+
+func newKeyURLKeySource(template string, options KeyURLOptions) (*keyURLKeySource, error) {
+	err := validateKeyURLTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+	if IsFileURL(template) {
+		options.Client = fileClient
+	} else if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	if options.MaxEntries <= 0 {
+		options.MaxEntries = DefaultKeyURLMaxEntries
+	}
+	if options.RefreshRateLimit == 0 {
+		options.RefreshRateLimit = DefaultKeyURLRefreshRateLimit
+	}
+	if options.RefreshTimeout == 0 {
+		options.RefreshTimeout = defaultFetchTimeout
+	}
+	return &keyURLKeySource{
+		cache:    newLRU[interface{}](options.MaxEntries, 0, nil),
+		failures: newFailures(options.MaxEntries, options.RefreshRateLimit),
+		options:  options,
+		template: template,
+	}, nil
+}
+
+// Keyfunc helps implement the keyfuncer interface.
+func (k *keyURLKeySource) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header[headerKID].(string)
+	if !keyURLKID.MatchString(kid) {
+		return nil, keyfunc.ErrKIDNotFound
+	}
+	err := k.failures.get(kid)
+	if err != nil {
+		return nil, err
+	}
+	return k.cache.get(kid, func() (interface{}, error) {
+		key, err := k.fetch(kid)
+		if err != nil {
+			k.failures.add(kid, err)
+			return nil, err
+		}
+		return key, nil
+	})
+}
+
+func (k *keyURLKeySource) fetch(kid string) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), k.options.RefreshTimeout)
+	defer cancel()
+
+	u := strings.ReplaceAll(k.template, kidPlaceholder, kid)
+	data, err := fetch(ctx, k.options.Client, u)
+	if err != nil {
+		// The key ID may belong to another key source.
+		return nil, fmt.Errorf("%w: failed to get key %q: %s", keyfunc.ErrKIDNotFound, u, err)
+	}
+	key, err := parsePEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key %q: %w", u, err)
+	}
+	return key.public, nil
+}
+
+// validateKeyURLTemplate confirms the template is a valid key source URL with a `{kid}` placeholder.
+func validateKeyURLTemplate(template string) error {
+	if !strings.Contains(template, kidPlaceholder) {
+		return fmt.Errorf("key URL template has no %q placeholder: %q: %w", kidPlaceholder, template, ErrInvalidConfig)
+	}
+	_, err := validateKeyURL(strings.ReplaceAll(template, kidPlaceholder, "kid"))
+	return err
+}
@@ -0,0 +1,145 @@
+package jcp_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/MicahParks/jcp"
+)
+
+const albKID = "4d3c2b1a-0000-4000-8000-000000000000"
+
+func TestProxy_KeyURL(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v.", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v.", err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	var mux sync.Mutex
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		fetches++
+		mux.Unlock()
+		if r.URL.Path != "/keys/"+albKID {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(publicPEM)
+	}))
+	defer server.Close()
+	fetched := func() int {
+		mux.Lock()
+		defer mux.Unlock()
+		return fetches
+	}
+
+	proxy, err := jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+		KeyURLs: map[string]jcp.KeyURLOptions{
+			server.URL + "/keys/{kid}": {},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	sign := func(kid string, private *ecdsa.PrivateKey) string {
+		j := jwt.New(jwt.SigningMethodES256)
+		j.Header[headerKID] = kid
+		token, err := j.SignedString(private)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return token
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v.", err)
+	}
+
+	testCases := []struct {
+		err     error
+		fetches int
+		name    string
+		token   string
+	}{
+		{
+			fetches: 1,
+			name:    "Valid",
+			token:   sign(albKID, private),
+		},
+		{
+			fetches: 1,
+			name:    "Cached",
+			token:   sign(albKID, private),
+		},
+		{
+			err:     jwt.ErrECDSAVerification,
+			fetches: 1,
+			name:    "WrongKey",
+			token:   sign(albKID, other),
+		},
+		{
+			err:     keyfunc.ErrKIDNotFound,
+			fetches: 2,
+			name:    "UnknownKID",
+			token:   sign("unknown-kid", private),
+		},
+		{
+			err:     keyfunc.ErrKIDNotFound,
+			fetches: 2,
+			name:    "UnknownKIDRateLimited",
+			token:   sign("unknown-kid", private),
+		},
+		{
+			err:     keyfunc.ErrKIDNotFound,
+			fetches: 2,
+			name:    "PathInKID",
+			token:   sign("../"+albKID, private),
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := proxy.Validate(ctx, jcp.ValidateArgs{Token: tc.token})
+			if err != nil || tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+				}
+			}
+			if n := fetched(); n != tc.fetches {
+				t.Fatalf("Expected %d fetches, got %d.", tc.fetches, n)
+			}
+		})
+	}
+
+	_, err = jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+		KeyURLs: map[string]jcp.KeyURLOptions{
+			server.URL + "/keys/": {},
+		},
+	})
+	if !errors.Is(err, jcp.ErrInvalidConfig) {
+		t.Fatalf("Expected error %v, got error %v.", jcp.ErrInvalidConfig, err)
+	}
+}
@@ -0,0 +1,191 @@
+package jcp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// ProfileKubernetes is the validation profile for projected Kubernetes service account tokens.
+	ProfileKubernetes   = "kubernetes"
+	kubernetesClaim     = "kubernetes.io"
+	serviceAccountClaim = "serviceaccount"
+	serviceAccountSub   = "system:serviceaccount:"
+)
+
+// ErrKubernetes is returned when a Kubernetes service account token's namespace, service account, or pod binding does
+// not match the requirements.
+var ErrKubernetes = errors.New("kubernetes service account check failed")
+
+// KubernetesClaims are the `kubernetes.io` claims of a projected Kubernetes service account token.
+type KubernetesClaims struct {
+	Namespace      string            `json:"namespace"`
+	Node           *KubernetesObject `json:"node,omitempty"`
+	Pod            *KubernetesObject `json:"pod,omitempty"`
+	Secret         *KubernetesObject `json:"secret,omitempty"`
+	ServiceAccount KubernetesObject  `json:"serviceaccount"`
+	WarnAfter      *jwt.NumericDate  `json:"warnafter,omitempty"`
+}
+
+// KubernetesObject is a Kubernetes object a service account token is bound to.
+type KubernetesObject struct {
+	Name string `json:"name"`
+	UID  string `json:"uid"`
+}
+
+// KubernetesOptions are the options for verifying the service account tokens of a Kubernetes cluster.
+type KubernetesOptions struct {
+	// BearerTokenFile is the path of a bearer token sent when fetching the discovery document and JWK Set from the
+	// issuer's host, such as the pod's own service account token. It is read for each request, so a rotated token is
+	// picked up automatically.
+	BearerTokenFile string
+	// Client is the HTTP client used to get the discovery document and JWK Set via HTTP.
+	Client *http.Client
+	// JWKSURL is the URL of the cluster's JWK Set, such as a mounted file. OpenID Connect discovery is used when empty.
+	JWKSURL string
+	// RefreshErrorHandler consumes errors that happen during a background refresh.
+	RefreshErrorHandler keyfunc.ErrorHandler
+	// RefreshInterval is the duration between background refreshes of the JWK Set.
+	RefreshInterval time.Duration
+	// RefreshTimeout is the timeout for fetching the discovery document and JWK Set.
+	RefreshTimeout time.Duration
+}
+
+// newKubernetesJWKS gets the JWK Set of the cluster with the issuer.
+func newKubernetesJWKS(iss string, options KubernetesOptions) (*keyfunc.JWKS, error) {
+	err := validatePatternURL(iss)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid Kubernetes issuer %q: %s", ErrInvalidConfig, iss, err)
+	}
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	if options.BearerTokenFile != "" {
+		transport := options.Client.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		parsed, err := url.Parse(iss)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to parse Kubernetes issuer %q: %s", ErrInvalidConfig, iss, err)
+		}
+		client := *options.Client
+		client.Transport = bearerTransport{
+			base: transport,
+			file: options.BearerTokenFile,
+			host: parsed.Host,
+		}
+		options.Client = &client
+	}
+	if options.RefreshTimeout == 0 {
+		options.RefreshTimeout = defaultFetchTimeout
+	}
+
+	u := options.JWKSURL
+	if u == "" {
+		u, err = discover(options.Client, options.RefreshTimeout, iss)
+		if err != nil {
+			return nil, err
+		}
+	} else if IsFileURL(u) {
+		options.Client = fileClient
+	}
+	jwks, err := keyfunc.Get(u, keyfunc.Options{
+		Client:              options.Client,
+		RefreshErrorHandler: options.RefreshErrorHandler,
+		RefreshInterval:     options.RefreshInterval,
+		RefreshTimeout:      options.RefreshTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get JWK Set %q for Kubernetes issuer %q: %w", u, iss, err)
+	}
+	return jwks, nil
+}
+
+// bearerTransport adds the bearer token in a file to each request to the host. The token is not sent to other hosts,
+// such as a `jwks_uri` on a public bucket.
+type bearerTransport struct {
+	base http.RoundTripper
+	file string
+	host string
+}
+
+// RoundTrip helps implement the http.RoundTripper interface.
+func (b bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != b.host {
+		return b.base.RoundTrip(req)
+	}
+	token, err := os.ReadFile(b.file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bearer token file: %w", err)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+string(bytes.TrimSpace(token)))
+	return b.base.RoundTrip(req)
+}
+
+// checkKubernetesIssuer confirms a JWT validated with the kubernetes profile is from a configured Kubernetes cluster
+// and was verified with that cluster's JWK Set, so a JWT from another key source can not claim to be a service account
+// token. It also confirms a JWT verified with a cluster's JWK Set is validated with the kubernetes profile.
+func (p proxy) checkKubernetesIssuer(profileName string, source keySource, claims *tokenClaims) error {
+	fromCluster := p.kubernetes[claims.Issuer] && source == keySourceIssuer
+	if profileName == ProfileKubernetes && !fromCluster {
+		return fmt.Errorf("%w: claim %q must be a Kubernetes issuer whose JWK Set verified the token", ErrKubernetes, issClaim)
+	}
+	if profileName != ProfileKubernetes && fromCluster {
+		return fmt.Errorf("%w: tokens from the Kubernetes issuer %q require the %q profile", ErrKubernetes, claims.Issuer, ProfileKubernetes)
+	}
+	return nil
+}
+
+// checkKubernetes confirms the JWT is a projected Kubernetes service account token. Legacy service account tokens
+// stored in secrets do not have the `kubernetes.io` claim, so they are rejected. The namespace and service account
+// name must be in each non-empty set given by the request and its policy.
+func checkKubernetes(args ValidateArgs, policy Policy, _ *jwt.Token, claims *tokenClaims) error {
+	if len(args.Aud) == 0 && len(policy.Aud) == 0 {
+		return fmt.Errorf("%w: the %q of the workload must be given", ErrProfile, audClaim)
+	}
+	required := map[string]bool{
+		audClaim:        len(claims.Audience) != 0,
+		expClaim:        claims.ExpiresAt != nil,
+		iatClaim:        claims.IssuedAt != nil,
+		issClaim:        claims.Issuer != "",
+		kubernetesClaim: claims.Kubernetes != nil,
+		subClaim:        claims.Subject != "",
+	}
+	for _, claim := range []string{audClaim, expClaim, iatClaim, issClaim, kubernetesClaim, subClaim} {
+		if !required[claim] {
+			return fmt.Errorf("%w: claim %q is required", ErrProfile, claim)
+		}
+	}
+	k := claims.Kubernetes
+	if k.Namespace == "" || k.ServiceAccount.Name == "" || k.ServiceAccount.UID == "" {
+		return fmt.Errorf("%w: claim %q must have a namespace and %q name and uid", ErrProfile, kubernetesClaim, serviceAccountClaim)
+	}
+	if sub := serviceAccountSub + k.Namespace + ":" + k.ServiceAccount.Name; claims.Subject != sub {
+		return fmt.Errorf("%w: claim %q must be %q", ErrProfile, subClaim, sub)
+	}
+
+	for _, namespaces := range [][]string{args.Namespaces, policy.Namespaces} {
+		if len(namespaces) != 0 && !contains(namespaces, k.Namespace) {
+			return fmt.Errorf("%w: namespace %q is not allowed", ErrKubernetes, k.Namespace)
+		}
+	}
+	for _, serviceAccounts := range [][]string{args.ServiceAccounts, policy.ServiceAccounts} {
+		if len(serviceAccounts) != 0 && !contains(serviceAccounts, k.ServiceAccount.Name) {
+			return fmt.Errorf("%w: service account %q is not allowed", ErrKubernetes, k.ServiceAccount.Name)
+		}
+	}
+	if (args.RequirePod || policy.RequirePod) && (k.Pod == nil || k.Pod.Name == "" || k.Pod.UID == "") {
+		return fmt.Errorf("%w: token is not bound to a pod", ErrKubernetes)
+	}
+	return nil
+}
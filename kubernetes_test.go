@@ -0,0 +1,252 @@
+package jcp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/MicahParks/jcp"
+)
+
+const (
+	kubernetesAud        = "https://checkout.payments.svc"
+	kubernetesBearer     = "jcp-service-account-token"
+	kubernetesNamespace  = "payments"
+	kubernetesPolicy     = "checkout"
+	kubernetesPodPolicy  = "pod"
+	kubernetesOtherSpace = "billing"
+
+	// kubernetesFixture is the claim set of a projected service account token recorded from a kind cluster. The `exp`,
+	// `iat`, `iss`, and `nbf` claims are replaced by the test.
+	kubernetesFixture = `{
+  "aud": ["https://checkout.payments.svc"],
+  "exp": 1700003600,
+  "iat": 1700000000,
+  "iss": "https://kubernetes.default.svc.cluster.local",
+  "jti": "0b3a4f9e-5d6c-4c1b-9a8e-7f2d1c0b9a8e",
+  "kubernetes.io": {
+    "namespace": "payments",
+    "node": {
+      "name": "kind-worker",
+      "uid": "8f1c2d3e-4b5a-4978-8a6b-5c4d3e2f1a0b"
+    },
+    "pod": {
+      "name": "checkout-7c9d8b6f5-x2k4q",
+      "uid": "2e4c6a8b-0d1f-4e3a-9c5b-7d9f1b3e5a7c"
+    },
+    "serviceaccount": {
+      "name": "checkout",
+      "uid": "6a5b4c3d-2e1f-4a0b-8c9d-0e1f2a3b4c5d"
+    },
+    "warnafter": 1700000607
+  },
+  "nbf": 1700000000,
+  "sub": "system:serviceaccount:payments:checkout"
+}`
+)
+
+func TestProxy_KubernetesProfile(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	resp, err := http.Get(jwksServer.URL)
+	if err != nil {
+		t.Fatalf("Failed to get JWK Set: %v.", err)
+	}
+	rawJWKS, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to read JWK Set: %v.", err)
+	}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+kubernetesBearer {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_, _ = fmt.Fprintf(w, `{"issuer":%q,"jwks_uri":%q}`, server.URL, server.URL+"/openid/v1/jwks")
+		case "/openid/v1/jwks":
+			_, _ = w.Write(rawJWKS)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	policies := map[string]jcp.Policy{
+		kubernetesPolicy: {
+			Aud:             []string{kubernetesAud},
+			Namespaces:      []string{kubernetesNamespace},
+			Profile:         jcp.ProfileKubernetes,
+			ServiceAccounts: []string{kubernetesPolicy},
+		},
+		kubernetesPodPolicy: {
+			Aud:        []string{kubernetesAud},
+			Profile:    jcp.ProfileKubernetes,
+			RequirePod: true,
+		},
+		"plain": {
+			Aud: []string{kubernetesAud},
+		},
+	}
+	proxy, err := jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+		Inline: map[string]json.RawMessage{
+			anyNonEmptyString: rawJWKS,
+		},
+		Kubernetes: map[string]jcp.KubernetesOptions{
+			server.URL: {BearerTokenFile: writeTemp(t, "token", []byte(kubernetesBearer+"\n"))},
+		},
+		Policies: policies,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	_, err = jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+		Kubernetes: map[string]jcp.KubernetesOptions{
+			server.URL: {},
+		},
+	})
+	if err == nil {
+		t.Fatalf("Expected discovery without a bearer token to fail.")
+	}
+
+	sign := func(edit func(claims jwt.MapClaims)) string {
+		claims := jwt.MapClaims{}
+		err := json.Unmarshal([]byte(kubernetesFixture), &claims)
+		if err != nil {
+			t.Fatalf("Failed to parse fixture: %v.", err)
+		}
+		now := time.Now()
+		claims["exp"] = now.Add(time.Hour).Unix()
+		claims["iat"] = now.Unix()
+		claims["iss"] = server.URL
+		claims["nbf"] = now.Unix()
+		if edit != nil {
+			edit(claims)
+		}
+		j := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		j.Header[headerKID] = testKID
+		token, err := j.SignedString(privateKey)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return token
+	}
+	kubernetes := func(claims jwt.MapClaims) map[string]interface{} {
+		return claims["kubernetes.io"].(map[string]interface{})
+	}
+
+	testCases := []struct {
+		args jcp.ValidateArgs
+		err  error
+		name string
+	}{
+		{
+			args: jcp.ValidateArgs{Policy: kubernetesPolicy, Token: sign(nil)},
+			name: "Valid",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: kubernetesPodPolicy, Token: sign(nil)},
+			name: "PodBound",
+		},
+		{
+			args: jcp.ValidateArgs{Aud: []string{kubernetesAud}, Namespaces: []string{kubernetesOtherSpace}, Profile: jcp.ProfileKubernetes, Token: sign(nil)},
+			err:  jcp.ErrKubernetes,
+			name: "RequestNamespace",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: kubernetesPolicy, Token: sign(func(claims jwt.MapClaims) {
+				kubernetes(claims)["namespace"] = kubernetesOtherSpace
+				claims["sub"] = "system:serviceaccount:" + kubernetesOtherSpace + ":checkout"
+			})},
+			err:  jcp.ErrKubernetes,
+			name: "PolicyNamespace",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: kubernetesPodPolicy, Token: sign(func(claims jwt.MapClaims) {
+				delete(kubernetes(claims), "pod")
+			})},
+			err:  jcp.ErrKubernetes,
+			name: "NotPodBound",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: kubernetesPolicy, Token: sign(func(claims jwt.MapClaims) {
+				claims["sub"] = "system:serviceaccount:payments:admin"
+			})},
+			err:  jcp.ErrProfile,
+			name: "SubjectMismatch",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: kubernetesPolicy, Token: sign(func(claims jwt.MapClaims) {
+				delete(claims, "kubernetes.io")
+				claims["kubernetes.io/serviceaccount/namespace"] = kubernetesNamespace
+				claims["kubernetes.io/serviceaccount/service-account.name"] = "checkout"
+			})},
+			err:  jcp.ErrProfile,
+			name: "LegacyToken",
+		},
+		{
+			args: jcp.ValidateArgs{Profile: jcp.ProfileKubernetes, Token: sign(nil)},
+			err:  jcp.ErrProfile,
+			name: "NoAudienceGiven",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: kubernetesPolicy, Token: sign(func(claims jwt.MapClaims) {
+				claims["iss"] = anyNonEmptyString
+			})},
+			err:  jcp.ErrKubernetes,
+			name: "OtherIssuer",
+		},
+		{
+			args: jcp.ValidateArgs{Aud: []string{kubernetesAud}, Token: sign(nil)},
+			err:  jcp.ErrKubernetes,
+			name: "NoProfile",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: "plain", Token: sign(nil)},
+			err:  jcp.ErrKubernetes,
+			name: "PlainPolicy",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := proxy.Validate(ctx, tc.args)
+			if err != nil || tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+				}
+				return
+			}
+			k := results.Kubernetes
+			if k == nil || k.Namespace != kubernetesNamespace || k.ServiceAccount.Name != kubernetesPolicy || k.Pod == nil || k.Pod.Name != "checkout-7c9d8b6f5-x2k4q" {
+				t.Fatalf("Unexpected Kubernetes claims in results: %+v.", k)
+			}
+		})
+	}
+
+	mounted, err := jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+		Kubernetes: map[string]jcp.KubernetesOptions{
+			server.URL: {JWKSURL: "file://" + writeTemp(t, "jwks.json", rawJWKS)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy with a mounted JWK Set: %v.", err)
+	}
+	_, err = mounted.Validate(ctx, jcp.ValidateArgs{Aud: []string{kubernetesAud}, Profile: jcp.ProfileKubernetes, Token: sign(nil)})
+	if err != nil {
+		t.Fatalf("Failed to validate token with a mounted JWK Set: %v.", err)
+	}
+}
@@ -0,0 +1,74 @@
+package jcp
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// EventBackChannelLogout is the event type of an OpenID Connect back-channel logout token.
+	EventBackChannelLogout = "http://schemas.openid.net/event/backchannel-logout"
+	// ProfileLogoutToken is the validation profile for logout tokens as defined in OpenID Connect Back-Channel Logout 1.0.
+	ProfileLogoutToken = "logoutToken"
+	eventsClaim        = "events"
+	typLogoutToken     = "logout+jwt"
+)
+
+// checkLogoutToken confirms the JWT is a logout token as defined in OpenID Connect Back-Channel Logout 1.0 Section 2.6.
+func checkLogoutToken(args ValidateArgs, policy Policy, token *jwt.Token, claims *tokenClaims) error {
+	if typ := mediaType(token); typ != typLogoutToken {
+		return fmt.Errorf("%w: header %q must be %q, got %q", ErrProfile, headerTyp, typLogoutToken, typ)
+	}
+	if len(args.Aud) == 0 && len(policy.Aud) == 0 {
+		return fmt.Errorf("%w: the %q of the relying party must be given", ErrProfile, audClaim)
+	}
+	required := map[string]bool{
+		audClaim: len(claims.Audience) != 0,
+		expClaim: claims.ExpiresAt != nil,
+		iatClaim: claims.IssuedAt != nil,
+		issClaim: claims.Issuer != "",
+		jtiClaim: claims.ID != "",
+	}
+	for _, claim := range []string{audClaim, expClaim, iatClaim, issClaim, jtiClaim} {
+		if !required[claim] {
+			return fmt.Errorf("%w: claim %q is required", ErrProfile, claim)
+		}
+	}
+	if claims.SID == "" && claims.Subject == "" {
+		return fmt.Errorf("%w: at least one of claims %q and %q is required", ErrProfile, "sid", subClaim)
+	}
+	if claims.Nonce != "" {
+		return fmt.Errorf("%w: claim %q is prohibited", ErrProfile, "nonce")
+	}
+	event, ok := claims.Events[EventBackChannelLogout]
+	if !ok {
+		return fmt.Errorf("%w: claim %q must contain %q", ErrProfile, eventsClaim, EventBackChannelLogout)
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(event), []byte("{")) {
+		return fmt.Errorf("%w: event %q must be a JSON object", ErrProfile, EventBackChannelLogout)
+	}
+	return nil
+}
+
+// revokeSession adds the session or subject of a validated logout token to the Denylist. Tokens for the session, or for
+// the subject when there is no session, issued before now are rejected afterwards.
+func (p proxy) revokeSession(claims *tokenClaims) error {
+	if p.denylist == nil {
+		return fmt.Errorf("%w: revoking sessions requires a denylist", ErrNoConfiguration)
+	}
+	r := Revocation{
+		Iss: claims.Issuer,
+	}
+	if claims.SID != "" {
+		r.SID = claims.SID
+	} else {
+		r.Sub = claims.Subject
+	}
+	_, err := p.denylist.Revoke(r)
+	if err != nil {
+		return fmt.Errorf("failed to revoke logged out session: %w", err)
+	}
+	return nil
+}
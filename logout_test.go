@@ -0,0 +1,172 @@
+package jcp_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/MicahParks/jcp"
+)
+
+const (
+	backChannelLogoutPolicy = "backChannelLogout"
+	testSID                 = "a session ID"
+)
+
+func TestProxy_LogoutTokenProfile(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	denylist, err := jcp.NewDenylist(jcp.DenylistOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create denylist: %v.", err)
+	}
+	proxy, err := jcp.NewProxyWithOptions(map[string]keyfunc.Options{jwksServer.URL: {}}, jcp.ProxyOptions{
+		Denylist: denylist,
+		Policies: map[string]jcp.Policy{
+			backChannelLogoutPolicy: {
+				Aud:            []string{anyNonEmptyString},
+				Profile:        jcp.ProfileLogoutToken,
+				RevokeSessions: true,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	// Tokens for the session are issued before the logout token is validated.
+	issued := time.Now().Add(-time.Second).Unix()
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"aud":    anyNonEmptyString,
+			"events": map[string]interface{}{jcp.EventBackChannelLogout: map[string]interface{}{}},
+			"exp":    time.Now().Add(time.Minute).Unix(),
+			"iat":    issued,
+			"iss":    anyOtherString,
+			"jti":    anyNonEmptyString,
+			"sid":    testSID,
+			"sub":    anyOtherString,
+		}
+	}
+	with := func(claim string, value interface{}) jwt.MapClaims {
+		c := claims()
+		if value == nil {
+			delete(c, claim)
+		} else {
+			c[claim] = value
+		}
+		return c
+	}
+	sign := func(typ string, claims jwt.MapClaims) string {
+		j := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		j.Header[headerKID] = testKID
+		j.Header["typ"] = typ
+		token, err := j.SignedString(privateKey)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return token
+	}
+	args := func(token string) jcp.ValidateArgs {
+		return jcp.ValidateArgs{Aud: []string{anyNonEmptyString}, Profile: jcp.ProfileLogoutToken, Token: token}
+	}
+	sessionToken := sign("JWT", jwt.MapClaims{"exp": time.Now().Add(time.Minute).Unix(), "iat": issued, "iss": anyOtherString, "sid": testSID})
+
+	testCases := []struct {
+		args jcp.ValidateArgs
+		err  error
+		name string
+	}{
+		{
+			args: args(sign("logout+jwt", claims())),
+			name: "Valid",
+		},
+		{
+			args: args(sign("logout+jwt", with("sid", nil))),
+			name: "SubOnly",
+		},
+		{
+			args: args(sign("logout+jwt", func() jwt.MapClaims {
+				c := with("sid", nil)
+				delete(c, "sub")
+				return c
+			}())),
+			err:  jcp.ErrProfile,
+			name: "NoSIDOrSub",
+		},
+		{
+			args: args(sign("JWT", claims())),
+			err:  jcp.ErrProfile,
+			name: "WrongTyp",
+		},
+		{
+			args: args(sign("logout+jwt", with("nonce", anyNonEmptyString))),
+			err:  jcp.ErrProfile,
+			name: "Nonce",
+		},
+		{
+			args: args(sign("logout+jwt", with("events", map[string]interface{}{anyNonEmptyString: map[string]interface{}{}}))),
+			err:  jcp.ErrProfile,
+			name: "NoLogoutEvent",
+		},
+		{
+			args: args(sign("logout+jwt", with("events", map[string]interface{}{jcp.EventBackChannelLogout: anyNonEmptyString}))),
+			err:  jcp.ErrProfile,
+			name: "LogoutEventNotObject",
+		},
+		{
+			args: args(sign("logout+jwt", with("jti", nil))),
+			err:  jcp.ErrProfile,
+			name: "NoJTI",
+		},
+		{
+			args: jcp.ValidateArgs{Profile: jcp.ProfileIDToken, Aud: []string{anyNonEmptyString}, Token: sign("logout+jwt", claims())},
+			err:  jcp.ErrProfile,
+			name: "LogoutTokenAsIDToken",
+		},
+		{
+			args: jcp.ValidateArgs{Token: sessionToken},
+			name: "SessionBeforeLogout",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: backChannelLogoutPolicy, Token: sign("logout+jwt", claims())},
+			name: "RevokeSession",
+		},
+		{
+			args: jcp.ValidateArgs{Token: sessionToken},
+			err:  jcp.ErrRevoked,
+			name: "SessionAfterLogout",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := proxy.Validate(ctx, tc.args)
+			if err != nil || tc.err != nil {
+				if errors.Is(err, tc.err) {
+					return
+				}
+				t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+			}
+		})
+	}
+
+	revocations := denylist.Revocations()
+	if len(revocations) != 1 || revocations[0].SID != testSID || revocations[0].Iss != anyOtherString {
+		t.Fatalf("Expected a single revocation for the session, got %v.", revocations)
+	}
+
+	_, err = jcp.NewProxyWithOptions(map[string]keyfunc.Options{jwksServer.URL: {}}, jcp.ProxyOptions{
+		Policies: map[string]jcp.Policy{
+			backChannelLogoutPolicy: {Profile: jcp.ProfileLogoutToken, RevokeSessions: true},
+		},
+	})
+	if !errors.Is(err, jcp.ErrInvalidConfig) {
+		t.Fatalf("Expected error %v, got error %v.", jcp.ErrInvalidConfig, err)
+	}
+}
@@ -0,0 +1,172 @@
+package jcp
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// failureTTL is the duration the error of a failed fetch is returned for before the key is fetched again.
+const failureTTL = time.Minute
+
+type lruEntry[V any] struct {
+	key      string
+	lastUsed time.Time
+	value    V
+}
+
+// lru holds lazily fetched values, such as JWK Sets. The least recently used value is removed when there are more than
+// maxEntries and values not used for idleTimeout are removed. onRemove, if not nil, is called with each removed value.
+type lru[V any] struct {
+	entries     map[string]*list.Element
+	idleTimeout time.Duration
+	maxEntries  int
+	mux         sync.Mutex
+	onRemove    func(V)
+	order       *list.List
+}
+
+func newLRU[V any](maxEntries int, idleTimeout time.Duration, onRemove func(V)) *lru[V] {
+	return &lru[V]{
+		entries:     make(map[string]*list.Element),
+		idleTimeout: idleTimeout,
+		maxEntries:  maxEntries,
+		onRemove:    onRemove,
+		order:       list.New(),
+	}
+}
+
+// get returns the value for the key, calling fetch when it is not held. fetch is called without holding the lock, so
+// a slow fetch does not block other keys.
+func (l *lru[V]) get(key string, fetch func() (V, error)) (V, error) {
+	now := time.Now()
+	l.mux.Lock()
+	l.expire(now)
+	if e, ok := l.entries[key]; ok {
+		value := l.use(e, now)
+		l.mux.Unlock()
+		return value, nil
+	}
+	l.mux.Unlock()
+
+	value, err := fetch()
+	if err != nil {
+		return value, err
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if e, ok := l.entries[key]; ok {
+		// Another request fetched the same key first.
+		if l.onRemove != nil {
+			l.onRemove(value)
+		}
+		return l.use(e, now), nil
+	}
+	l.entries[key] = l.order.PushFront(&lruEntry[V]{key: key, lastUsed: now, value: value})
+	for l.order.Len() > l.maxEntries {
+		l.remove(l.order.Back())
+	}
+	return value, nil
+}
+
+// expire removes the values not used for idleTimeout. The lock must be held.
+func (l *lru[V]) expire(now time.Time) {
+	if l.idleTimeout == 0 {
+		return
+	}
+	for e := l.order.Back(); e != nil && now.Sub(e.Value.(*lruEntry[V]).lastUsed) > l.idleTimeout; e = l.order.Back() {
+		l.remove(e)
+	}
+}
+
+// remove removes the element and calls onRemove with its value. The lock must be held.
+func (l *lru[V]) remove(e *list.Element) {
+	entry := l.order.Remove(e).(*lruEntry[V])
+	delete(l.entries, entry.key)
+	if l.onRemove != nil {
+		l.onRemove(entry.value)
+	}
+}
+
+// use marks the element as the most recently used. The lock must be held.
+func (l *lru[V]) use(e *list.Element, now time.Time) V {
+	entry := e.Value.(*lruEntry[V])
+	entry.lastUsed = now
+	l.order.MoveToFront(e)
+	return entry.value
+}
+
+// peek returns the held value for the key without marking it as used or fetching it.
+func (l *lru[V]) peek(key string) (V, bool) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.expire(time.Now())
+	e, ok := l.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return e.Value.(*lruEntry[V]).value, true
+}
+
+type failureEntry struct {
+	err     error
+	expires time.Time
+	key     string
+}
+
+// failures holds the errors of recently failed fetches, so a key that can not be fetched is not fetched again for
+// every JWT. The oldest error is removed when there are more than maxEntries and errors are removed after ttl.
+type failures struct {
+	entries    map[string]*list.Element
+	maxEntries int
+	mux        sync.Mutex
+	order      *list.List
+	ttl        time.Duration
+}
+
+func newFailures(maxEntries int, ttl time.Duration) *failures {
+	return &failures{
+		entries:    make(map[string]*list.Element),
+		maxEntries: maxEntries,
+		order:      list.New(),
+		ttl:        ttl,
+	}
+}
+
+// add records the error of a failed fetch for the key.
+func (f *failures) add(key string, err error) {
+	now := time.Now()
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.expire(now)
+	if e, ok := f.entries[key]; ok {
+		f.order.Remove(e)
+	}
+	f.entries[key] = f.order.PushFront(&failureEntry{err: err, expires: now.Add(f.ttl), key: key})
+	for f.order.Len() > f.maxEntries {
+		entry := f.order.Remove(f.order.Back()).(*failureEntry)
+		delete(f.entries, entry.key)
+	}
+}
+
+// get returns the error of a recently failed fetch for the key or nil.
+func (f *failures) get(key string) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.expire(time.Now())
+	e, ok := f.entries[key]
+	if !ok {
+		return nil
+	}
+	return e.Value.(*failureEntry).err
+}
+
+// expire removes the errors older than ttl. The lock must be held.
+func (f *failures) expire(now time.Time) {
+	for e := f.order.Back(); e != nil && !now.Before(e.Value.(*failureEntry).expires); e = f.order.Back() {
+		entry := f.order.Remove(e).(*failureEntry)
+		delete(f.entries, entry.key)
+	}
+}
@@ -0,0 +1,81 @@
+package jcp
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrCertificateBinding is returned when a certificate-bound JWT is not presented with its client certificate.
+var ErrCertificateBinding = errors.New("certificate-bound token validation failed")
+
+// checkCertificateBinding confirms the client certificate in the arguments matches the `cnf.x5t#S256` claim as defined
+// in RFC 8705. JWTs without the claim are not bound to a certificate and are not checked.
+func checkCertificateBinding(args ValidateArgs, claims *tokenClaims) error {
+	if claims.Cnf == nil || claims.Cnf.X5TS256 == "" {
+		return nil
+	}
+	if args.ClientCert == "" {
+		return fmt.Errorf("%w: access token is certificate bound but no client certificate was given", ErrCertificateBinding)
+	}
+	cert, err := parseClientCert(args.ClientCert)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrCertificateBinding, err)
+	}
+	_, x5tS256 := thumbprints(cert)
+	if x5tS256 != claims.Cnf.X5TS256 {
+		return fmt.Errorf("%w: client certificate does not match access token %q claim", ErrCertificateBinding, "cnf.x5t#S256")
+	}
+	return nil
+}
+
+// parseClientCert parses a client certificate given as PEM or as base64 encoded DER.
+func parseClientCert(s string) (*x509.Certificate, error) {
+	s = strings.TrimSpace(s)
+	var der []byte
+	if strings.HasPrefix(s, "-----BEGIN") {
+		block, _ := pem.Decode([]byte(s))
+		if block == nil || block.Type != pemCertificate {
+			return nil, errors.New("client certificate PEM block not found")
+		}
+		der = block.Bytes
+	} else {
+		var err error
+		der, err = base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			der, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+			if err != nil {
+				return nil, errors.New("client certificate is neither PEM nor base64 encoded DER")
+			}
+		}
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse client certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// forwardedClientCert extracts the client certificate from the value of a forwarded client certificate header. Both URL
+// encoded PEM, as sent by NGINX and Traefik, and the `Cert` element of Envoy's x-forwarded-client-cert format are
+// supported.
+func forwardedClientCert(value string) (string, error) {
+	const envoyCert = `Cert="`
+	if i := strings.Index(value, envoyCert); i != -1 {
+		value = value[i+len(envoyCert):]
+		end := strings.IndexByte(value, '"')
+		if end == -1 {
+			return "", fmt.Errorf("%w: unterminated %q element", ErrCertificateBinding, "Cert")
+		}
+		value = value[:end]
+	}
+	unescaped, err := url.PathUnescape(value)
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to URL decode forwarded client certificate: %s", ErrCertificateBinding, err)
+	}
+	return unescaped, nil
+}
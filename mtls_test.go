@@ -0,0 +1,185 @@
+package jcp_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+
+	"github.com/MicahParks/jcp"
+)
+
+const clientCertHeader = "X-Forwarded-Client-Cert"
+
+func TestProxy_CertificateBinding(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	proxy, err := jcp.NewProxyWithOptions(map[string]keyfunc.Options{jwksServer.URL: {}}, jcp.ProxyOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	client := createCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: anyNonEmptyString}}, nil)
+	other := createCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: anyOtherString}}, nil)
+	bound := signCertBound(t, client.der)
+	unbound := signCertBound(t, nil)
+
+	testCases := []struct {
+		args jcp.ValidateArgs
+		err  error
+		name string
+	}{
+		{
+			args: jcp.ValidateArgs{ClientCert: string(certPEM(client)), Token: bound},
+			name: "PEM",
+		},
+		{
+			args: jcp.ValidateArgs{ClientCert: base64.StdEncoding.EncodeToString(client.der), Token: bound},
+			name: "DER",
+		},
+		{
+			args: jcp.ValidateArgs{Token: bound},
+			err:  jcp.ErrCertificateBinding,
+			name: "NoClientCert",
+		},
+		{
+			args: jcp.ValidateArgs{ClientCert: string(certPEM(other)), Token: bound},
+			err:  jcp.ErrCertificateBinding,
+			name: "WrongClientCert",
+		},
+		{
+			args: jcp.ValidateArgs{ClientCert: anyNonEmptyString, Token: bound},
+			err:  jcp.ErrCertificateBinding,
+			name: "MalformedClientCert",
+		},
+		{
+			args: jcp.ValidateArgs{Token: unbound},
+			name: "Unbound",
+		},
+		{
+			args: jcp.ValidateArgs{ClientCert: string(certPEM(other)), Token: unbound},
+			name: "UnboundWithClientCert",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := proxy.Validate(ctx, tc.args)
+			if err != nil || tc.err != nil {
+				if errors.Is(err, tc.err) {
+					return
+				}
+				t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestHTTPHandler_ForwardAuth(t *testing.T) {
+	proxy, err := jcp.NewProxyWithOptions(map[string]keyfunc.Options{jwksServer.URL: {}}, jcp.ProxyOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+	handler := jcp.HTTPHandler{
+		ClientCertHeader: clientCertHeader,
+		Logger:           zap.NewNop(),
+		Proxy:            proxy,
+		RequestMaxBytes:  jcp.DefaultRequestMaxBytes,
+	}.ForwardAuth()
+
+	client := createCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: anyNonEmptyString}}, nil)
+	other := createCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: anyOtherString}}, nil)
+	bound := signCertBound(t, client.der)
+
+	testCases := []struct {
+		clientCert string
+		code       int
+		name       string
+		token      string
+	}{
+		{
+			clientCert: url.PathEscape(string(certPEM(client))),
+			code:       http.StatusOK,
+			name:       "EscapedPEM",
+			token:      bound,
+		},
+		{
+			clientCert: `Hash=abc;Cert="` + url.PathEscape(string(certPEM(client))) + `";Subject="CN=client"`,
+			code:       http.StatusOK,
+			name:       "Envoy",
+			token:      bound,
+		},
+		{
+			clientCert: base64.StdEncoding.EncodeToString(client.der),
+			code:       http.StatusOK,
+			name:       "DER",
+			token:      bound,
+		},
+		{
+			clientCert: url.PathEscape(string(certPEM(other))),
+			code:       http.StatusUnauthorized,
+			name:       "WrongClientCert",
+			token:      bound,
+		},
+		{
+			code:  http.StatusUnauthorized,
+			name:  "NoClientCert",
+			token: bound,
+		},
+		{
+			code: http.StatusUnauthorized,
+			name: "NoToken",
+		},
+		{
+			code:  http.StatusUnauthorized,
+			name:  "InvalidToken",
+			token: anyNonEmptyString,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/v1/forward-auth", nil)
+			if tc.token != "" {
+				request.Header.Set(jcp.HeaderAuthorization, "Bearer "+tc.token)
+			}
+			if tc.clientCert != "" {
+				request.Header.Set(clientCertHeader, tc.clientCert)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != tc.code {
+				t.Fatalf("Expected status code %d, got %d: %s.", tc.code, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func signCertBound(t *testing.T, der []byte) string {
+	claims := jwt.MapClaims{
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}
+	if der != nil {
+		sum := sha256.Sum256(der)
+		claims["cnf"] = map[string]string{"x5t#S256": base64.RawURLEncoding.EncodeToString(sum[:])}
+	}
+	j := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	j.Header[headerKID] = testKID
+	token, err := j.SignedString(privateKey)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v.", err)
+	}
+	return token
+}
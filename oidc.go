@@ -0,0 +1,121 @@
+package jcp
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ProfileIDToken is the validation profile for OpenID Connect ID tokens as defined in OpenID Connect Core 1.0.
+const ProfileIDToken = "idToken"
+
+var (
+	// ErrAuthTime is returned when an ID token's `auth_time` claim is missing or older than the maximum authentication
+	// age.
+	ErrAuthTime = errors.New("authentication is too old")
+	// ErrAZP is returned when an ID token's `azp` claim is missing or is not an accepted audience.
+	ErrAZP = errors.New("authorized party check failed")
+	// ErrNonce is returned when an ID token's `nonce` claim does not match the expected nonce.
+	ErrNonce = errors.New("nonce check failed")
+	// ErrTokenHash is returned when an ID token's `at_hash` or `c_hash` claim does not match the access token or
+	// authorization code.
+	ErrTokenHash = errors.New("token hash check failed")
+)
+
+// checkIDToken confirms the JWT is an ID token as defined in OpenID Connect Core 1.0 Section 3.1.3.7. The accepted
+// audiences are the client IDs of the relying party. When an access token or authorization code is given, the ID token
+// must have a matching `at_hash` or `c_hash` claim.
+func checkIDToken(args ValidateArgs, policy Policy, token *jwt.Token, claims *tokenClaims) error {
+	switch mediaType(token) {
+	case typAccessToken, typLogoutToken, typSecurityEvent:
+		return fmt.Errorf("%w: header %q of %q is not an ID token", ErrProfile, headerTyp, mediaType(token))
+	}
+	if claims.Events != nil {
+		return fmt.Errorf("%w: claim %q is prohibited", ErrProfile, eventsClaim)
+	}
+	clientIDs := append(append([]string{}, args.Aud...), policy.Aud...)
+	if len(clientIDs) == 0 {
+		return fmt.Errorf("%w: the %q of the relying party must be given", ErrProfile, audClaim)
+	}
+	required := map[string]bool{
+		audClaim: len(claims.Audience) != 0,
+		expClaim: claims.ExpiresAt != nil,
+		iatClaim: claims.IssuedAt != nil,
+		issClaim: claims.Issuer != "",
+		subClaim: claims.Subject != "",
+	}
+	for _, claim := range []string{audClaim, expClaim, iatClaim, issClaim, subClaim} {
+		if !required[claim] {
+			return fmt.Errorf("%w: claim %q is required", ErrProfile, claim)
+		}
+	}
+
+	if len(claims.Audience) > 1 && claims.Azp == "" {
+		return fmt.Errorf("%w: claim %q is required with multiple audiences", ErrAZP, "azp")
+	}
+	if claims.Azp != "" && !contains(clientIDs, claims.Azp) {
+		return fmt.Errorf("%w: %q is not an accepted client ID", ErrAZP, claims.Azp)
+	}
+
+	if args.Nonce != "" && subtle.ConstantTimeCompare([]byte(args.Nonce), []byte(claims.Nonce)) != 1 {
+		return fmt.Errorf("%w: claim %q does not match", ErrNonce, "nonce")
+	}
+
+	if args.MaxAge != nil {
+		if claims.AuthTime == nil {
+			return fmt.Errorf("%w: claim %q is required with a maximum authentication age", ErrAuthTime, "auth_time")
+		}
+		maxAge := time.Duration(*args.MaxAge) * time.Second
+		if time.Since(claims.AuthTime.Time) > maxAge {
+			return fmt.Errorf("%w: authenticated at %s, maximum age is %s", ErrAuthTime, claims.AuthTime.Time, maxAge)
+		}
+	}
+
+	if args.AccessToken != "" {
+		err := checkTokenHash(token.Method, "at_hash", claims.AtHash, args.AccessToken)
+		if err != nil {
+			return err
+		}
+	}
+	if args.Code != "" {
+		err := checkTokenHash(token.Method, "c_hash", claims.CHash, args.Code)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkTokenHash confirms the claim is the base64url encoded left-most half of the hash of the value. The hash algorithm
+// is the one used by the ID token's `alg`. For EdDSA, SHA-512 is used as Ed25519 is the only supported curve.
+func checkTokenHash(method jwt.SigningMethod, claim, expected, value string) error {
+	if expected == "" {
+		return fmt.Errorf("%w: claim %q is required", ErrTokenHash, claim)
+	}
+	var h hash.Hash
+	switch alg := method.Alg(); {
+	case alg == jwt.SigningMethodEdDSA.Alg(), strings.HasSuffix(alg, "512"):
+		h = sha512.New()
+	case strings.HasSuffix(alg, "384"):
+		h = sha512.New384()
+	case strings.HasSuffix(alg, "256"):
+		h = sha256.New()
+	default:
+		return fmt.Errorf("%w: unsupported alg %q for claim %q", ErrTokenHash, alg, claim)
+	}
+	h.Write([]byte(value))
+	sum := h.Sum(nil)
+	actual := base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+	if subtle.ConstantTimeCompare([]byte(actual), []byte(expected)) != 1 {
+		return fmt.Errorf("%w: claim %q does not match", ErrTokenHash, claim)
+	}
+	return nil
+}
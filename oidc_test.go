@@ -0,0 +1,187 @@
+package jcp_test
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/MicahParks/jcp"
+)
+
+const (
+	testAccessToken = "an access token"
+	testCode        = "an authorization code"
+	testNonce       = "a nonce"
+)
+
+func TestProxy_IDTokenProfile(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	proxy, err := jcp.NewProxyWithOptions(map[string]keyfunc.Options{jwksServer.URL: {}}, jcp.ProxyOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	// Ed25519 ID tokens use SHA-512 for at_hash and c_hash.
+	tokenHash := func(value string) string {
+		sum := sha512.Sum512([]byte(value))
+		return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+	}
+	now := time.Now()
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"at_hash":   tokenHash(testAccessToken),
+			"aud":       anyNonEmptyString,
+			"auth_time": now.Add(-time.Minute).Unix(),
+			"c_hash":    tokenHash(testCode),
+			"exp":       now.Add(time.Minute).Unix(),
+			"iat":       now.Unix(),
+			"iss":       anyOtherString,
+			"nonce":     testNonce,
+			"sub":       anyOtherString,
+		}
+	}
+	with := func(claim string, value interface{}) jwt.MapClaims {
+		c := claims()
+		if value == nil {
+			delete(c, claim)
+		} else {
+			c[claim] = value
+		}
+		return c
+	}
+	sign := func(typ string, claims jwt.MapClaims) string {
+		j := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		j.Header[headerKID] = testKID
+		if typ != "" {
+			j.Header["typ"] = typ
+		}
+		token, err := j.SignedString(privateKey)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return token
+	}
+	idToken := sign("JWT", claims())
+	args := func(token string) jcp.ValidateArgs {
+		return jcp.ValidateArgs{Aud: []string{anyNonEmptyString}, Profile: jcp.ProfileIDToken, Token: token}
+	}
+	withArgs := func(modify func(args *jcp.ValidateArgs)) jcp.ValidateArgs {
+		a := args(idToken)
+		modify(&a)
+		return a
+	}
+	maxAge := func(seconds int64) *int64 {
+		return &seconds
+	}
+
+	testCases := []struct {
+		args jcp.ValidateArgs
+		err  error
+		name string
+	}{
+		{
+			args: args(idToken),
+			name: "Valid",
+		},
+		{
+			args: withArgs(func(a *jcp.ValidateArgs) {
+				a.AccessToken = testAccessToken
+				a.Code = testCode
+				a.MaxAge = maxAge(3600)
+				a.Nonce = testNonce
+			}),
+			name: "AllChecks",
+		},
+		{
+			args: args(sign("at+jwt", claims())),
+			err:  jcp.ErrProfile,
+			name: "AccessToken",
+		},
+		{
+			args: withArgs(func(a *jcp.ValidateArgs) { a.Aud = nil }),
+			err:  jcp.ErrProfile,
+			name: "NoClientID",
+		},
+		{
+			args: args(sign("", with("sub", nil))),
+			err:  jcp.ErrProfile,
+			name: "NoSub",
+		},
+		{
+			args: args(sign("", with("aud", []string{anyNonEmptyString, anyOtherString}))),
+			err:  jcp.ErrAZP,
+			name: "MultipleAudiencesNoAZP",
+		},
+		{
+			args: args(sign("", func() jwt.MapClaims {
+				c := with("aud", []string{anyNonEmptyString, anyOtherString})
+				c["azp"] = anyNonEmptyString
+				return c
+			}())),
+			name: "MultipleAudiencesAZP",
+		},
+		{
+			args: args(sign("", with("azp", anyOtherString))),
+			err:  jcp.ErrAZP,
+			name: "WrongAZP",
+		},
+		{
+			args: withArgs(func(a *jcp.ValidateArgs) { a.Nonce = anyNonEmptyString }),
+			err:  jcp.ErrNonce,
+			name: "WrongNonce",
+		},
+		{
+			args: withArgs(func(a *jcp.ValidateArgs) { a.MaxAge = maxAge(1) }),
+			err:  jcp.ErrAuthTime,
+			name: "AuthTimeTooOld",
+		},
+		{
+			args: func() jcp.ValidateArgs {
+				a := args(sign("", with("auth_time", nil)))
+				a.MaxAge = maxAge(3600)
+				return a
+			}(),
+			err:  jcp.ErrAuthTime,
+			name: "NoAuthTime",
+		},
+		{
+			args: withArgs(func(a *jcp.ValidateArgs) { a.AccessToken = anyNonEmptyString }),
+			err:  jcp.ErrTokenHash,
+			name: "WrongAccessToken",
+		},
+		{
+			args: withArgs(func(a *jcp.ValidateArgs) { a.Code = anyNonEmptyString }),
+			err:  jcp.ErrTokenHash,
+			name: "WrongCode",
+		},
+		{
+			args: func() jcp.ValidateArgs {
+				a := args(sign("", with("at_hash", nil)))
+				a.AccessToken = testAccessToken
+				return a
+			}(),
+			err:  jcp.ErrTokenHash,
+			name: "NoATHash",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := proxy.Validate(ctx, tc.args)
+			if err != nil || tc.err != nil {
+				if errors.Is(err, tc.err) {
+					return
+				}
+				t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+			}
+		})
+	}
+}
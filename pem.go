@@ -0,0 +1,298 @@
+package jcp
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	defaultFetchTimeout = time.Minute
+	fetchMaxBytes       = 1 << 20
+	headerKID           = "kid"
+	headerX5T           = "x5t"
+	headerX5TS256       = "x5t#S256"
+	pemCertificate      = "CERTIFICATE"
+	pemPublicKey        = "PUBLIC KEY"
+	pemRSAPublicKey     = "RSA PUBLIC KEY"
+)
+
+var (
+	// ErrCertificate is returned when a certificate is expired, not yet valid, or does not chain to a trusted CA.
+	ErrCertificate = errors.New("certificate is not valid")
+	// ErrNoPEMKey is returned when a PEM resource does not contain a usable public key or certificate.
+	ErrNoPEMKey = errors.New("no public key or certificate found in PEM data")
+	// ErrThumbprint is returned when a JWT's certificate thumbprint header does not match the certificate.
+	ErrThumbprint = errors.New("certificate thumbprint does not match")
+)
+
+// PEMOptions are the options for a key source made of a PEM encoded public key or X.509 certificate chain.
+type PEMOptions struct {
+	// CABundle is the path to a PEM encoded bundle of CA certificates. If given, the certificate chain must be valid
+	// against it.
+	CABundle string
+	// CheckExpiry indicates the validity period of the certificate should be checked for each JWT.
+	CheckExpiry bool
+	// Client is the HTTP client used to get the PEM data via HTTP.
+	Client *http.Client
+	// Ctx ends the background refresh goroutine when canceled.
+	Ctx context.Context
+	// KID is the key ID, `kid`, that JWTs signed by this key carry.
+	KID string
+	// RefreshErrorHandler consumes errors that happen during a background refresh.
+	RefreshErrorHandler keyfunc.ErrorHandler
+	// RefreshInterval is the duration between background refreshes. No background refresh is done if zero.
+	RefreshInterval time.Duration
+	// RefreshTimeout is the timeout for fetching the PEM data.
+	RefreshTimeout time.Duration
+}
+
+type pemKey struct {
+	certs   []*x509.Certificate
+	public  interface{}
+	x5t     string
+	x5tS256 string
+}
+
+type pemKeySource struct {
+	key      pemKey
+	location string
+	mux      sync.RWMutex
+	options  PEMOptions
+	roots    *x509.CertPool
+}
+
+// newPEMKeySource creates a key source from the PEM data at the given location. The location is a URL with the http,
+// https, or file scheme.
+func newPEMKeySource(location string, options PEMOptions) (*pemKeySource, error) {
+	if options.KID == "" {
+		return nil, fmt.Errorf("%w: no key ID for PEM key source %q", ErrInvalidConfig, location)
+	}
+	if IsFileURL(location) {
+		options.Client = fileClient
+	} else if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	if options.RefreshTimeout == 0 {
+		options.RefreshTimeout = defaultFetchTimeout
+	}
+	p := &pemKeySource{
+		location: location,
+		options:  options,
+	}
+	if options.CABundle != "" {
+		roots, err := loadCertPool(options.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		p.roots = roots
+	}
+
+	err := p.refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	if options.RefreshInterval != 0 {
+		ctx := options.Ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		go p.backgroundRefresh(ctx)
+	}
+
+	return p, nil
+}
+
+// Keyfunc helps implement the keyfuncer interface.
+func (p *pemKeySource) Keyfunc(token *jwt.Token) (interface{}, error) {
+	p.mux.RLock()
+	key := p.key
+	p.mux.RUnlock()
+
+	kid, _ := token.Header[headerKID].(string)
+	x5t, _ := token.Header[headerX5T].(string)
+	x5tS256, _ := token.Header[headerX5TS256].(string)
+	hasThumbprint := x5t != "" || x5tS256 != ""
+
+	if kid != "" && kid != p.options.KID {
+		return nil, keyfunc.ErrKIDNotFound
+	}
+	if kid == "" && (!hasThumbprint || len(key.certs) == 0) {
+		return nil, keyfunc.ErrKIDNotFound
+	}
+	if len(key.certs) != 0 {
+		if (x5t != "" && x5t != key.x5t) || (x5tS256 != "" && x5tS256 != key.x5tS256) {
+			if kid == "" {
+				return nil, keyfunc.ErrKIDNotFound
+			}
+			return nil, fmt.Errorf("%w: key ID %q", ErrThumbprint, kid)
+		}
+		if p.options.CheckExpiry {
+			leaf := key.certs[0]
+			now := time.Now()
+			if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+				return nil, fmt.Errorf("%w: outside of validity period %s to %s", ErrCertificate, leaf.NotBefore, leaf.NotAfter)
+			}
+		}
+	}
+
+	return key.public, nil
+}
+
+func (p *pemKeySource) backgroundRefresh(ctx context.Context) {
+	ticker := time.NewTicker(p.options.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := p.refresh()
+			if err != nil && p.options.RefreshErrorHandler != nil {
+				p.options.RefreshErrorHandler(fmt.Errorf("failed to refresh PEM key source %q: %w", p.location, err))
+			}
+		}
+	}
+}
+
+func (p *pemKeySource) refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.options.RefreshTimeout)
+	defer cancel()
+
+	data, err := fetch(ctx, p.options.Client, p.location)
+	if err != nil {
+		return fmt.Errorf("failed to get PEM data: %w", err)
+	}
+	key, err := parsePEM(data)
+	if err != nil {
+		return err
+	}
+	if p.roots != nil && len(key.certs) != 0 {
+		err = verifyChain(key.certs, p.roots, time.Now(), nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.mux.Lock()
+	p.key = key
+	p.mux.Unlock()
+	return nil
+}
+
+func parsePEM(data []byte) (pemKey, error) {
+	var key pemKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case pemCertificate:
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return pemKey{}, fmt.Errorf("failed to parse PEM certificate: %w", err)
+			}
+			key.certs = append(key.certs, cert)
+		case pemPublicKey:
+			if key.public != nil {
+				continue
+			}
+			public, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return pemKey{}, fmt.Errorf("failed to parse PEM public key: %w", err)
+			}
+			key.public = public
+		case pemRSAPublicKey:
+			if key.public != nil {
+				continue
+			}
+			public, err := x509.ParsePKCS1PublicKey(block.Bytes)
+			if err != nil {
+				return pemKey{}, fmt.Errorf("failed to parse PEM RSA public key: %w", err)
+			}
+			key.public = public
+		}
+	}
+	if len(key.certs) != 0 {
+		leaf := key.certs[0]
+		key.public = leaf.PublicKey
+		key.x5t, key.x5tS256 = thumbprints(leaf)
+	}
+	if key.public == nil {
+		return pemKey{}, ErrNoPEMKey
+	}
+	return key, nil
+}
+
+func thumbprints(cert *x509.Certificate) (x5t, x5tS256 string) {
+	sha1Sum := sha1.Sum(cert.Raw)
+	sha256Sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sha1Sum[:]), base64.RawURLEncoding.EncodeToString(sha256Sum[:])
+}
+
+// verifyChain verifies the certificate chain, leaf first, against the roots. Any extended key usage is accepted when
+// usages is empty.
+func verifyChain(certs []*x509.Certificate, roots *x509.CertPool, now time.Time, usages []x509.ExtKeyUsage) error {
+	if len(usages) == 0 {
+		usages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		CurrentTime:   now,
+		Intermediates: intermediates,
+		KeyUsages:     usages,
+		Roots:         roots,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrCertificate, err)
+	}
+	return nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("failed to parse CA bundle %q: %w", path, ErrNoPEMKey)
+	}
+	return pool, nil
+}
+
+func fetch(ctx context.Context, client *http.Client, location string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform request: %w", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %d", keyfunc.ErrInvalidHTTPStatusCode, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, fetchMaxBytes))
+}
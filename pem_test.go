@@ -0,0 +1,215 @@
+package jcp_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/MicahParks/jcp"
+)
+
+const (
+	headerX5TS256 = "x5t#S256"
+	pemKID        = "my-pem-key-id"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	der     []byte
+	private *ecdsa.PrivateKey
+}
+
+func createCert(t *testing.T, template *x509.Certificate, parent *testCert) testCert {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v.", err)
+	}
+	if template.SerialNumber == nil {
+		template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	}
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = time.Now().Add(time.Hour)
+	}
+	parentCert, parentKey := template, private
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.private
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &private.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v.", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v.", err)
+	}
+	return testCert{
+		cert:    cert,
+		der:     der,
+		private: private,
+	}
+}
+
+func createCA(t *testing.T) testCert {
+	return createCert(t, &x509.Certificate{
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		Subject:               pkix.Name{CommonName: "Test CA"},
+	}, nil)
+}
+
+func certPEM(certs ...testCert) []byte {
+	var data []byte
+	for _, c := range certs {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der})...)
+	}
+	return data
+}
+
+func writeTemp(t *testing.T, name string, data []byte) string {
+	p := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(p, data, 0600)
+	if err != nil {
+		t.Fatalf("Failed to write file: %v.", err)
+	}
+	return p
+}
+
+func TestProxy_PEM(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	ca := createCA(t)
+	leaf := createCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Test Leaf"}}, &ca)
+	expired := createCert(t, &x509.Certificate{
+		NotAfter:  time.Now().Add(-time.Minute),
+		NotBefore: time.Now().Add(-time.Hour),
+		Subject:   pkix.Name{CommonName: "Test Expired"},
+	}, &ca)
+
+	publicDER, err := x509.MarshalPKIXPublicKey(&leaf.private.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v.", err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(publicPEM)
+	}))
+	defer server.Close()
+
+	caBundle := writeTemp(t, "ca.pem", certPEM(ca))
+	otherCABundle := writeTemp(t, "other.pem", certPEM(createCA(t)))
+	chainPath := "file://" + writeTemp(t, "chain.pem", certPEM(leaf, ca))
+	expiredPath := "file://" + writeTemp(t, "expired.pem", certPEM(expired))
+
+	_, err = jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+		PEM: map[string]jcp.PEMOptions{
+			chainPath: {CABundle: otherCABundle, KID: pemKID},
+		},
+	})
+	if !errors.Is(err, jcp.ErrCertificate) {
+		t.Fatalf("Expected error %v for untrusted chain, got %v.", jcp.ErrCertificate, err)
+	}
+
+	sum := sha256.Sum256(leaf.der)
+	thumbprint := base64.RawURLEncoding.EncodeToString(sum[:])
+	sign := func(header map[string]interface{}, private *ecdsa.PrivateKey) string {
+		j := jwt.New(jwt.SigningMethodES256)
+		for k, v := range header {
+			j.Header[k] = v
+		}
+		token, err := j.SignedString(private)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return token
+	}
+
+	testCases := []struct {
+		err     error
+		name    string
+		options map[string]jcp.PEMOptions
+		token   string
+	}{
+		{
+			name: "PublicKeyURL",
+			options: map[string]jcp.PEMOptions{
+				server.URL: {KID: pemKID},
+			},
+			token: sign(map[string]interface{}{headerKID: pemKID}, leaf.private),
+		},
+		{
+			err:  jwt.ErrTokenUnverifiable,
+			name: "WrongKID",
+			options: map[string]jcp.PEMOptions{
+				server.URL: {KID: pemKID},
+			},
+			token: sign(map[string]interface{}{headerKID: testKID}, leaf.private),
+		},
+		{
+			name: "ChainKID",
+			options: map[string]jcp.PEMOptions{
+				chainPath: {CABundle: caBundle, KID: pemKID},
+			},
+			token: sign(map[string]interface{}{headerKID: pemKID}, leaf.private),
+		},
+		{
+			name: "ChainThumbprint",
+			options: map[string]jcp.PEMOptions{
+				chainPath: {CABundle: caBundle, KID: pemKID},
+			},
+			token: sign(map[string]interface{}{headerX5TS256: thumbprint}, leaf.private),
+		},
+		{
+			err:  jcp.ErrThumbprint,
+			name: "ChainThumbprintMismatch",
+			options: map[string]jcp.PEMOptions{
+				chainPath: {CABundle: caBundle, KID: pemKID},
+			},
+			token: sign(map[string]interface{}{headerKID: pemKID, headerX5TS256: anyNonEmptyString}, leaf.private),
+		},
+		{
+			err:  jcp.ErrCertificate,
+			name: "Expired",
+			options: map[string]jcp.PEMOptions{
+				expiredPath: {CheckExpiry: true, KID: pemKID},
+			},
+			token: sign(map[string]interface{}{headerKID: pemKID}, expired.private),
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			proxy, err := jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{PEM: tc.options})
+			if err != nil {
+				t.Fatalf("Failed to create proxy: %v.", err)
+			}
+			_, err = proxy.Validate(ctx, jcp.ValidateArgs{Token: tc.token})
+			if err != nil || tc.err != nil {
+				if errors.Is(err, tc.err) {
+					return
+				}
+				t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+			}
+		})
+	}
+}
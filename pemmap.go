@@ -0,0 +1,144 @@
+package jcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// DefaultPEMMapRefreshRateLimit is the default minimum duration between fetches of a PEM map caused by unknown key IDs.
+const DefaultPEMMapRefreshRateLimit = time.Minute
+
+// PEMMapOptions are the options for a key source that publishes a JSON object mapping key IDs to PEM encoded X.509
+// certificates or public keys, such as Google's and Firebase's `x509` metadata endpoints.
+type PEMMapOptions struct {
+	// CheckExpiry indicates the validity period of the certificate should be checked for each JWT.
+	CheckExpiry bool
+	// Client is the HTTP client used to get the PEM map via HTTP.
+	Client *http.Client
+	// RefreshInterval is the maximum age of the PEM map. An older PEM map is fetched again when next used.
+	RefreshInterval time.Duration
+	// RefreshRateLimit is the minimum duration between fetches of the PEM map caused by unknown key IDs.
+	// DefaultPEMMapRefreshRateLimit is used when zero.
+	RefreshRateLimit time.Duration
+	// RefreshTimeout is the timeout for fetching the PEM map.
+	RefreshTimeout time.Duration
+}
+
+// pemMapKeySource lazily fetches the PEM map when a key ID is not held or the PEM map is older than the refresh
+// interval.
+type pemMapKeySource struct {
+	fetched  time.Time
+	keys     map[string]pemKey
+	location string
+	mux      sync.Mutex
+	options  PEMMapOptions
+}
+
+func newPEMMapKeySource(location string, options PEMMapOptions) (*pemMapKeySource, error) {
+	_, err := validateKeyURL(location)
+	if err != nil {
+		return nil, err
+	}
+	if IsFileURL(location) {
+		options.Client = fileClient
+	} else if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	if options.RefreshRateLimit == 0 {
+		options.RefreshRateLimit = DefaultPEMMapRefreshRateLimit
+	}
+	if options.RefreshTimeout == 0 {
+		options.RefreshTimeout = defaultFetchTimeout
+	}
+	return &pemMapKeySource{
+		location: location,
+		options:  options,
+	}, nil
+}
+
+// Keyfunc helps implement the keyfuncer interface.
+func (p *pemMapKeySource) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header[headerKID].(string)
+	if kid == "" {
+		return nil, keyfunc.ErrKIDNotFound
+	}
+	key, err := p.key(kid)
+	if err != nil {
+		return nil, err
+	}
+	if p.options.CheckExpiry && len(key.certs) != 0 {
+		leaf := key.certs[0]
+		now := time.Now()
+		if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+			return nil, fmt.Errorf("%w: outside of validity period %s to %s", ErrCertificate, leaf.NotBefore, leaf.NotAfter)
+		}
+	}
+	return key.public, nil
+}
+
+// key returns the key for the key ID, fetching the PEM map when needed. Fetches are serialized, so concurrent JWTs with
+// the same unknown key ID cause a single fetch.
+func (p *pemMapKeySource) key(kid string) (pemKey, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	now := time.Now()
+	key, ok := p.keys[kid]
+	stale := p.options.RefreshInterval != 0 && now.Sub(p.fetched) > p.options.RefreshInterval
+	if ok && !stale {
+		return key, nil
+	}
+	if !ok && !stale && now.Sub(p.fetched) < p.options.RefreshRateLimit {
+		return pemKey{}, keyfunc.ErrKIDNotFound
+	}
+
+	err := p.refresh(now)
+	if err != nil {
+		if ok {
+			// Keep using the previous PEM map until a refresh succeeds.
+			return key, nil
+		}
+		return pemKey{}, err
+	}
+	key, ok = p.keys[kid]
+	if !ok {
+		return pemKey{}, keyfunc.ErrKIDNotFound
+	}
+	return key, nil
+}
+
+// refresh fetches the PEM map. The lock must be held.
+func (p *pemMapKeySource) refresh(now time.Time) error {
+	// Rate limit failed fetches too.
+	p.fetched = now
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.options.RefreshTimeout)
+	defer cancel()
+
+	data, err := fetch(ctx, p.options.Client, p.location)
+	if err != nil {
+		return fmt.Errorf("failed to get PEM map %q: %w", p.location, err)
+	}
+	var raw map[string]string
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return fmt.Errorf("failed to parse PEM map %q: %w", p.location, err)
+	}
+	keys := make(map[string]pemKey, len(raw))
+	for kid, value := range raw {
+		key, err := parsePEM([]byte(value))
+		if err != nil {
+			return fmt.Errorf("failed to parse key ID %q of PEM map %q: %w", kid, p.location, err)
+		}
+		keys[kid] = key
+	}
+	p.keys = keys
+	return nil
+}
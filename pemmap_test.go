@@ -0,0 +1,140 @@
+package jcp_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/MicahParks/jcp"
+)
+
+func TestProxy_PEMMap(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	ca := createCA(t)
+	first := createCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "First"}}, &ca)
+	rotated := createCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Rotated"}}, &ca)
+	expired := createCert(t, &x509.Certificate{
+		NotAfter:  time.Now().Add(-time.Minute),
+		NotBefore: time.Now().Add(-time.Hour),
+		Subject:   pkix.Name{CommonName: "Expired"},
+	}, &ca)
+
+	var mux sync.Mutex
+	fetches := 0
+	pemMap := map[string]string{
+		"first":   string(certPEM(first)),
+		"expired": string(certPEM(expired)),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+		fetches++
+		_ = json.NewEncoder(w).Encode(pemMap)
+	}))
+	defer server.Close()
+	fetched := func() int {
+		mux.Lock()
+		defer mux.Unlock()
+		return fetches
+	}
+
+	sign := func(kid string, private *ecdsa.PrivateKey) string {
+		j := jwt.New(jwt.SigningMethodES256)
+		j.Header[headerKID] = kid
+		token, err := j.SignedString(private)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return token
+	}
+
+	proxy, err := jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+		PEMMaps: map[string]jcp.PEMMapOptions{
+			server.URL: {CheckExpiry: true, RefreshRateLimit: time.Hour},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+	if n := fetched(); n != 0 {
+		t.Fatalf("Expected the PEM map to be fetched lazily, got %d fetches.", n)
+	}
+
+	testCases := []struct {
+		err     error
+		fetches int
+		name    string
+		token   string
+	}{
+		{
+			fetches: 1,
+			name:    "Valid",
+			token:   sign("first", first.private),
+		},
+		{
+			err:     jwt.ErrECDSAVerification,
+			fetches: 1,
+			name:    "WrongKey",
+			token:   sign("first", rotated.private),
+		},
+		{
+			err:     jcp.ErrCertificate,
+			fetches: 1,
+			name:    "Expired",
+			token:   sign("expired", expired.private),
+		},
+		{
+			err:     keyfunc.ErrKIDNotFound,
+			fetches: 1,
+			name:    "UnknownKIDRateLimited",
+			token:   sign("rotated", rotated.private),
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := proxy.Validate(ctx, jcp.ValidateArgs{Token: tc.token})
+			if err != nil || tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+				}
+			}
+			if n := fetched(); n != tc.fetches {
+				t.Fatalf("Expected %d fetches, got %d.", tc.fetches, n)
+			}
+		})
+	}
+
+	rotating, err := jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+		PEMMaps: map[string]jcp.PEMMapOptions{
+			server.URL: {RefreshRateLimit: time.Nanosecond},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+	_, err = rotating.Validate(ctx, jcp.ValidateArgs{Token: sign("first", first.private)})
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v.", err)
+	}
+	mux.Lock()
+	pemMap["rotated"] = string(certPEM(rotated))
+	mux.Unlock()
+	_, err = rotating.Validate(ctx, jcp.ValidateArgs{Token: sign("rotated", rotated.private)})
+	if err != nil {
+		t.Fatalf("Failed to validate token signed with a rotated key: %v.", err)
+	}
+}
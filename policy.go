@@ -0,0 +1,62 @@
+package jcp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownPolicy is returned when a request names a policy that is not configured.
+var ErrUnknownPolicy = errors.New("unknown policy")
+
+// Policy is a named set of validation requirements configured ahead of time. A request selects a policy by name. The
+// requirements of the policy and of the request both apply, so a request can not loosen its policy.
+//
+// RevokeSessions adds the session, or the subject when there is no session, of each valid logout token to the Denylist.
+// It requires the logoutToken profile.
+//
+// Namespaces, ServiceAccounts, and RequirePod limit the Kubernetes service accounts that are accepted. They require the
+// kubernetes profile.
+//
+// Environments, Refs, Repositories, and Workflows are patterns that limit the CI/CD pipelines that are accepted. They
+// require a CI/CD profile, such as githubActions.
+//
+// Actors, MaxDelegationDepth, and RejectDelegation constrain the delegation chain of the `act` claim. Every actor must be
+// in Actors when given and the chain can not be longer than MaxDelegationDepth when it is not zero.
+//
+// Expressions are CEL expressions that must evaluate to true. They can use the verified JWT's `header` and `claims` and
+// the `request` variables given by the caller, such as `claims.tenant == request.tenant`.
+//
+// SPIFFEIDs are patterns, such as `spiffe://example.org/ns/*/sa/web`, one of which the SPIFFE ID of a JWT-SVID must
+// match. JWTs that are not JWT-SVIDs from an allowed trust domain are rejected when given.
+type Policy struct {
+	Actors             []string `json:"actors"`
+	Aud                []string `json:"aud"`
+	Environments       []string `json:"environments"`
+	Events             []string `json:"events"`
+	Expressions        []string `json:"expressions"`
+	Iss                []string `json:"iss"`
+	MaxDelegationDepth int      `json:"maxDelegationDepth"`
+	Namespaces         []string `json:"namespaces"`
+	Profile            string   `json:"profile"`
+	Refs               []string `json:"refs"`
+	RejectDelegation   bool     `json:"rejectDelegation"`
+	RejectReplay       bool     `json:"rejectReplay"`
+	Repositories       []string `json:"repositories"`
+	RequirePod         bool     `json:"requirePod"`
+	RevokeSessions     bool     `json:"revokeSessions"`
+	ServiceAccounts    []string `json:"serviceAccounts"`
+	SPIFFEIDs          []string `json:"spiffeIDs"`
+	Sub                []string `json:"sub"`
+	Workflows          []string `json:"workflows"`
+}
+
+func (p proxy) policy(name string) (Policy, error) {
+	if name == "" {
+		return Policy{}, nil
+	}
+	policy, ok := p.policies[name]
+	if !ok {
+		return Policy{}, fmt.Errorf("%w: %q", ErrUnknownPolicy, name)
+	}
+	return policy, nil
+}
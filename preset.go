@@ -0,0 +1,256 @@
+package jcp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+)
+
+const (
+	// ProfileGitHubActions is the validation profile for GitHub Actions OIDC tokens.
+	ProfileGitHubActions = "githubActions"
+	// ProfileGitLabCI is the validation profile for GitLab CI/CD ID tokens.
+	ProfileGitLabCI = "gitlabCI"
+	refTypeBranch   = "branch"
+	refTypeTag      = "tag"
+)
+
+// ErrPipeline is returned when a CI/CD token's repository, ref, environment, or workflow does not match the rules.
+var ErrPipeline = errors.New("CI/CD pipeline check failed")
+
+// preset is what is known about a CI/CD provider's tokens.
+type preset struct {
+	// issuer is the issuer of the provider's hosted service.
+	issuer string
+	// jwksPath is the path of the JWK Set relative to the issuer.
+	jwksPath string
+	// pipeline returns the pipeline of a token from the provider.
+	pipeline func(claims *tokenClaims) Pipeline
+}
+
+// presets are the built-in CI/CD providers by validation profile.
+var presets = map[string]preset{
+	ProfileGitHubActions: {
+		issuer:   "https://token.actions.githubusercontent.com",
+		jwksPath: "/.well-known/jwks",
+		pipeline: func(claims *tokenClaims) Pipeline {
+			return Pipeline{
+				Actor:       claims.Actor,
+				Environment: claims.Environment,
+				Ref:         claims.Ref,
+				Repository:  claims.Repository,
+				SHA:         claims.SHA,
+				Workflow:    claims.JobWorkflowRef,
+			}
+		},
+	},
+	ProfileGitLabCI: {
+		issuer:   "https://gitlab.com",
+		jwksPath: "/oauth/discovery/keys",
+		pipeline: func(claims *tokenClaims) Pipeline {
+			// GitLab's ref claim is a branch or tag name, so it is qualified like GitHub's.
+			ref := claims.Ref
+			switch claims.RefType {
+			case refTypeBranch:
+				ref = "refs/heads/" + ref
+			case refTypeTag:
+				ref = "refs/tags/" + ref
+			}
+			return Pipeline{
+				Actor:       claims.UserLogin,
+				Environment: claims.Environment,
+				Ref:         ref,
+				Repository:  claims.ProjectPath,
+				SHA:         claims.SHA,
+				Workflow:    claims.CIConfigRefURI,
+			}
+		},
+	},
+}
+
+// Pipeline is the CI/CD job a token was issued to, with the same meaning for each provider.
+type Pipeline struct {
+	// Actor is the user that triggered the job.
+	Actor string `json:"actor"`
+	// Environment is the deployment environment of the job, if any.
+	Environment string `json:"environment"`
+	// Ref is the fully qualified Git ref, such as `refs/heads/main`.
+	Ref string `json:"ref"`
+	// Repository is the repository or project path, such as `org/x`.
+	Repository string `json:"repository"`
+	// SHA is the Git commit.
+	SHA string `json:"sha"`
+	// Workflow is the reference of the workflow or pipeline configuration that defines the job, such as GitHub's
+	// `job_workflow_ref` or GitLab's `ci_config_ref_uri`.
+	Workflow string `json:"workflow"`
+}
+
+// pipelineClaims are the claims of CI/CD tokens. GitHub Actions and GitLab CI/CD share the names of some claims.
+type pipelineClaims struct {
+	Actor          string `json:"actor"`
+	CIConfigRefURI string `json:"ci_config_ref_uri"`
+	Environment    string `json:"environment"`
+	JobWorkflowRef string `json:"job_workflow_ref"`
+	ProjectPath    string `json:"project_path"`
+	Ref            string `json:"ref"`
+	RefType        string `json:"ref_type"`
+	Repository     string `json:"repository"`
+	SHA            string `json:"sha"`
+	UserLogin      string `json:"user_login"`
+}
+
+// PresetOptions are the options for verifying the tokens of a CI/CD provider.
+type PresetOptions struct {
+	// Client is the HTTP client used to get the JWK Set via HTTP.
+	Client *http.Client
+	// Issuer replaces the issuer of the provider's hosted service, such as for GitHub Enterprise Server or a
+	// self-managed GitLab instance.
+	Issuer string
+	// RefreshErrorHandler consumes errors that happen during a background refresh.
+	RefreshErrorHandler keyfunc.ErrorHandler
+	// RefreshInterval is the duration between background refreshes of the JWK Set.
+	RefreshInterval time.Duration
+	// RefreshTimeout is the timeout for fetching the JWK Set.
+	RefreshTimeout time.Duration
+}
+
+// isPreset reports whether the validation profile is a CI/CD preset.
+func isPreset(profile string) bool {
+	_, ok := presets[profile]
+	return ok
+}
+
+// isHostedPreset reports whether the issuer is the issuer of the CI/CD provider's hosted service. The empty issuer
+// selects the hosted service. Anyone can get a token from a hosted service for their own repository, so its tokens must
+// be limited to known repositories or owners.
+func isHostedPreset(profile, iss string) bool {
+	return iss == "" || iss == presets[profile].issuer
+}
+
+// newPresetJWKS gets the JWK Set of the CI/CD provider and returns its issuer.
+func newPresetJWKS(profile string, options PresetOptions) (string, *keyfunc.JWKS, error) {
+	p, ok := presets[profile]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %q is not a CI/CD preset", ErrInvalidConfig, profile)
+	}
+	iss := p.issuer
+	if options.Issuer != "" {
+		iss = options.Issuer
+	}
+	err := validatePatternURL(iss)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: invalid issuer %q for preset %q: %s", ErrInvalidConfig, iss, profile, err)
+	}
+	u := strings.TrimSuffix(iss, "/") + p.jwksPath
+	jwks, err := keyfunc.Get(u, keyfunc.Options{
+		Client:              options.Client,
+		RefreshErrorHandler: options.RefreshErrorHandler,
+		RefreshInterval:     options.RefreshInterval,
+		RefreshTimeout:      options.RefreshTimeout,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get JWK Set %q for preset %q: %w", u, profile, err)
+	}
+	return iss, jwks, nil
+}
+
+// checkPresetIssuer confirms a JWT verified with the JWK Set of an enabled CI/CD provider is validated with that
+// provider's profile. Without it, anyone who can get a token from a hosted provider would be accepted by any request.
+func (p proxy) checkPresetIssuer(profileName string, source keySource, claims *tokenClaims) error {
+	if source != keySourceIssuer {
+		return nil
+	}
+	for profile, iss := range p.presets {
+		if claims.Issuer == iss && profileName != profile {
+			return fmt.Errorf("%w: tokens from the issuer %q require the %q profile", ErrProfile, iss, profile)
+		}
+	}
+	return nil
+}
+
+// checkPreset confirms the JWT is from the enabled CI/CD provider of the validation profile and its pipeline matches
+// the rules of the request and its policy. It returns the pipeline.
+func (p proxy) checkPreset(profile string, args ValidateArgs, policy Policy, claims *tokenClaims) (*Pipeline, error) {
+	iss, ok := p.presets[profile]
+	if !ok {
+		return nil, fmt.Errorf("%w: preset %q is not enabled", ErrProfile, profile)
+	}
+	if claims.Issuer != iss {
+		return nil, fmt.Errorf("%w: claim %q must be %q", ErrProfile, issClaim, iss)
+	}
+	if len(args.Aud) == 0 && len(policy.Aud) == 0 {
+		return nil, fmt.Errorf("%w: the %q of the relying party must be given", ErrProfile, audClaim)
+	}
+	if isHostedPreset(profile, iss) && len(args.Repositories) == 0 && len(policy.Repositories) == 0 {
+		return nil, fmt.Errorf("%w: repositories must be given for the hosted issuer %q", ErrPipeline, iss)
+	}
+	required := map[string]bool{
+		audClaim: len(claims.Audience) != 0,
+		expClaim: claims.ExpiresAt != nil,
+		iatClaim: claims.IssuedAt != nil,
+		subClaim: claims.Subject != "",
+	}
+	for _, claim := range []string{audClaim, expClaim, iatClaim, subClaim} {
+		if !required[claim] {
+			return nil, fmt.Errorf("%w: claim %q is required", ErrProfile, claim)
+		}
+	}
+
+	pipeline := presets[profile].pipeline(claims)
+	rules := []struct {
+		name     string
+		patterns [][]string
+		value    string
+	}{
+		{name: "environment", patterns: [][]string{args.Environments, policy.Environments}, value: pipeline.Environment},
+		{name: "ref", patterns: [][]string{args.Refs, policy.Refs}, value: pipeline.Ref},
+		{name: "repository", patterns: [][]string{args.Repositories, policy.Repositories}, value: pipeline.Repository},
+		{name: "workflow", patterns: [][]string{args.Workflows, policy.Workflows}, value: pipeline.Workflow},
+	}
+	for _, rule := range rules {
+		for _, patterns := range rule.patterns {
+			if len(patterns) != 0 && !matchPipeline(patterns, rule.value) {
+				return nil, fmt.Errorf("%w: %s %q is not allowed", ErrPipeline, rule.name, rule.value)
+			}
+		}
+	}
+	return &pipeline, nil
+}
+
+// matchPipeline reports whether the value is not empty and matches one of the patterns. A `*` in a pattern does not
+// match a `/`.
+func matchPipeline(patterns []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		ok, err := path.Match(pattern, value)
+		if err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pipelinePatterns returns every CI/CD pipeline rule pattern of the policy.
+func pipelinePatterns(policy Policy) []string {
+	var patterns []string
+	for _, p := range [][]string{policy.Environments, policy.Refs, policy.Repositories, policy.Workflows} {
+		patterns = append(patterns, p...)
+	}
+	return patterns
+}
+
+// validatePipelinePattern confirms the pattern is a valid pattern for a pipeline rule.
+func validatePipelinePattern(pattern string) error {
+	_, err := path.Match(pattern, "")
+	if err != nil {
+		return fmt.Errorf("invalid pipeline pattern %q: %s", pattern, err)
+	}
+	return nil
+}
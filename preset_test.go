@@ -0,0 +1,238 @@
+package jcp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/MicahParks/jcp"
+)
+
+const (
+	pipelineAud = "https://deploy.example.com"
+
+	// githubFixture is the claim set of a GitHub Actions OIDC token for a deployment job. The `exp`, `iat`, `iss`, and
+	// `nbf` claims are replaced by the test.
+	githubFixture = `{
+  "actor": "octocat",
+  "aud": "https://deploy.example.com",
+  "environment": "prod",
+  "event_name": "push",
+  "job_workflow_ref": "org/x/.github/workflows/deploy.yml@refs/heads/main",
+  "ref": "refs/heads/main",
+  "ref_type": "branch",
+  "repository": "org/x",
+  "repository_owner": "org",
+  "run_id": "6210942071",
+  "sha": "d1a3f6c9e0b2d4f6a8c0e2d4f6a8b0c2d4e6f8a0",
+  "sub": "repo:org/x:environment:prod"
+}`
+
+	// gitlabFixture is the claim set of a GitLab CI/CD ID token for a deployment job. The `exp`, `iat`, `iss`, and
+	// `nbf` claims are replaced by the test.
+	gitlabFixture = `{
+  "aud": "https://deploy.example.com",
+  "ci_config_ref_uri": "gitlab.com/org/x//.gitlab-ci.yml@refs/heads/main",
+  "environment": "prod",
+  "namespace_path": "org",
+  "pipeline_source": "push",
+  "project_path": "org/x",
+  "ref": "main",
+  "ref_protected": "true",
+  "ref_type": "branch",
+  "sha": "d1a3f6c9e0b2d4f6a8c0e2d4f6a8b0c2d4e6f8a0",
+  "sub": "project_path:org/x:ref_type:branch:ref:main",
+  "user_login": "octocat"
+}`
+)
+
+func TestProxy_Presets(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	resp, err := http.Get(jwksServer.URL)
+	if err != nil {
+		t.Fatalf("Failed to get JWK Set: %v.", err)
+	}
+	rawJWKS, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to read JWK Set: %v.", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/github/.well-known/jwks", "/gitlab/oauth/discovery/keys":
+			_, _ = w.Write(rawJWKS)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	githubIssuer := server.URL + "/github"
+	gitlabIssuer := server.URL + "/gitlab"
+
+	rules := jcp.Policy{
+		Aud:          []string{pipelineAud},
+		Environments: []string{"prod"},
+		Refs:         []string{"refs/heads/main"},
+		Repositories: []string{"org/x"},
+	}
+	github := rules
+	github.Profile = jcp.ProfileGitHubActions
+	github.Workflows = []string{"org/x/.github/workflows/deploy.yml@refs/heads/main"}
+	gitlab := rules
+	gitlab.Profile = jcp.ProfileGitLabCI
+	proxy, err := jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+		Policies: map[string]jcp.Policy{
+			jcp.ProfileGitHubActions: github,
+			jcp.ProfileGitLabCI:      gitlab,
+			"plain":                  {Aud: []string{pipelineAud}},
+		},
+		Presets: map[string]jcp.PresetOptions{
+			jcp.ProfileGitHubActions: {Issuer: githubIssuer},
+			jcp.ProfileGitLabCI:      {Issuer: gitlabIssuer},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	sign := func(fixture, iss string, edit func(claims jwt.MapClaims)) string {
+		claims := jwt.MapClaims{}
+		err := json.Unmarshal([]byte(fixture), &claims)
+		if err != nil {
+			t.Fatalf("Failed to parse fixture: %v.", err)
+		}
+		now := time.Now()
+		claims["exp"] = now.Add(5 * time.Minute).Unix()
+		claims["iat"] = now.Unix()
+		claims["iss"] = iss
+		claims["nbf"] = now.Unix()
+		if edit != nil {
+			edit(claims)
+		}
+		j := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		j.Header[headerKID] = testKID
+		token, err := j.SignedString(privateKey)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return token
+	}
+
+	testCases := []struct {
+		args     jcp.ValidateArgs
+		err      error
+		name     string
+		workflow string
+	}{
+		{
+			args:     jcp.ValidateArgs{Policy: jcp.ProfileGitHubActions, Token: sign(githubFixture, githubIssuer, nil)},
+			name:     "GitHub",
+			workflow: "org/x/.github/workflows/deploy.yml@refs/heads/main",
+		},
+		{
+			args:     jcp.ValidateArgs{Policy: jcp.ProfileGitLabCI, Token: sign(gitlabFixture, gitlabIssuer, nil)},
+			name:     "GitLab",
+			workflow: "gitlab.com/org/x//.gitlab-ci.yml@refs/heads/main",
+		},
+		{
+			args:     jcp.ValidateArgs{Aud: []string{pipelineAud}, Profile: jcp.ProfileGitHubActions, Refs: []string{"refs/heads/*"}, Token: sign(githubFixture, githubIssuer, nil)},
+			name:     "RequestRefPattern",
+			workflow: "org/x/.github/workflows/deploy.yml@refs/heads/main",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: jcp.ProfileGitHubActions, Token: sign(githubFixture, githubIssuer, func(claims jwt.MapClaims) {
+				claims["ref"] = "refs/heads/feature"
+			})},
+			err:  jcp.ErrPipeline,
+			name: "GitHubRef",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: jcp.ProfileGitHubActions, Token: sign(githubFixture, githubIssuer, func(claims jwt.MapClaims) {
+				claims["repository"] = "org/y"
+			})},
+			err:  jcp.ErrPipeline,
+			name: "GitHubRepository",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: jcp.ProfileGitHubActions, Token: sign(githubFixture, githubIssuer, func(claims jwt.MapClaims) {
+				delete(claims, "environment")
+			})},
+			err:  jcp.ErrPipeline,
+			name: "GitHubNoEnvironment",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: jcp.ProfileGitHubActions, Token: sign(githubFixture, githubIssuer, func(claims jwt.MapClaims) {
+				claims["job_workflow_ref"] = "org/y/.github/workflows/deploy.yml@refs/heads/main"
+			})},
+			err:  jcp.ErrPipeline,
+			name: "GitHubReusableWorkflow",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: jcp.ProfileGitLabCI, Token: sign(gitlabFixture, gitlabIssuer, func(claims jwt.MapClaims) {
+				claims["ref_type"] = "tag"
+			})},
+			err:  jcp.ErrPipeline,
+			name: "GitLabTag",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: jcp.ProfileGitHubActions, Token: sign(gitlabFixture, gitlabIssuer, nil)},
+			err:  jcp.ErrProfile,
+			name: "WrongProvider",
+		},
+		{
+			args: jcp.ValidateArgs{Profile: jcp.ProfileGitHubActions, Token: sign(githubFixture, githubIssuer, nil)},
+			err:  jcp.ErrProfile,
+			name: "NoAudienceGiven",
+		},
+		{
+			args: jcp.ValidateArgs{Aud: []string{pipelineAud}, Token: sign(githubFixture, githubIssuer, nil)},
+			err:  jcp.ErrProfile,
+			name: "NoProfile",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: "plain", Token: sign(gitlabFixture, gitlabIssuer, nil)},
+			err:  jcp.ErrProfile,
+			name: "PlainPolicy",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := proxy.Validate(ctx, tc.args)
+			if err != nil || tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+				}
+				return
+			}
+			pipeline := results.Pipeline
+			if pipeline == nil || pipeline.Repository != "org/x" || pipeline.Ref != "refs/heads/main" || pipeline.Environment != "prod" || pipeline.Workflow != tc.workflow {
+				t.Fatalf("Unexpected pipeline in results: %+v.", pipeline)
+			}
+		})
+	}
+
+	hosted := github
+	hosted.Repositories = nil
+	_, err = jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+		Policies: map[string]jcp.Policy{
+			jcp.ProfileGitHubActions: hosted,
+		},
+		Presets: map[string]jcp.PresetOptions{
+			jcp.ProfileGitHubActions: {},
+		},
+	})
+	if !errors.Is(err, jcp.ErrInvalidConfig) {
+		t.Fatalf("Expected error %v, got error %v.", jcp.ErrInvalidConfig, err)
+	}
+}
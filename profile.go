@@ -0,0 +1,101 @@
+package jcp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// ProfileAccessToken is the validation profile for JWT access tokens as defined in RFC 9068.
+	ProfileAccessToken = "accessToken"
+	clientIDClaim      = "client_id"
+	iatClaim           = "iat"
+	typAccessToken     = "at+jwt"
+)
+
+var (
+	// ErrProfile is returned when a JWT does not satisfy the requirements of its validation profile.
+	ErrProfile = errors.New("token does not satisfy validation profile")
+	// ErrUnknownProfile is returned when a request or policy names a validation profile that does not exist.
+	ErrUnknownProfile = errors.New("unknown validation profile")
+)
+
+// profile returns the validation profile selected by the request and its policy. A request can not select a different
+// profile than its policy.
+func profile(args ValidateArgs, policy Policy) (string, error) {
+	name := args.Profile
+	if policy.Profile != "" {
+		if name != "" && name != policy.Profile {
+			return "", fmt.Errorf("%w: request profile %q conflicts with policy profile %q", ErrProfile, name, policy.Profile)
+		}
+		name = policy.Profile
+	}
+	if !knownProfile(name) {
+		return "", fmt.Errorf("%w: %q", ErrUnknownProfile, name)
+	}
+	return name, nil
+}
+
+// knownProfile reports whether the name is a validation profile. The empty name selects no profile.
+func knownProfile(name string) bool {
+	switch name {
+	case "", ProfileAccessToken, ProfileGitHubActions, ProfileGitLabCI, ProfileIDToken, ProfileKubernetes, ProfileLogoutToken,
+		ProfileSecurityEvent:
+		return true
+	default:
+		return false
+	}
+}
+
+// checkProfile confirms the JWT satisfies the requirements of the named validation profile.
+func checkProfile(name string, args ValidateArgs, policy Policy, token *jwt.Token, claims *tokenClaims) error {
+	switch name {
+	case ProfileAccessToken:
+		return checkAccessToken(args, policy, token, claims)
+	case ProfileIDToken:
+		return checkIDToken(args, policy, token, claims)
+	case ProfileKubernetes:
+		return checkKubernetes(args, policy, token, claims)
+	case ProfileLogoutToken:
+		return checkLogoutToken(args, policy, token, claims)
+	case ProfileSecurityEvent:
+		return checkSecurityEvent(args, policy, token, claims)
+	default:
+		return nil
+	}
+}
+
+// checkAccessToken confirms the JWT is an access token as defined in RFC 9068. ID tokens and other JWTs signed by the
+// same issuer do not have the `at+jwt` type, so they are rejected.
+func checkAccessToken(args ValidateArgs, policy Policy, token *jwt.Token, claims *tokenClaims) error {
+	if typ := mediaType(token); typ != typAccessToken {
+		return fmt.Errorf("%w: header %q must be %q, got %q", ErrProfile, headerTyp, typAccessToken, typ)
+	}
+	if len(args.Aud) == 0 && len(policy.Aud) == 0 {
+		return fmt.Errorf("%w: the %q of the resource server must be given", ErrProfile, audClaim)
+	}
+	required := map[string]bool{
+		audClaim:      len(claims.Audience) != 0,
+		clientIDClaim: claims.ClientID != "",
+		expClaim:      claims.ExpiresAt != nil,
+		iatClaim:      claims.IssuedAt != nil,
+		issClaim:      claims.Issuer != "",
+		jtiClaim:      claims.ID != "",
+		subClaim:      claims.Subject != "",
+	}
+	for _, claim := range []string{audClaim, clientIDClaim, expClaim, iatClaim, issClaim, jtiClaim, subClaim} {
+		if !required[claim] {
+			return fmt.Errorf("%w: claim %q is required", ErrProfile, claim)
+		}
+	}
+	return nil
+}
+
+// mediaType returns the `typ` header of the JWT in lowercase without the optional "application/" prefix.
+func mediaType(token *jwt.Token) string {
+	typ, _ := token.Header[headerTyp].(string)
+	return strings.TrimPrefix(strings.ToLower(typ), "application/")
+}
@@ -0,0 +1,141 @@
+package jcp_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/MicahParks/jcp"
+)
+
+const accessTokenPolicy = "accessToken"
+
+func TestProxy_AccessTokenProfile(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	proxy, err := jcp.NewProxyWithOptions(map[string]keyfunc.Options{jwksServer.URL: {}}, jcp.ProxyOptions{
+		Policies: map[string]jcp.Policy{
+			accessTokenPolicy: {
+				Aud:     []string{anyNonEmptyString},
+				Profile: jcp.ProfileAccessToken,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	now := time.Now()
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"aud":       anyNonEmptyString,
+			"client_id": anyOtherString,
+			"exp":       now.Add(time.Minute).Unix(),
+			"iat":       now.Unix(),
+			"iss":       anyOtherString,
+			"jti":       anyNonEmptyString,
+			"sub":       anyOtherString,
+		}
+	}
+	without := func(claim string) jwt.MapClaims {
+		c := claims()
+		delete(c, claim)
+		return c
+	}
+	sign := func(typ string, claims jwt.MapClaims) string {
+		j := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		j.Header[headerKID] = testKID
+		j.Header["typ"] = typ
+		token, err := j.SignedString(privateKey)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return token
+	}
+	accessToken := sign("at+jwt", claims())
+
+	testCases := []struct {
+		args jcp.ValidateArgs
+		err  error
+		name string
+	}{
+		{
+			args: jcp.ValidateArgs{Policy: accessTokenPolicy, Token: accessToken},
+			name: "Policy",
+		},
+		{
+			args: jcp.ValidateArgs{Aud: []string{anyNonEmptyString}, Profile: jcp.ProfileAccessToken, Token: accessToken},
+			name: "Request",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: accessTokenPolicy, Token: sign("application/at+jwt", claims())},
+			name: "MediaType",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: accessTokenPolicy, Token: sign("JWT", claims())},
+			err:  jcp.ErrProfile,
+			name: "IDToken",
+		},
+		{
+			args: jcp.ValidateArgs{Profile: jcp.ProfileAccessToken, Token: accessToken},
+			err:  jcp.ErrProfile,
+			name: "NoResourceServerAud",
+		},
+		{
+			args: jcp.ValidateArgs{Aud: []string{anyOtherString}, Profile: jcp.ProfileAccessToken, Token: accessToken},
+			err:  jcp.ErrClaimCheck,
+			name: "WrongAud",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: accessTokenPolicy, Token: sign("at+jwt", without("client_id"))},
+			err:  jcp.ErrProfile,
+			name: "NoClientID",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: accessTokenPolicy, Token: sign("at+jwt", without("iat"))},
+			err:  jcp.ErrProfile,
+			name: "NoIAT",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: accessTokenPolicy, Token: sign("at+jwt", without("jti"))},
+			err:  jcp.ErrProfile,
+			name: "NoJTI",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: accessTokenPolicy, Token: sign("at+jwt", without("sub"))},
+			err:  jcp.ErrProfile,
+			name: "NoSub",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: accessTokenPolicy, Profile: anyNonEmptyString, Token: accessToken},
+			err:  jcp.ErrProfile,
+			name: "ConflictingProfile",
+		},
+		{
+			args: jcp.ValidateArgs{Profile: anyNonEmptyString, Token: accessToken},
+			err:  jcp.ErrUnknownProfile,
+			name: "UnknownProfile",
+		},
+		{
+			args: jcp.ValidateArgs{Token: sign("JWT", claims())},
+			name: "NoProfile",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := proxy.Validate(ctx, tc.args)
+			if err != nil || tc.err != nil {
+				if errors.Is(err, tc.err) {
+					return
+				}
+				t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+			}
+		})
+	}
+}
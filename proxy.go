@@ -2,17 +2,24 @@ package jcp
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 
 	"github.com/MicahParks/keyfunc"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/cel-go/cel"
 )
 
 const (
-	audClaim = "aud"
-	issClaim = "iss"
-	subClaim = "sub"
+	audClaim   = "aud"
+	expClaim   = "exp"
+	issClaim   = "iss"
+	jtiClaim   = "jti"
+	schemeFile = "file"
+	subClaim   = "sub"
 )
 
 var (
@@ -31,84 +38,535 @@ type keyfuncer interface {
 	Keyfunc(token *jwt.Token) (interface{}, error)
 }
 
+// keyfuncers tries each keyfuncer in order and uses the first key found.
+type keyfuncers []keyfuncer
+
+func (k keyfuncers) Keyfunc(token *jwt.Token) (interface{}, error) {
+	var firstErr error
+	for _, kf := range k {
+		key, err := kf.Keyfunc(token)
+		if err == nil {
+			return key, nil
+		}
+		if firstErr == nil && !errors.Is(err, keyfunc.ErrKIDNotFound) {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return nil, fmt.Errorf("failed to find key ID in any JWK Set: %w", keyfunc.ErrKIDNotFound)
+}
+
 type proxy struct {
-	keyfuncer keyfuncer
+	denylist            *Denylist
+	dpop                DPoPOptions
+	expressionCostLimit uint64
+	expressionEnv       *cel.Env
+	expressions         map[string][]expression
+	hmac                *hmacKeySource
+	inlineJWKS          map[string]json.RawMessage
+	issuerJWKS          map[string]*keyfunc.JWKS
+	issuers             *issuerKeySource
+	jku                 *jkuKeySource
+	jwe                 *jweDecrypter
+	keyfuncer           keyfuncer
+	keyfuncers          int
+	kubernetes          map[string]bool
+	policies            map[string]Policy
+	presets             map[string]string
+	remoteJWKS          map[string]*keyfunc.JWKS
+	replayStore         ReplayStore
+	spiffe              *spiffeKeySource
+	x5c                 *x5cKeySource
 }
 
-// NewProxy creates a new JWKS client proxy.
+// ProxyOptions are the options used to create a Proxy in addition to the remote JWK Set resources.
+type ProxyOptions struct {
+	// Denylist is consulted after a JWT's signature has been verified. Revoked JWTs are rejected.
+	Denylist *Denylist
+	// DPoP are the options for validating DPoP proofs. Zero values are replaced with defaults.
+	DPoP DPoPOptions
+	// ExpressionCostLimit is the maximum runtime cost of evaluating a single expression. DefaultExpressionCostLimit is
+	// used when zero.
+	ExpressionCostLimit uint64
+	// HMAC is a map of key IDs to shared secrets. HMAC signed JWTs are rejected when empty.
+	HMAC map[string]HMACKey
+	// Inline is a map of names to JWK Sets given as raw JSON. Their keys are merged with the remote JWK Sets.
+	Inline map[string]json.RawMessage
+	// Issuers are the options for verifying JWTs from issuers matching a pattern. JWTs from issuers that do not match a
+	// pattern are verified with the other key sources, or rejected when there are none.
+	Issuers IssuersOptions
+	// JKU are the options for verifying JWTs with the JWK Set their `jku` header points to.
+	JKU JKUOptions
+	// JWE are the options for decrypting encrypted JWTs. Encrypted JWTs are rejected when there are no keys.
+	JWE JWEOptions
+	// KeyURLs is a map of key URL templates to their options. Each key ID's PEM encoded public key is fetched from the
+	// template's URL when first needed.
+	KeyURLs map[string]KeyURLOptions
+	// Kubernetes is a map of Kubernetes cluster issuers to the options for verifying their service account tokens. JWTs
+	// from a cluster issuer are only verified with that cluster's JWK Set and require ProfileKubernetes.
+	Kubernetes map[string]KubernetesOptions
+	// Multiple is used when more than one remote JWK Set resource is given.
+	Multiple keyfunc.MultipleOptions
+	// PEM is a map of URLs to PEM encoded public keys or X.509 certificate chains and their options.
+	PEM map[string]PEMOptions
+	// PEMMaps is a map of URLs of JSON objects mapping key IDs to PEM encoded X.509 certificates or public keys to their
+	// options.
+	PEMMaps map[string]PEMMapOptions
+	// Policies is a map of names to policies that requests can select.
+	Policies map[string]Policy
+	// Presets is a map of CI/CD validation profiles, such as ProfileGitHubActions, to the options for verifying the
+	// provider's tokens. JWTs from the provider's issuer are only verified with its JWK Set and require its profile.
+	Presets map[string]PresetOptions
+	// ReplayStore records the JWT IDs of accepted JWTs when replay detection is requested.
+	ReplayStore ReplayStore
+	// SPIFFE is a map of SPIFFE trust domains to the options of their trust bundles. JWTs whose subject is a SPIFFE ID
+	// are only verified with the bundle of its trust domain.
+	SPIFFE map[string]SPIFFEOptions
+	// X5C are the options for verifying JWTs with the certificate chain in their `x5c` header.
+	X5C X5COptions
+}
+
+// NewProxy creates a new JWKS client proxy that only verifies JWTs with the given remote JWK Set resources. Use
+// NewProxyWithOptions for the other key sources, policies, and validation options.
 func NewProxy(multiple map[string]keyfunc.Options, options keyfunc.MultipleOptions) (Proxy, error) {
-	if len(multiple) == 0 {
+	return NewProxyWithOptions(multiple, ProxyOptions{Multiple: options})
+}
+
+// NewProxyWithOptions creates a new JWKS client proxy.
+//
+// JWK Set URLs with the file scheme are read from the local filesystem. They are re-read on each refresh, so changes to
+// the file are picked up automatically.
+func NewProxyWithOptions(multiple map[string]keyfunc.Options, options ProxyOptions) (Proxy, error) {
+	if len(multiple) == 0 && len(options.HMAC) == 0 && len(options.Inline) == 0 && len(options.PEM) == 0 &&
+		len(options.PEMMaps) == 0 && len(options.KeyURLs) == 0 && len(options.Kubernetes) == 0 && len(options.Presets) == 0 && len(options.Issuers.Patterns) == 0 &&
+		len(options.JKU.Prefixes) == 0 && len(options.SPIFFE) == 0 && options.X5C.CABundle == "" {
 		return nil, fmt.Errorf("failed to create proxy, no remote JWK Set resources: %w", ErrNoConfiguration)
 	}
 
-	var k keyfuncer
-	if len(multiple) == 1 {
-		for u, opt := range multiple {
+	var k keyfuncers
+	for name, raw := range options.Inline {
+		jwks, err := keyfunc.NewJSON(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse inline JWK Set %q: %w", name, err)
+		}
+		k = append(k, jwks)
+	}
+
+	for u, opt := range options.PEM {
+		source, err := newPEMKeySource(u, opt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get PEM key source %q: %w", u, err)
+		}
+		k = append(k, source)
+	}
+
+	remote := make(map[string]keyfunc.Options, len(multiple))
+	for u, opt := range multiple {
+		if IsFileURL(u) {
+			// Outbound HTTP client settings do not apply to the local filesystem.
+			opt.Client = fileClient
+		}
+		remote[u] = opt
+	}
+	remoteJWKS := make(map[string]*keyfunc.JWKS, len(remote))
+	if len(remote) == 1 {
+		for u, opt := range remote {
 			jwks, err := keyfunc.Get(u, opt)
 			if err != nil {
 				return nil, fmt.Errorf("failed to get JWKS: %w", err)
 			}
-			k = jwks
+			k = append(k, jwks)
+			remoteJWKS[u] = jwks
 			break
 		}
-	} else {
-		m, err := keyfunc.GetMultiple(multiple, options)
+	} else if len(remote) > 1 {
+		m, err := keyfunc.GetMultiple(remote, options.Multiple)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get JWKS: %w", err)
 		}
-		k = m
+		k = append(k, m)
+		remoteJWKS = m.JWKSets()
+	}
+
+	// Sources that fetch for unknown key IDs are tried last.
+	for u, opt := range options.PEMMaps {
+		source, err := newPEMMapKeySource(u, opt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create PEM map key source %q: %w", u, err)
+		}
+		k = append(k, source)
+	}
+	for template, opt := range options.KeyURLs {
+		source, err := newKeyURLKeySource(template, opt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create key URL key source %q: %w", template, err)
+		}
+		k = append(k, source)
+	}
+
+	if options.DPoP.ClockSkew == 0 {
+		options.DPoP.ClockSkew = DefaultDPoPClockSkew
+	}
+	if options.DPoP.ProofMaxAge == 0 {
+		options.DPoP.ProofMaxAge = DefaultDPoPProofMaxAge
+	}
+
+	if options.ExpressionCostLimit == 0 {
+		options.ExpressionCostLimit = DefaultExpressionCostLimit
+	}
+	env, err := newExpressionEnv()
+	if err != nil {
+		return nil, err
+	}
+	expressions := make(map[string][]expression)
+
+	for name, policy := range options.Policies {
+		for _, source := range policy.Expressions {
+			e, err := compileExpression(env, source, options.ExpressionCostLimit)
+			if err != nil {
+				return nil, fmt.Errorf("%w: policy %q: %s", ErrInvalidConfig, name, err)
+			}
+			expressions[name] = append(expressions[name], e)
+		}
+		if policy.RevokeSessions && (policy.Profile != ProfileLogoutToken || options.Denylist == nil) {
+			return nil, fmt.Errorf("policy %q revokes sessions without the %q profile or a denylist: %w", name, ProfileLogoutToken, ErrInvalidConfig)
+		}
+		if (len(policy.Namespaces) != 0 || len(policy.ServiceAccounts) != 0 || policy.RequirePod) && policy.Profile != ProfileKubernetes {
+			return nil, fmt.Errorf("policy %q has Kubernetes requirements without the %q profile: %w", name, ProfileKubernetes, ErrInvalidConfig)
+		}
+		for _, pattern := range policy.SPIFFEIDs {
+			err := validateSPIFFEIDPattern(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%w: policy %q: %s", ErrInvalidConfig, name, err)
+			}
+		}
+		if policy.MaxDelegationDepth < 0 {
+			return nil, fmt.Errorf("policy %q has a negative maximum delegation depth: %w", name, ErrInvalidConfig)
+		}
+		if len(pipelinePatterns(policy)) != 0 && !isPreset(policy.Profile) {
+			return nil, fmt.Errorf("policy %q has CI/CD pipeline rules without a CI/CD profile: %w", name, ErrInvalidConfig)
+		}
+		if isPreset(policy.Profile) && isHostedPreset(policy.Profile, options.Presets[policy.Profile].Issuer) && len(policy.Repositories) == 0 {
+			return nil, fmt.Errorf("policy %q has no repositories for the hosted issuer of its CI/CD profile: %w", name, ErrInvalidConfig)
+		}
+		for _, pattern := range pipelinePatterns(policy) {
+			err := validatePipelinePattern(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%w: policy %q: %s", ErrInvalidConfig, name, err)
+			}
+		}
 	}
 
 	p := proxy{
-		keyfuncer: k,
+		denylist:            options.Denylist,
+		dpop:                options.DPoP,
+		expressionCostLimit: options.ExpressionCostLimit,
+		expressionEnv:       env,
+		expressions:         expressions,
+		inlineJWKS:          options.Inline,
+		keyfuncer:           k,
+		keyfuncers:          len(k),
+		policies:            options.Policies,
+		remoteJWKS:          remoteJWKS,
+		replayStore:         options.ReplayStore,
+	}
+	if len(options.HMAC) != 0 {
+		h, err := newHMACKeySource(options.HMAC)
+		if err != nil {
+			return nil, err
+		}
+		p.hmac = &h
+	}
+	if len(options.JWE.Keys) != 0 {
+		d, err := newJWEDecrypter(options.JWE)
+		if err != nil {
+			return nil, err
+		}
+		p.jwe = d
+	}
+	p.issuerJWKS = make(map[string]*keyfunc.JWKS, len(options.Kubernetes)+len(options.Presets))
+	p.kubernetes = make(map[string]bool, len(options.Kubernetes))
+	for iss, opt := range options.Kubernetes {
+		jwks, err := newKubernetesJWKS(iss, opt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Kubernetes key source: %w", err)
+		}
+		p.issuerJWKS[iss] = jwks
+		p.kubernetes[iss] = true
+	}
+	p.presets = make(map[string]string, len(options.Presets))
+	for profile, opt := range options.Presets {
+		iss, jwks, err := newPresetJWKS(profile, opt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create CI/CD preset key source: %w", err)
+		}
+		if _, ok := p.issuerJWKS[iss]; ok {
+			return nil, fmt.Errorf("issuer %q of preset %q is already configured: %w", iss, profile, ErrInvalidConfig)
+		}
+		p.issuerJWKS[iss] = jwks
+		p.presets[profile] = iss
+	}
+	if len(options.Issuers.Patterns) != 0 {
+		i, err := newIssuerKeySource(options.Issuers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create issuer key source: %w", err)
+		}
+		p.issuers = i
+	}
+	if len(options.JKU.Prefixes) != 0 {
+		j, err := newJKUKeySource(options.JKU)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create jku key source: %w", err)
+		}
+		p.jku = j
+	}
+	if len(options.SPIFFE) != 0 {
+		s, err := newSPIFFEKeySource(options.SPIFFE)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create SPIFFE key source: %w", err)
+		}
+		p.spiffe = s
+	}
+	if options.X5C.CABundle != "" {
+		x, err := newX5CKeySource(options.X5C)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create x5c key source: %w", err)
+		}
+		p.x5c = x
 	}
 
 	return p, nil
 }
 
+// keySource identifies the key source that verified a JWT.
+type keySource int
+
+const (
+	// keySourceDefault is the inline, remote, PEM, PEM map, and key URL key sources.
+	keySourceDefault keySource = iota
+	keySourceHMAC
+	// keySourceIssuer is the JWK Set of a Kubernetes cluster or CI/CD provider.
+	keySourceIssuer
+	keySourceIssuerPattern
+	keySourceJKU
+	keySourceSPIFFE
+	keySourceX5C
+)
+
+// keyfunc only uses shared secrets for JWTs with an HMAC `alg` header and only uses asymmetric keys otherwise. This
+// prevents algorithm confusion attacks. The key source used is written to source, so checks that trust a key source
+// only apply to the JWTs it verified.
+func (p proxy) keyfunc(source *keySource) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if isHMAC(token.Method) {
+			if p.hmac == nil {
+				return nil, fmt.Errorf("%w: HMAC verification is disabled", ErrHMACNotAllowed)
+			}
+			*source = keySourceHMAC
+			return p.hmac.Keyfunc(token)
+		}
+		var err error
+		var key interface{}
+		key, *source, err = p.asymmetricKey(token)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := key.([]byte); ok {
+			return nil, fmt.Errorf("%w: symmetric key found for alg %q", ErrAlgorithmConfusion, token.Method.Alg())
+		}
+		return key, nil
+	}
+}
+
+// asymmetricKey finds the key for a JWT without an HMAC `alg` header and the key source it is from. When enabled, JWTs
+// with an `x5c` or `jku` header are only verified with the key of their certificate chain or JWK Set, JWTs with a
+// SPIFFE ID subject are only verified with the bundle of its trust domain, and JWTs from a Kubernetes cluster, a CI/CD
+// provider, or an issuer matching a pattern are only verified with that issuer's JWK Set.
+func (p proxy) asymmetricKey(token *jwt.Token) (interface{}, keySource, error) {
+	if p.x5c != nil && hasX5C(token) {
+		key, err := p.x5c.Keyfunc(token)
+		return key, keySourceX5C, err
+	}
+	if p.jku != nil && hasJKU(token) {
+		key, err := p.jku.Keyfunc(token)
+		return key, keySourceJKU, err
+	}
+	if p.spiffe != nil && isSPIFFEID(token) {
+		key, err := p.spiffe.Keyfunc(token)
+		return key, keySourceSPIFFE, err
+	}
+	if jwks, ok := p.issuerJWKS[tokenIssuer(token)]; ok {
+		key, err := jwks.Keyfunc(token)
+		return key, keySourceIssuer, err
+	}
+	if p.issuers != nil && (p.keyfuncers == 0 || p.issuers.matches(token)) {
+		key, err := p.issuers.Keyfunc(token)
+		return key, keySourceIssuerPattern, err
+	}
+	key, err := p.keyfuncer.Keyfunc(token)
+	return key, keySourceDefault, err
+}
+
+var fileClient = &http.Client{
+	Transport: http.NewFileTransport(http.Dir("/")),
+}
+
+// IsFileURL reports whether the URL has the `file` scheme. Such URLs are read from the local filesystem instead of
+// fetched over HTTP.
+func IsFileURL(u string) bool {
+	parsed, err := url.Parse(u)
+	return err == nil && parsed.Scheme == schemeFile
+}
+
 // Validate helps implement the Proxy interface.
-func (p proxy) Validate(_ context.Context, args ValidateArgs) (ValidateResults, error) {
-	claims := jwt.RegisteredClaims{}
-	t, err := jwt.ParseWithClaims(args.Token, &claims, p.keyfuncer.Keyfunc)
+func (p proxy) Validate(ctx context.Context, args ValidateArgs) (ValidateResults, error) {
+	policy, err := p.policy(args.Policy)
+	if err != nil {
+		return ValidateResults{}, err
+	}
+	profileName, err := profile(args, policy)
+	if err != nil {
+		return ValidateResults{}, err
+	}
+	raw := args.Token
+	if isJWE(raw) {
+		if p.jwe == nil {
+			return ValidateResults{}, fmt.Errorf("%w: encrypted tokens are not accepted", ErrJWE)
+		}
+		raw, err = p.jwe.decrypt(raw)
+		if err != nil {
+			return ValidateResults{}, err
+		}
+	}
+	claims := tokenClaims{}
+	var source keySource
+	t, err := jwt.ParseWithClaims(raw, &claims, p.keyfunc(&source))
 	if err != nil || !t.Valid {
 		return ValidateResults{}, fmt.Errorf("failed to parse token: %w", err)
 	}
-	const errMsg = "registered claim %q did not match any values in the required set: %w"
-	if len(args.Aud) > 0 {
-		ok := false
-		for _, aud := range args.Aud {
-			ok = claims.VerifyAudience(aud, true)
-			if ok {
-				break
-			}
+	if p.denylist != nil {
+		kid, _ := t.Header[headerKID].(string)
+		err = p.denylist.check(kid, &claims)
+		if err != nil {
+			return ValidateResults{}, err
 		}
-		if !ok {
-			return ValidateResults{}, fmt.Errorf(errMsg, audClaim, ErrClaimCheck)
+	}
+	err = checkRegisteredClaims(&claims.RegisteredClaims, args.Aud, args.Iss, args.Sub)
+	if err != nil {
+		return ValidateResults{}, err
+	}
+	err = checkRegisteredClaims(&claims.RegisteredClaims, policy.Aud, policy.Iss, policy.Sub)
+	if err != nil {
+		return ValidateResults{}, err
+	}
+	err = checkDelegation(policy, &claims)
+	if err != nil {
+		return ValidateResults{}, err
+	}
+	err = checkProfile(profileName, args, policy, t, &claims)
+	if err != nil {
+		return ValidateResults{}, err
+	}
+	err = p.checkPresetIssuer(profileName, source, &claims)
+	if err != nil {
+		return ValidateResults{}, err
+	}
+	err = p.checkKubernetesIssuer(profileName, source, &claims)
+	if err != nil {
+		return ValidateResults{}, err
+	}
+	var pipeline *Pipeline
+	if isPreset(profileName) {
+		pipeline, err = p.checkPreset(profileName, args, policy, &claims)
+		if err != nil {
+			return ValidateResults{}, err
 		}
 	}
-	if len(args.Iss) > 0 {
-		ok := false
-		for _, iss := range args.Iss {
-			ok = claims.Issuer == iss
-			if ok {
-				break
-			}
+	err = p.checkExpressions(ctx, args, args.Policy, raw, t)
+	if err != nil {
+		return ValidateResults{}, err
+	}
+	var records []replayRecord
+	if args.RejectReplay || policy.RejectReplay {
+		r, err := p.checkReplay(&claims.RegisteredClaims)
+		if err != nil {
+			return ValidateResults{}, err
 		}
-		if !ok {
-			return ValidateResults{}, fmt.Errorf(errMsg, issClaim, ErrClaimCheck)
+		records = append(records, r)
+	}
+	proof, err := p.checkDPoP(args, &claims)
+	if err != nil {
+		return ValidateResults{}, err
+	}
+	if proof != nil {
+		records = append(records, *proof)
+	}
+	err = checkCertificateBinding(args, &claims)
+	if err != nil {
+		return ValidateResults{}, err
+	}
+	spiffeID, err := p.checkSPIFFE(policy, source, &claims)
+	if err != nil {
+		return ValidateResults{}, err
+	}
+
+	// Checks that change state run last, so a JWT that fails any other check changes nothing.
+	for _, r := range records {
+		err = p.record(ctx, r)
+		if err != nil {
+			return ValidateResults{}, err
+		}
+	}
+	if policy.RevokeSessions {
+		err = p.revokeSession(&claims)
+		if err != nil {
+			return ValidateResults{}, err
+		}
+	}
+	results := ValidateResults{
+		Act:      claims.Act,
+		Pipeline: pipeline,
+		SPIFFEID: spiffeID,
+	}
+	if source == keySourceX5C {
+		// The chain was verified by the keyfunc.
+		certs, err := x5cChain(t)
+		if err != nil {
+			return ValidateResults{}, err
 		}
+		results.CertificateSubject = certs[0].Subject.String()
+	}
+	if profileName == ProfileKubernetes {
+		results.Kubernetes = claims.Kubernetes
+	}
+	if profileName == ProfileSecurityEvent {
+		results.SecurityEvent = newSecurityEvent(&claims)
 	}
-	if len(args.Sub) > 0 {
+	return results, nil
+}
+
+// checkRegisteredClaims confirms the registered claims match at least one value of each non-empty set.
+func checkRegisteredClaims(claims *jwt.RegisteredClaims, auds, issuers, subs []string) error {
+	const errMsg = "registered claim %q did not match any values in the required set: %w"
+	if len(auds) > 0 {
 		ok := false
-		for _, sub := range args.Sub {
-			ok = claims.Subject == sub
+		for _, aud := range auds {
+			ok = claims.VerifyAudience(aud, true)
 			if ok {
 				break
 			}
 		}
 		if !ok {
-			return ValidateResults{}, fmt.Errorf(errMsg, subClaim, ErrClaimCheck)
+			return fmt.Errorf(errMsg, audClaim, ErrClaimCheck)
 		}
 	}
-	return ValidateResults{}, nil
+	if len(issuers) > 0 && !contains(issuers, claims.Issuer) {
+		return fmt.Errorf(errMsg, issClaim, ErrClaimCheck)
+	}
+	if len(subs) > 0 && !contains(subs, claims.Subject) {
+		return fmt.Errorf(errMsg, subClaim, ErrClaimCheck)
+	}
+	return nil
 }
@@ -2,8 +2,13 @@ package jcp_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"io"
+	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -83,6 +88,86 @@ func TestNewProxy(t *testing.T) {
 	}
 }
 
+func TestNewProxyWithOptions(t *testing.T) {
+	var syntaxErr *json.SyntaxError
+	var urlErr *url.Error
+	testCases := []struct {
+		err      error
+		errAs    any
+		multiple map[string]keyfunc.Options
+		name     string
+		options  jcp.ProxyOptions
+	}{
+		{
+			err:  jcp.ErrNoConfiguration,
+			name: "Empty",
+		},
+		{
+			multiple: map[string]keyfunc.Options{
+				jwksServer.URL: {},
+			},
+			name: "Single",
+		},
+		{
+			multiple: map[string]keyfunc.Options{
+				"": {},
+			},
+			errAs: urlErr,
+			name:  "SingleBadURL",
+		},
+		{
+			multiple: map[string]keyfunc.Options{
+				jwksServer.URL:               {},
+				jwksServer.URL + "/anything": {},
+			},
+			name: "Multiple",
+		},
+		{
+			multiple: map[string]keyfunc.Options{
+				jwksServer.URL: {},
+				"":             {},
+			},
+			errAs: urlErr,
+			name:  "MultipleBadURL",
+		},
+		{
+			name: "InlineOnly",
+			options: jcp.ProxyOptions{
+				Inline: map[string]json.RawMessage{
+					anyNonEmptyString: json.RawMessage(`{"keys":[]}`),
+				},
+			},
+		},
+		{
+			errAs: syntaxErr,
+			name:  "InlineBadJSON",
+			options: jcp.ProxyOptions{
+				Inline: map[string]json.RawMessage{
+					anyNonEmptyString: json.RawMessage(anyOtherString),
+				},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			proxy, err := jcp.NewProxyWithOptions(tc.multiple, tc.options)
+			if err != nil || tc.err != nil || tc.errAs != nil {
+				if errors.Is(err, tc.err) {
+					return
+				}
+				if tc.errAs != nil && errors.As(err, &tc.errAs) {
+					return
+				}
+				t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+			}
+			if proxy == nil {
+				t.Fatal("Expected proxy, got nil.")
+			}
+		})
+	}
+}
+
 func TestProxy_Validate(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
@@ -90,7 +175,7 @@ func TestProxy_Validate(t *testing.T) {
 	multiple := map[string]keyfunc.Options{
 		jwksServer.URL: {},
 	}
-	proxy, err := jcp.NewProxy(multiple, keyfunc.MultipleOptions{})
+	proxy, err := jcp.NewProxyWithOptions(multiple, jcp.ProxyOptions{})
 	if err != nil {
 		t.Fatalf("Failed to create proxy: %v.", err)
 	}
@@ -254,3 +339,98 @@ func TestProxy_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestProxy_FileJWKS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := http.Get(jwksServer.URL)
+	if err != nil {
+		t.Fatalf("Failed to get JWK Set: %v.", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+	rawJWKS, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read JWK Set: %v.", err)
+	}
+
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	err = os.WriteFile(jwksPath, []byte(`{"keys":[]}`), 0600)
+	if err != nil {
+		t.Fatalf("Failed to write JWK Set file: %v.", err)
+	}
+
+	multiple := map[string]keyfunc.Options{
+		"file://" + jwksPath: {
+			Client:          &http.Client{Timeout: time.Second},
+			RefreshInterval: 10 * time.Millisecond,
+		},
+	}
+	proxy, err := jcp.NewProxyWithOptions(multiple, jcp.ProxyOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	j := jwt.New(jwt.SigningMethodEdDSA)
+	j.Header[headerKID] = testKID
+	token, err := j.SignedString(privateKey)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v.", err)
+	}
+	args := jcp.ValidateArgs{
+		Token: token,
+	}
+
+	_, err = proxy.Validate(ctx, args)
+	if !errors.Is(err, keyfunc.ErrKIDNotFound) {
+		t.Fatalf("Expected error %v, got %v.", keyfunc.ErrKIDNotFound, err)
+	}
+
+	err = os.WriteFile(jwksPath, rawJWKS, 0600)
+	if err != nil {
+		t.Fatalf("Failed to write JWK Set file: %v.", err)
+	}
+	for {
+		_, err = proxy.Validate(ctx, args)
+		if err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Changes to JWK Set file were not picked up: %v.", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestIsFileURL(t *testing.T) {
+	testCases := []struct {
+		expected bool
+		name     string
+		u        string
+	}{
+		{
+			expected: true,
+			name:     "File",
+			u:        "file:///etc/jcp/jwks.json",
+		},
+		{
+			expected: true,
+			name:     "UpperCaseScheme",
+			u:        "FILE:///etc/jcp/jwks.json",
+		},
+		{
+			name: "HTTPS",
+			u:    validURL,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := jcp.IsFileURL(tc.u); actual != tc.expected {
+				t.Fatalf("Expected %t, got %t.", tc.expected, actual)
+			}
+		})
+	}
+}
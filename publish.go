@@ -0,0 +1,98 @@
+package jcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultJWKSMaxAge is the default duration clients may cache the published JWK Set for.
+	DefaultJWKSMaxAge = 5 * time.Minute
+	ktyMember         = "kty"
+)
+
+// jwksPublisher publishes the public keys of the JWK Sets a Proxy holds.
+type jwksPublisher interface {
+	publicJWKS(iss string) ([]byte, error)
+}
+
+// publishedJWKS is a JWK Set whose keys are kept as raw JSON, so members JCP does not parse are republished as is.
+type publishedJWKS struct {
+	Keys []map[string]json.RawMessage `json:"keys"`
+}
+
+// publicJWKS returns a JWK Set of the public keys held from the inline and remote JWK Sets. When iss is not empty, only
+// the keys of the Kubernetes, CI/CD preset, or issuer pattern JWK Set held for that issuer are returned. These JWK Sets
+// are only trusted for their issuer, so they are left out of the merged JWK Set, and they are never fetched to answer a
+// request. Keys from PEM data, PEM maps, and key URLs are not JWK Sets, so they are never returned.
+func (p proxy) publicJWKS(iss string) ([]byte, error) {
+	if iss != "" {
+		jwks, ok := p.issuerJWKS[iss]
+		if !ok && p.issuers != nil {
+			jwks, ok = p.issuers.cache.peek(iss)
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: no JWK Set is held for issuer %q", ErrUntrustedIssuer, iss)
+		}
+		return mergeJWKS([][]byte{jwks.RawJWKS()})
+	}
+
+	var sets [][]byte
+	for _, name := range sortedKeys(p.inlineJWKS) {
+		sets = append(sets, p.inlineJWKS[name])
+	}
+	for _, u := range sortedKeys(p.remoteJWKS) {
+		sets = append(sets, p.remoteJWKS[u].RawJWKS())
+	}
+	return mergeJWKS(sets)
+}
+
+// mergeJWKS merges the keys of the raw JWK Sets in order. Private members are removed, symmetric keys are left out, and
+// duplicate keys are only included once.
+func mergeJWKS(sets [][]byte) ([]byte, error) {
+	merged := publishedJWKS{
+		Keys: make([]map[string]json.RawMessage, 0),
+	}
+	seen := make(map[string]bool)
+	for _, raw := range sets {
+		if len(raw) == 0 {
+			continue
+		}
+		var set publishedJWKS
+		err := json.Unmarshal(raw, &set)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JWK Set: %w", err)
+		}
+		for _, key := range set.Keys {
+			var kty string
+			_ = json.Unmarshal(key[ktyMember], &kty)
+			if kty == "" || kty == ktyOct {
+				continue
+			}
+			for _, member := range privateJWKMembers {
+				delete(key, member)
+			}
+			data, err := json.Marshal(key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal JWK: %w", err)
+			}
+			if seen[string(data)] {
+				continue
+			}
+			seen[string(data)] = true
+			merged.Keys = append(merged.Keys, key)
+		}
+	}
+	return json.Marshal(merged)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,195 @@
+package jcp_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+
+	"github.com/MicahParks/jcp"
+)
+
+func TestHTTPHandler_JWKS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v.", err)
+	}
+	encode := base64.RawURLEncoding.EncodeToString
+	inline := fmt.Sprintf(`{"keys":[{"kty":"EC","kid":"private-ec","crv":"P-256","x":%q,"y":%q,"d":%q},{"kty":"oct","kid":"shared","k":"c2VjcmV0"}]}`,
+		encode(ecKey.X.FillBytes(make([]byte, 32))), encode(ecKey.Y.FillBytes(make([]byte, 32))), encode(ecKey.D.FillBytes(make([]byte, 32))))
+
+	tenantKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v.", err)
+	}
+	tenant := fmt.Sprintf(`{"keys":[{"kty":"EC","kid":"tenant","crv":"P-256","x":%q,"y":%q}]}`,
+		encode(tenantKey.X.FillBytes(make([]byte, 32))), encode(tenantKey.Y.FillBytes(make([]byte, 32))))
+	var mux sync.Mutex
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		fetches++
+		mux.Unlock()
+		_, _ = w.Write([]byte(tenant))
+	}))
+	defer server.Close()
+
+	// Keys that are not from a JWK Set are not published.
+	pemCert := createCA(t)
+	pemMap, err := json.Marshal(map[string]string{"pem-map": string(certPEM(pemCert))})
+	if err != nil {
+		t.Fatalf("Failed to marshal PEM map: %v.", err)
+	}
+	keyURLDir := filepath.Dir(writeTemp(t, "key-url.pem", certPEM(pemCert)))
+
+	proxy, err := jcp.NewProxyWithOptions(map[string]keyfunc.Options{jwksServer.URL: {}}, jcp.ProxyOptions{
+		Inline: map[string]json.RawMessage{"inline": json.RawMessage(inline)},
+		Issuers: jcp.IssuersOptions{
+			Patterns: map[string]jcp.IssuerPattern{
+				"https://{tenant}.idp.example.com/": {JWKSURL: server.URL},
+			},
+		},
+		KeyURLs: map[string]jcp.KeyURLOptions{
+			"file://" + keyURLDir + "/{kid}.pem": {},
+		},
+		PEM: map[string]jcp.PEMOptions{
+			"file://" + writeTemp(t, "key.pem", certPEM(pemCert)): {KID: pemKID},
+		},
+		PEMMaps: map[string]jcp.PEMMapOptions{
+			"file://" + writeTemp(t, "keys.json", pemMap): {},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	// Validating a token fetches and holds the JWK Set of its issuer, even when its key is not found.
+	j := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.RegisteredClaims{Issuer: "https://acme.idp.example.com/"})
+	j.Header[headerKID] = testKID
+	token, err := j.SignedString(privateKey)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v.", err)
+	}
+	_, _ = proxy.Validate(ctx, jcp.ValidateArgs{Token: token})
+
+	// Validating a token fetches and holds the key of a key URL.
+	j = jwt.NewWithClaims(jwt.SigningMethodES256, jwt.RegisteredClaims{})
+	j.Header[headerKID] = "key-url"
+	token, err = j.SignedString(pemCert.private)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v.", err)
+	}
+	_, err = proxy.Validate(ctx, jcp.ValidateArgs{Token: token})
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v.", err)
+	}
+	handler := jcp.HTTPHandler{
+		Logger: zap.NewNop(),
+		Proxy:  proxy,
+	}
+
+	testCases := []struct {
+		iss    string
+		kids   []string
+		name   string
+		status int
+	}{
+		{
+			kids: []string{"private-ec", testKID},
+			name: "Merged",
+		},
+		{
+			iss:  "https://acme.idp.example.com/",
+			kids: []string{"tenant"},
+			name: "Issuer",
+		},
+		{
+			iss:    "https://other.idp.example.com/",
+			name:   "IssuerNotHeld",
+			status: http.StatusNotFound,
+		},
+		{
+			iss:    "https://other.example.com/",
+			name:   "UnknownIssuer",
+			status: http.StatusNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			target := "/v1/jwks.json"
+			if tc.iss != "" {
+				target += "?iss=" + url.QueryEscape(tc.iss)
+			}
+			w := httptest.NewRecorder()
+			handler.JWKS().ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+			if tc.status == 0 {
+				tc.status = http.StatusOK
+			}
+			if w.Code != tc.status {
+				t.Fatalf("Expected status code %d, got %d: %s.", tc.status, w.Code, w.Body.String())
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+			if w.Header().Get(jcp.HeaderCacheControl) != "public, max-age=300" {
+				t.Fatalf("Unexpected %s: %q.", jcp.HeaderCacheControl, w.Header().Get(jcp.HeaderCacheControl))
+			}
+
+			var jwks struct {
+				Keys []map[string]interface{} `json:"keys"`
+			}
+			err := json.Unmarshal(w.Body.Bytes(), &jwks)
+			if err != nil {
+				t.Fatalf("Failed to parse JWK Set: %v.", err)
+			}
+			kids := make(map[string]bool)
+			for _, key := range jwks.Keys {
+				if _, ok := key["d"]; ok {
+					t.Fatalf("Expected private members to be removed, got %v.", key)
+				}
+				kids[key["kid"].(string)] = true
+			}
+			if len(jwks.Keys) != len(tc.kids) {
+				t.Fatalf("Expected keys %v, got %v.", tc.kids, kids)
+			}
+			for _, kid := range tc.kids {
+				if !kids[kid] {
+					t.Fatalf("Expected keys %v, got %v.", tc.kids, kids)
+				}
+			}
+
+			etag := w.Header().Get(jcp.HeaderETag)
+			r := httptest.NewRequest(http.MethodGet, target, nil)
+			r.Header.Set(jcp.HeaderIfNoneMatch, etag)
+			w = httptest.NewRecorder()
+			handler.JWKS().ServeHTTP(w, r)
+			if w.Code != http.StatusNotModified || w.Header().Get(jcp.HeaderETag) != etag {
+				t.Fatalf("Expected status code %d with ETag %s, got %d with ETag %s.", http.StatusNotModified, etag, w.Code, w.Header().Get(jcp.HeaderETag))
+			}
+		})
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	if fetches != 1 {
+		t.Fatalf("Expected only the JWK Set fetched to validate a token to be fetched, got %d fetches.", fetches)
+	}
+}
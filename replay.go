@@ -0,0 +1,139 @@
+package jcp
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// DefaultReplayMaxEntries is the default maximum number of JWT IDs held by a MemoryReplayStore.
+const DefaultReplayMaxEntries = 100_000
+
+var (
+	// ErrReplay is returned when a JWT that must only be used once has already been accepted.
+	ErrReplay = errors.New("token has already been used")
+	// ErrReplayStoreFull is returned when a replay store can not record another JWT ID.
+	ErrReplayStoreFull = errors.New("replay store is full")
+)
+
+// ReplayStore records the JWT IDs of accepted JWTs to detect replays.
+type ReplayStore interface {
+	// Record stores the key until it expires. It returns false if the key was already recorded and has not expired.
+	Record(ctx context.Context, key string, expires time.Time) (bool, error)
+}
+
+// MemoryReplayStore is an in-memory ReplayStore with a maximum number of entries. Expired entries are pruned to make
+// room for new ones. When every entry is still unexpired, new JWT IDs are refused with ErrReplayStoreFull rather than
+// forgetting a JWT ID that could still be replayed.
+type MemoryReplayStore struct {
+	entries    map[string]time.Time
+	expiry     expiryHeap
+	maxEntries int
+	mux        sync.Mutex
+}
+
+// NewMemoryReplayStore creates a new MemoryReplayStore that holds at most maxEntries JWT IDs.
+func NewMemoryReplayStore(maxEntries int) *MemoryReplayStore {
+	if maxEntries <= 0 {
+		maxEntries = DefaultReplayMaxEntries
+	}
+	return &MemoryReplayStore{
+		entries:    make(map[string]time.Time),
+		maxEntries: maxEntries,
+	}
+}
+
+// Record helps implement the ReplayStore interface.
+func (m *MemoryReplayStore) Record(_ context.Context, key string, expires time.Time) (bool, error) {
+	now := time.Now()
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	for len(m.expiry) > 0 && now.After(m.expiry[0].expires) {
+		e := heap.Pop(&m.expiry).(expiryEntry)
+		if m.entries[e.key].Equal(e.expires) {
+			delete(m.entries, e.key)
+		}
+	}
+
+	if prev, ok := m.entries[key]; ok && !now.After(prev) {
+		return false, nil
+	}
+	if len(m.entries) >= m.maxEntries {
+		return false, fmt.Errorf("%w: %d entries", ErrReplayStoreFull, m.maxEntries)
+	}
+	m.entries[key] = expires
+	heap.Push(&m.expiry, expiryEntry{expires: expires, key: key})
+	return true, nil
+}
+
+// Len returns the number of JWT IDs held.
+func (m *MemoryReplayStore) Len() int {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return len(m.entries)
+}
+
+type expiryEntry struct {
+	expires time.Time
+	key     string
+}
+
+type expiryHeap []expiryEntry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+func (h expiryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x any)        { *h = append(*h, x.(expiryEntry)) }
+func (h *expiryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	*h = old[:n-1]
+	return e
+}
+
+// replayRecord is an ID to record in the ReplayStore. IDs are only recorded after every other check has passed, so a
+// JWT that fails a check, such as a stolen sender-constrained JWT without its key, does not use up its ID.
+type replayRecord struct {
+	expires time.Time
+	key     string
+	// replayed is returned when the ID has already been recorded.
+	replayed error
+}
+
+// checkReplay confirms the JWT ID of an accepted JWT can be recorded scoped by its issuer and returns its record. The
+// JWT must have the `jti` and `exp` claims so its record can be forgotten once it expires.
+func (p proxy) checkReplay(claims *jwt.RegisteredClaims) (replayRecord, error) {
+	if p.replayStore == nil {
+		return replayRecord{}, fmt.Errorf("%w: replay detection requested without a replay store", ErrNoConfiguration)
+	}
+	if claims.ID == "" {
+		return replayRecord{}, fmt.Errorf("registered claim %q is required for replay detection: %w", jtiClaim, ErrClaimCheck)
+	}
+	if claims.ExpiresAt == nil {
+		return replayRecord{}, fmt.Errorf("registered claim %q is required for replay detection: %w", expClaim, ErrClaimCheck)
+	}
+	return replayRecord{
+		expires:  claims.ExpiresAt.Time,
+		key:      claims.Issuer + "\x00" + claims.ID,
+		replayed: fmt.Errorf("%w: JWT ID %q from issuer %q", ErrReplay, claims.ID, claims.Issuer),
+	}, nil
+}
+
+// record records the ID in the ReplayStore. It returns the record's replayed error if the ID was already recorded.
+func (p proxy) record(ctx context.Context, r replayRecord) error {
+	ok, err := p.replayStore.Record(ctx, r.key, r.expires)
+	if err != nil {
+		return fmt.Errorf("failed to record ID: %w", err)
+	}
+	if !ok {
+		return r.replayed
+	}
+	return nil
+}
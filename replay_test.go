@@ -0,0 +1,147 @@
+package jcp_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/MicahParks/jcp"
+)
+
+const oneTimePolicy = "oneTime"
+
+func TestProxy_RejectReplay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	proxy, err := jcp.NewProxyWithOptions(map[string]keyfunc.Options{jwksServer.URL: {}}, jcp.ProxyOptions{
+		Policies: map[string]jcp.Policy{
+			oneTimePolicy: {
+				Aud:          []string{anyNonEmptyString},
+				RejectReplay: true,
+			},
+		},
+		ReplayStore: jcp.NewMemoryReplayStore(0),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	exp := jwt.NewNumericDate(time.Now().Add(time.Minute))
+	sign := func(claims jwt.RegisteredClaims) string {
+		j := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		j.Header[headerKID] = testKID
+		token, err := j.SignedString(privateKey)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return token
+	}
+	policyToken := sign(jwt.RegisteredClaims{Audience: jwt.ClaimStrings{anyNonEmptyString}, ExpiresAt: exp, ID: anyNonEmptyString})
+	requestToken := sign(jwt.RegisteredClaims{ExpiresAt: exp, ID: anyOtherString})
+	otherIssuer := sign(jwt.RegisteredClaims{ExpiresAt: exp, ID: anyOtherString, Issuer: anyNonEmptyString})
+	noJTI := sign(jwt.RegisteredClaims{ExpiresAt: exp})
+	noExp := sign(jwt.RegisteredClaims{ID: anyNonEmptyString})
+	wrongAud := sign(jwt.RegisteredClaims{ExpiresAt: exp, ID: testKID})
+
+	testCases := []struct {
+		args jcp.ValidateArgs
+		err  error
+		name string
+	}{
+		{
+			args: jcp.ValidateArgs{Policy: oneTimePolicy, Token: policyToken},
+			name: "PolicyFirstUse",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: oneTimePolicy, Token: policyToken},
+			err:  jcp.ErrReplay,
+			name: "PolicyReplay",
+		},
+		{
+			args: jcp.ValidateArgs{Token: policyToken},
+			name: "PolicyTokenWithoutReplayDetection",
+		},
+		{
+			args: jcp.ValidateArgs{RejectReplay: true, Token: requestToken},
+			name: "RequestFirstUse",
+		},
+		{
+			args: jcp.ValidateArgs{RejectReplay: true, Token: requestToken},
+			err:  jcp.ErrReplay,
+			name: "RequestReplay",
+		},
+		{
+			args: jcp.ValidateArgs{RejectReplay: true, Token: otherIssuer},
+			name: "SameJTIOtherIssuer",
+		},
+		{
+			args: jcp.ValidateArgs{RejectReplay: true, Token: noJTI},
+			err:  jcp.ErrClaimCheck,
+			name: "NoJTI",
+		},
+		{
+			args: jcp.ValidateArgs{RejectReplay: true, Token: noExp},
+			err:  jcp.ErrClaimCheck,
+			name: "NoExp",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: oneTimePolicy, Token: wrongAud},
+			err:  jcp.ErrClaimCheck,
+			name: "PolicyAud",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: oneTimePolicy + anyOtherString, Token: policyToken},
+			err:  jcp.ErrUnknownPolicy,
+			name: "UnknownPolicy",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := proxy.Validate(ctx, tc.args)
+			if err != nil || tc.err != nil {
+				if errors.Is(err, tc.err) {
+					return
+				}
+				t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestMemoryReplayStore(t *testing.T) {
+	ctx := context.Background()
+	store := jcp.NewMemoryReplayStore(2)
+
+	ok, err := store.Record(ctx, anyNonEmptyString, time.Now().Add(-time.Second))
+	if err != nil || !ok {
+		t.Fatalf("Expected first record to succeed, got %t and %v.", ok, err)
+	}
+	ok, err = store.Record(ctx, anyOtherString, time.Now().Add(time.Minute))
+	if err != nil || !ok {
+		t.Fatalf("Expected second record to succeed, got %t and %v.", ok, err)
+	}
+	ok, err = store.Record(ctx, anyOtherString, time.Now().Add(time.Minute))
+	if err != nil || ok {
+		t.Fatalf("Expected replay to be detected, got %t and %v.", ok, err)
+	}
+
+	// The expired entry is pruned to make room.
+	ok, err = store.Record(ctx, testKID, time.Now().Add(time.Minute))
+	if err != nil || !ok {
+		t.Fatalf("Expected record after pruning to succeed, got %t and %v.", ok, err)
+	}
+	if store.Len() != 2 {
+		t.Fatalf("Expected 2 entries, got %d.", store.Len())
+	}
+
+	_, err = store.Record(ctx, anyNonEmptyString, time.Now().Add(time.Minute))
+	if !errors.Is(err, jcp.ErrReplayStoreFull) {
+		t.Fatalf("Expected error %v, got %v.", jcp.ErrReplayStoreFull, err)
+	}
+}
@@ -0,0 +1,322 @@
+package jcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+)
+
+// DefaultMaxTokenLifetime is the default longest lifetime of a JWT. It is used to expire revocations after any token
+// they could match has expired anyway.
+const DefaultMaxTokenLifetime = 24 * time.Hour
+
+var (
+	// ErrInvalidRevocation is returned when a revocation is malformed.
+	ErrInvalidRevocation = errors.New("invalid revocation")
+	// ErrRevoked is returned when a JWT matches a revocation in the Denylist.
+	ErrRevoked = errors.New("token has been revoked")
+	// ErrTokenLifetime is returned when a Denylist is configured and a JWT's lifetime is unknown or longer than its
+	// MaxTokenLifetime, so revocations could expire while the JWT is still valid.
+	ErrTokenLifetime = errors.New("token lifetime is unknown or too long")
+)
+
+// Revocation is an entry in the Denylist. Exactly one of JTI, KID, SID, or Sub must be set.
+//
+// A JTI revocation denies the JWT with that `jti` claim. A KID revocation denies every JWT signed by the key with that
+// `kid`, such as when a key is leaked. A SID revocation denies every JWT for that `sid` session claim issued before
+// IssuedBefore. A Sub revocation denies every JWT for that `sub` claim issued before IssuedBefore. If IssuedBefore is
+// not given for a SID or Sub revocation, it is set to when the revocation was added. Iss optionally limits JTI, SID, and
+// Sub revocations to a single issuer.
+//
+// A revocation is forgotten after Expires. If Expires is not given for a JTI, SID, or Sub revocation, it is set to when
+// any matching token could no longer be valid anyway. KID revocations without Expires are never forgotten.
+type Revocation struct {
+	Expires      time.Time `json:"expires"`
+	Iss          string    `json:"iss"`
+	IssuedBefore time.Time `json:"issuedBefore"`
+	JTI          string    `json:"jti"`
+	KID          string    `json:"kid"`
+	SID          string    `json:"sid"`
+	Sub          string    `json:"sub"`
+}
+
+func (r Revocation) expired(now time.Time) bool {
+	return !r.Expires.IsZero() && now.After(r.Expires)
+}
+
+func (r Revocation) same(other Revocation) bool {
+	return r.Iss == other.Iss && r.JTI == other.JTI && r.KID == other.KID && r.SID == other.SID && r.Sub == other.Sub
+}
+
+// DenylistOptions are the options for a Denylist.
+type DenylistOptions struct {
+	// Ctx ends the background goroutine watching the file when canceled.
+	Ctx context.Context
+	// File is the path to a JSON array of revocations. It is watched for changes and revocations added or removed
+	// through the Denylist are written back to it. If empty, the Denylist is only kept in memory.
+	File string
+	// MaxTokenLifetime is the longest lifetime of a JWT. It is used to expire revocations. JWTs without `exp` and `iat`
+	// claims, or whose `exp` is more than MaxTokenLifetime after their `iat`, are rejected.
+	MaxTokenLifetime time.Duration
+	// RefreshErrorHandler consumes errors that happen when reloading the file.
+	RefreshErrorHandler keyfunc.ErrorHandler
+	// RefreshInterval is the duration between checks for changes to the file.
+	RefreshInterval time.Duration
+}
+
+// Denylist is a set of revocations that is consulted after a JWT's signature has been verified.
+type Denylist struct {
+	modTime     time.Time
+	mux         sync.RWMutex
+	options     DenylistOptions
+	revocations []Revocation
+}
+
+// NewDenylist creates a new Denylist. If a file is given, it is loaded and watched for changes. A missing file is
+// treated as an empty Denylist.
+func NewDenylist(options DenylistOptions) (*Denylist, error) {
+	if options.MaxTokenLifetime == 0 {
+		options.MaxTokenLifetime = DefaultMaxTokenLifetime
+	}
+	if options.RefreshInterval == 0 {
+		options.RefreshInterval = DefaultFileRefreshInterval
+	}
+	d := &Denylist{
+		options: options,
+	}
+	if options.File == "" {
+		return d, nil
+	}
+
+	err := d.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := options.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	go d.watch(ctx)
+
+	return d, nil
+}
+
+// Revoke adds a revocation to the Denylist and returns it with any defaults applied. A revocation with the same iss,
+// jti, kid, sid, and sub is replaced.
+func (d *Denylist) Revoke(r Revocation) (Revocation, error) {
+	r, err := d.normalize(r, time.Now())
+	if err != nil {
+		return Revocation{}, err
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	revocations := make([]Revocation, 0, len(d.revocations)+1)
+	for _, existing := range d.revocations {
+		if !existing.same(r) {
+			revocations = append(revocations, existing)
+		}
+	}
+	revocations = append(revocations, r)
+	return r, d.replace(revocations)
+}
+
+// Remove removes the revocation with the same iss, jti, kid, sid, and sub from the Denylist. It reports if a revocation
+// was removed.
+func (d *Denylist) Remove(r Revocation) (bool, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	revocations := make([]Revocation, 0, len(d.revocations))
+	for _, existing := range d.revocations {
+		if !existing.same(r) {
+			revocations = append(revocations, existing)
+		}
+	}
+	if len(revocations) == len(d.revocations) {
+		return false, nil
+	}
+	return true, d.replace(revocations)
+}
+
+// Revocations returns a copy of the revocations in the Denylist that have not expired.
+func (d *Denylist) Revocations() []Revocation {
+	now := time.Now()
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	revocations := make([]Revocation, 0, len(d.revocations))
+	for _, r := range d.revocations {
+		if !r.expired(now) {
+			revocations = append(revocations, r)
+		}
+	}
+	return revocations
+}
+
+// check returns ErrRevoked if the verified JWT matches any revocation. Revocations expire after MaxTokenLifetime, so
+// it returns ErrTokenLifetime if the JWT could be valid for longer than that.
+func (d *Denylist) check(kid string, claims *tokenClaims) error {
+	if claims.ExpiresAt == nil || claims.IssuedAt == nil {
+		return fmt.Errorf("%w: claims %q and %q are required", ErrTokenLifetime, expClaim, iatClaim)
+	}
+	if lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time); lifetime > d.options.MaxTokenLifetime {
+		return fmt.Errorf("%w: %s is longer than %s", ErrTokenLifetime, lifetime, d.options.MaxTokenLifetime)
+	}
+	now := time.Now()
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	for _, r := range d.revocations {
+		if r.expired(now) {
+			continue
+		}
+		switch {
+		case r.KID != "":
+			if r.KID == kid {
+				return fmt.Errorf("%w: key ID %q", ErrRevoked, kid)
+			}
+		case r.Iss != "" && r.Iss != claims.Issuer:
+		case r.JTI != "":
+			if r.JTI == claims.ID {
+				return fmt.Errorf("%w: JWT ID %q", ErrRevoked, claims.ID)
+			}
+		case r.SID != "":
+			if r.SID == claims.SID && (claims.IssuedAt == nil || claims.IssuedAt.Before(r.IssuedBefore)) {
+				return fmt.Errorf("%w: session %q issued before %s", ErrRevoked, claims.SID, r.IssuedBefore)
+			}
+		case r.Sub != "":
+			if r.Sub == claims.Subject && (claims.IssuedAt == nil || claims.IssuedAt.Before(r.IssuedBefore)) {
+				return fmt.Errorf("%w: subject %q issued before %s", ErrRevoked, claims.Subject, r.IssuedBefore)
+			}
+		}
+	}
+	return nil
+}
+
+// normalize validates the revocation and sets its defaults relative to the given time.
+func (d *Denylist) normalize(r Revocation, now time.Time) (Revocation, error) {
+	set := 0
+	for _, v := range []string{r.JTI, r.KID, r.SID, r.Sub} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return Revocation{}, fmt.Errorf("%w: exactly one of jti, kid, sid, or sub must be given", ErrInvalidRevocation)
+	}
+	if (r.SID != "" || r.Sub != "") && r.IssuedBefore.IsZero() {
+		r.IssuedBefore = now
+	}
+	if r.Expires.IsZero() {
+		switch {
+		case r.JTI != "":
+			r.Expires = now.Add(d.options.MaxTokenLifetime)
+		case r.SID != "", r.Sub != "":
+			r.Expires = r.IssuedBefore.Add(d.options.MaxTokenLifetime)
+		}
+	}
+	return r, nil
+}
+
+// replace sets the revocations, dropping expired ones, and writes them to the file if configured. The lock must be
+// held.
+func (d *Denylist) replace(revocations []Revocation) error {
+	now := time.Now()
+	kept := revocations[:0]
+	for _, r := range revocations {
+		if !r.expired(now) {
+			kept = append(kept, r)
+		}
+	}
+	if d.options.File != "" {
+		data, err := json.MarshalIndent(kept, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to JSON marshal revocations: %w", err)
+		}
+		err = writeFileAtomic(d.options.File, data)
+		if err != nil {
+			return fmt.Errorf("failed to write revocations file: %w", err)
+		}
+		info, err := os.Stat(d.options.File)
+		if err != nil {
+			return fmt.Errorf("failed to stat revocations file: %w", err)
+		}
+		d.modTime = info.ModTime()
+	}
+	d.revocations = kept
+	return nil
+}
+
+// reload reads the revocations from the file if it changed. Missing defaults are relative to the file's modification
+// time, so reloading an unchanged file is deterministic. The write lock is held from comparing the modification time
+// to swapping the revocations, so a concurrent Revoke or Remove is not overwritten by an older copy of the file.
+func (d *Denylist) reload() error {
+	info, err := os.Stat(d.options.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat revocations file: %w", err)
+	}
+
+	d.mux.RLock()
+	unchanged := info.ModTime().Equal(d.modTime)
+	d.mux.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	info, err = os.Stat(d.options.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat revocations file: %w", err)
+	}
+	if info.ModTime().Equal(d.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(d.options.File)
+	if err != nil {
+		return fmt.Errorf("failed to read revocations file: %w", err)
+	}
+	var revocations []Revocation
+	err = json.Unmarshal(data, &revocations)
+	if err != nil {
+		return fmt.Errorf("failed to JSON parse revocations file: %s: %w", err, ErrInvalidRevocation)
+	}
+	for i, r := range revocations {
+		revocations[i], err = d.normalize(r, info.ModTime())
+		if err != nil {
+			return fmt.Errorf("invalid revocation at index %d in file: %w", i, err)
+		}
+	}
+
+	d.modTime = info.ModTime()
+	d.revocations = revocations
+	return nil
+}
+
+func (d *Denylist) watch(ctx context.Context) {
+	ticker := time.NewTicker(d.options.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := d.reload()
+			if err != nil && d.options.RefreshErrorHandler != nil {
+				d.options.RefreshErrorHandler(err)
+			}
+		}
+	}
+}
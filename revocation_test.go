@@ -0,0 +1,267 @@
+package jcp_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+
+	"github.com/MicahParks/jcp"
+)
+
+const adminToken = "my-admin-token"
+
+func TestProxy_Denylist(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	file := filepath.Join(t.TempDir(), "revocations.json")
+	denylist, err := jcp.NewDenylist(jcp.DenylistOptions{
+		Ctx:  ctx,
+		File: file,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create denylist: %v.", err)
+	}
+	proxy, err := jcp.NewProxyWithOptions(map[string]keyfunc.Options{jwksServer.URL: {}}, jcp.ProxyOptions{Denylist: denylist})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	now := time.Now()
+	sign := func(claims jwt.RegisteredClaims) string {
+		j := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		j.Header[headerKID] = testKID
+		token, err := j.SignedString(privateKey)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return token
+	}
+	exp := jwt.NewNumericDate(now.Add(time.Hour))
+	iat := jwt.NewNumericDate(now)
+	oldSub := sign(jwt.RegisteredClaims{ExpiresAt: exp, IssuedAt: jwt.NewNumericDate(now.Add(-time.Hour)), Subject: anyNonEmptyString})
+	newSub := sign(jwt.RegisteredClaims{ExpiresAt: exp, IssuedAt: iat, Subject: anyNonEmptyString})
+	jti := sign(jwt.RegisteredClaims{ExpiresAt: exp, ID: anyNonEmptyString, IssuedAt: iat})
+	otherJTI := sign(jwt.RegisteredClaims{ExpiresAt: exp, ID: anyOtherString, IssuedAt: iat})
+	noExpiry := sign(jwt.RegisteredClaims{ID: anyOtherString, IssuedAt: iat})
+	tooLong := sign(jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(2 * jcp.DefaultMaxTokenLifetime)), ID: anyOtherString, IssuedAt: iat})
+
+	for _, r := range []jcp.Revocation{
+		{JTI: anyNonEmptyString},
+		{IssuedBefore: now.Add(-time.Minute), Sub: anyNonEmptyString},
+	} {
+		_, err = denylist.Revoke(r)
+		if err != nil {
+			t.Fatalf("Failed to revoke: %v.", err)
+		}
+	}
+	_, err = denylist.Revoke(jcp.Revocation{JTI: anyNonEmptyString, KID: testKID})
+	if !errors.Is(err, jcp.ErrInvalidRevocation) {
+		t.Fatalf("Expected error %v, got %v.", jcp.ErrInvalidRevocation, err)
+	}
+
+	testCases := []struct {
+		err   error
+		name  string
+		token string
+	}{
+		{
+			err:   jcp.ErrRevoked,
+			name:  "JTI",
+			token: jti,
+		},
+		{
+			name:  "OtherJTI",
+			token: otherJTI,
+		},
+		{
+			err:   jcp.ErrRevoked,
+			name:  "SubIssuedBefore",
+			token: oldSub,
+		},
+		{
+			name:  "SubIssuedAfter",
+			token: newSub,
+		},
+		{
+			err:   jcp.ErrTokenLifetime,
+			name:  "NoExpiry",
+			token: noExpiry,
+		},
+		{
+			err:   jcp.ErrTokenLifetime,
+			name:  "TooLong",
+			token: tooLong,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := proxy.Validate(ctx, jcp.ValidateArgs{Token: tc.token})
+			if err != nil || tc.err != nil {
+				if errors.Is(err, tc.err) {
+					return
+				}
+				t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+			}
+		})
+	}
+
+	// Revoking the key is written to the file and picked up by a new denylist.
+	_, err = denylist.Revoke(jcp.Revocation{KID: testKID})
+	if err != nil {
+		t.Fatalf("Failed to revoke: %v.", err)
+	}
+	reloaded, err := jcp.NewDenylist(jcp.DenylistOptions{
+		Ctx:  ctx,
+		File: file,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create denylist: %v.", err)
+	}
+	if len(reloaded.Revocations()) != 3 {
+		t.Fatalf("Expected 3 revocations from file, got %d.", len(reloaded.Revocations()))
+	}
+	_, err = proxy.Validate(ctx, jcp.ValidateArgs{Token: otherJTI})
+	if !errors.Is(err, jcp.ErrRevoked) {
+		t.Fatalf("Expected error %v, got %v.", jcp.ErrRevoked, err)
+	}
+}
+
+func TestDenylist_Expires(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "revocations.json")
+	data, err := json.Marshal([]jcp.Revocation{
+		{Expires: time.Now().Add(-time.Minute), JTI: anyNonEmptyString},
+		{IssuedBefore: time.Now().Add(-2 * jcp.DefaultMaxTokenLifetime), Sub: anyNonEmptyString},
+		{JTI: anyOtherString},
+		{SID: anyOtherString},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal revocations: %v.", err)
+	}
+	err = os.WriteFile(file, data, 0600)
+	if err != nil {
+		t.Fatalf("Failed to write revocations file: %v.", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	denylist, err := jcp.NewDenylist(jcp.DenylistOptions{
+		Ctx:  ctx,
+		File: file,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create denylist: %v.", err)
+	}
+	revocations := denylist.Revocations()
+	if len(revocations) != 2 || revocations[0].JTI != anyOtherString || revocations[1].IssuedBefore.IsZero() {
+		t.Fatalf("Expected only the unexpired revocations with defaults, got %v.", revocations)
+	}
+}
+
+func TestHTTPHandler_Revocations(t *testing.T) {
+	denylist, err := jcp.NewDenylist(jcp.DenylistOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create denylist: %v.", err)
+	}
+	handler := jcp.HTTPHandler{
+		AdminToken:      adminToken,
+		Denylist:        denylist,
+		Logger:          zap.NewNop(),
+		RequestMaxBytes: jcp.DefaultRequestMaxBytes,
+	}.Revocations()
+
+	testCases := []struct {
+		args         *jcp.Revocation
+		method       string
+		name         string
+		responseCode int
+		results      int
+		token        string
+	}{
+		{
+			method:       http.MethodGet,
+			name:         "Unauthorized",
+			responseCode: http.StatusUnauthorized,
+			token:        anyOtherString,
+		},
+		{
+			args:   &jcp.Revocation{JTI: anyNonEmptyString},
+			method: http.MethodPost,
+			name:   "Add",
+		},
+		{
+			args:         &jcp.Revocation{},
+			method:       http.MethodPost,
+			name:         "AddInvalid",
+			responseCode: http.StatusBadRequest,
+		},
+		{
+			method:  http.MethodGet,
+			name:    "List",
+			results: 1,
+		},
+		{
+			args:   &jcp.Revocation{JTI: anyNonEmptyString},
+			method: http.MethodDelete,
+			name:   "Remove",
+		},
+		{
+			args:         &jcp.Revocation{JTI: anyNonEmptyString},
+			method:       http.MethodDelete,
+			name:         "RemoveMissing",
+			responseCode: http.StatusNotFound,
+		},
+		{
+			method: http.MethodGet,
+			name:   "ListEmpty",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var body []byte
+			if tc.args != nil {
+				body, err = json.Marshal(jcp.RevocationRequest{Args: *tc.args})
+				if err != nil {
+					t.Fatalf("Failed to marshal args: %v.", err)
+				}
+			}
+			r := httptest.NewRequest(tc.method, "/v1/admin/revocations", bytes.NewReader(body))
+			r.Header.Set(jcp.HeaderContentType, jcp.ContentTypeJSON)
+			if tc.token == "" {
+				tc.token = adminToken
+			}
+			r.Header.Set(jcp.HeaderAuthorization, "Bearer "+tc.token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if tc.responseCode == 0 {
+				tc.responseCode = http.StatusOK
+			}
+			if w.Code != tc.responseCode {
+				t.Fatalf("Expected response code %d, but got %d.", tc.responseCode, w.Code)
+			}
+			if tc.method != http.MethodGet || w.Code != http.StatusOK {
+				return
+			}
+			var resp jcp.RevocationsResponse
+			err = json.Unmarshal(w.Body.Bytes(), &resp)
+			if err != nil {
+				t.Fatalf("Failed to unmarshal response: %v.", err)
+			}
+			if len(resp.Results) != tc.results {
+				t.Fatalf("Expected %d revocations, got %d.", tc.results, len(resp.Results))
+			}
+		})
+	}
+}
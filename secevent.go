@@ -0,0 +1,80 @@
+package jcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// ProfileSecurityEvent is the validation profile for Security Event Tokens as defined in RFC 8417.
+	ProfileSecurityEvent = "securityEvent"
+	typSecurityEvent     = "secevent+jwt"
+)
+
+// ErrEventType is returned when a Security Event Token has an event type that is not expected.
+var ErrEventType = errors.New("unexpected security event type")
+
+// SecurityEvent is the content of a validated Security Event Token.
+type SecurityEvent struct {
+	Events map[string]json.RawMessage `json:"events"`
+	JTI    string                     `json:"jti"`
+	Toe    *jwt.NumericDate           `json:"toe"`
+	Txn    string                     `json:"txn"`
+}
+
+// checkSecurityEvent confirms the JWT is a Security Event Token as defined in RFC 8417. When expected event types are
+// given by the request or its policy, every event must be of an expected type for both.
+func checkSecurityEvent(args ValidateArgs, policy Policy, token *jwt.Token, claims *tokenClaims) error {
+	if typ := mediaType(token); typ != typSecurityEvent {
+		return fmt.Errorf("%w: header %q must be %q, got %q", ErrProfile, headerTyp, typSecurityEvent, typ)
+	}
+	if len(args.Aud) == 0 && len(policy.Aud) == 0 {
+		return fmt.Errorf("%w: the %q of the receiver must be given", ErrProfile, audClaim)
+	}
+	required := map[string]bool{
+		audClaim:    len(claims.Audience) != 0,
+		eventsClaim: len(claims.Events) != 0,
+		iatClaim:    claims.IssuedAt != nil,
+		issClaim:    claims.Issuer != "",
+		jtiClaim:    claims.ID != "",
+	}
+	for _, claim := range []string{audClaim, eventsClaim, iatClaim, issClaim, jtiClaim} {
+		if !required[claim] {
+			return fmt.Errorf("%w: claim %q is required", ErrProfile, claim)
+		}
+	}
+	if claims.Nonce != "" {
+		return fmt.Errorf("%w: claim %q is prohibited", ErrProfile, "nonce")
+	}
+	if claims.Toe != nil && claims.Toe.After(time.Now()) {
+		return fmt.Errorf("%w: claim %q is in the future", ErrProfile, "toe")
+	}
+	if args.Txn != "" && args.Txn != claims.Txn {
+		return fmt.Errorf("%w: claim %q does not match", ErrProfile, "txn")
+	}
+	for eventType, event := range claims.Events {
+		if !bytes.HasPrefix(bytes.TrimSpace(event), []byte("{")) {
+			return fmt.Errorf("%w: event %q must be a JSON object", ErrProfile, eventType)
+		}
+		for _, expected := range [][]string{args.Events, policy.Events} {
+			if len(expected) != 0 && !contains(expected, eventType) {
+				return fmt.Errorf("%w: %q", ErrEventType, eventType)
+			}
+		}
+	}
+	return nil
+}
+
+func newSecurityEvent(claims *tokenClaims) *SecurityEvent {
+	return &SecurityEvent{
+		Events: claims.Events,
+		JTI:    claims.ID,
+		Toe:    claims.Toe,
+		Txn:    claims.Txn,
+	}
+}
@@ -0,0 +1,165 @@
+package jcp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/MicahParks/jcp"
+)
+
+const (
+	caepSessionRevoked = "https://schemas.openid.net/secevent/caep/event-type/session-revoked"
+	caepPolicy         = "caep"
+	testTxn            = "a transaction ID"
+)
+
+func TestProxy_SecurityEventProfile(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	proxy, err := jcp.NewProxyWithOptions(map[string]keyfunc.Options{jwksServer.URL: {}}, jcp.ProxyOptions{
+		Policies: map[string]jcp.Policy{
+			caepPolicy: {
+				Aud:     []string{anyNonEmptyString},
+				Events:  []string{caepSessionRevoked},
+				Profile: jcp.ProfileSecurityEvent,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	toe := time.Now().Add(-time.Minute).Unix()
+	event := map[string]interface{}{
+		"subject": map[string]string{"format": "opaque", "id": anyOtherString},
+	}
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"aud":    anyNonEmptyString,
+			"events": map[string]interface{}{caepSessionRevoked: event},
+			"iat":    time.Now().Unix(),
+			"iss":    anyOtherString,
+			"jti":    anyNonEmptyString,
+			"toe":    toe,
+			"txn":    testTxn,
+		}
+	}
+	with := func(claim string, value interface{}) jwt.MapClaims {
+		c := claims()
+		if value == nil {
+			delete(c, claim)
+		} else {
+			c[claim] = value
+		}
+		return c
+	}
+	sign := func(typ string, claims jwt.MapClaims) string {
+		j := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		j.Header[headerKID] = testKID
+		j.Header["typ"] = typ
+		token, err := j.SignedString(privateKey)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return token
+	}
+	set := sign("secevent+jwt", claims())
+
+	results, err := proxy.Validate(ctx, jcp.ValidateArgs{Policy: caepPolicy, Token: set, Txn: testTxn})
+	if err != nil {
+		t.Fatalf("Failed to validate Security Event Token: %v.", err)
+	}
+	if results.SecurityEvent == nil {
+		t.Fatalf("Expected security event in results.")
+	}
+	if results.SecurityEvent.JTI != anyNonEmptyString || results.SecurityEvent.Txn != testTxn || results.SecurityEvent.Toe.Unix() != toe {
+		t.Fatalf("Unexpected security event %+v.", results.SecurityEvent)
+	}
+	expected, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("Failed to marshal event: %v.", err)
+	}
+	if string(results.SecurityEvent.Events[caepSessionRevoked]) != string(expected) {
+		t.Fatalf("Expected event %s, got %s.", expected, results.SecurityEvent.Events[caepSessionRevoked])
+	}
+
+	testCases := []struct {
+		args jcp.ValidateArgs
+		err  error
+		name string
+	}{
+		{
+			args: jcp.ValidateArgs{Aud: []string{anyNonEmptyString}, Profile: jcp.ProfileSecurityEvent, Token: set},
+			name: "Request",
+		},
+		{
+			args: jcp.ValidateArgs{Events: []string{anyNonEmptyString}, Policy: caepPolicy, Token: set},
+			err:  jcp.ErrEventType,
+			name: "RequestEventType",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: caepPolicy, Token: sign("secevent+jwt", with("events", map[string]interface{}{anyNonEmptyString: event}))},
+			err:  jcp.ErrEventType,
+			name: "PolicyEventType",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: caepPolicy, Token: sign("JWT", claims())},
+			err:  jcp.ErrProfile,
+			name: "WrongTyp",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: caepPolicy, Token: sign("logout+jwt", claims())},
+			err:  jcp.ErrProfile,
+			name: "LogoutToken",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: caepPolicy, Token: sign("secevent+jwt", with("events", nil))},
+			err:  jcp.ErrProfile,
+			name: "NoEvents",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: caepPolicy, Token: sign("secevent+jwt", with("events", map[string]interface{}{caepSessionRevoked: anyNonEmptyString}))},
+			err:  jcp.ErrProfile,
+			name: "EventNotObject",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: caepPolicy, Token: sign("secevent+jwt", with("jti", nil))},
+			err:  jcp.ErrProfile,
+			name: "NoJTI",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: caepPolicy, Token: sign("secevent+jwt", with("toe", time.Now().Add(time.Hour).Unix()))},
+			err:  jcp.ErrProfile,
+			name: "FutureTOE",
+		},
+		{
+			args: jcp.ValidateArgs{Policy: caepPolicy, Token: set, Txn: anyOtherString},
+			err:  jcp.ErrProfile,
+			name: "WrongTxn",
+		},
+		{
+			args: jcp.ValidateArgs{Aud: []string{anyNonEmptyString}, Profile: jcp.ProfileIDToken, Token: sign("secevent+jwt", with("sub", anyOtherString))},
+			err:  jcp.ErrProfile,
+			name: "SecurityEventAsIDToken",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := proxy.Validate(ctx, tc.args)
+			if err != nil || tc.err != nil {
+				if errors.Is(err, tc.err) {
+					return
+				}
+				t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package jcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// DefaultSPIFFERefreshInterval is the default duration between refreshes of a SPIFFE bundle without a refresh hint.
+	DefaultSPIFFERefreshInterval = 5 * time.Minute
+	// DefaultSPIFFERefreshRateLimit is the default minimum duration between refreshes of a SPIFFE bundle.
+	DefaultSPIFFERefreshRateLimit = 30 * time.Second
+	spiffeIDPrefix                = "spiffe://"
+	useJWTSVID                    = "jwt-svid"
+)
+
+var (
+	// ErrSPIFFE is returned when a JWT-SVID's SPIFFE ID is not in an allowed trust domain or does not match a policy.
+	ErrSPIFFE = errors.New("SPIFFE ID rejected")
+	// spiffeID matches a SPIFFE ID and captures its trust domain as defined in the SPIFFE ID specification.
+	spiffeID = regexp.MustCompile(`^spiffe://([a-z0-9._-]+)((?:/[A-Za-z0-9._-]+)*)$`)
+	// trustDomain matches a SPIFFE trust domain name.
+	trustDomain = regexp.MustCompile(`^[a-z0-9._-]+$`)
+)
+
+// SPIFFEOptions are the options for a SPIFFE trust domain's bundle. The bundle is a JWK Set with the
+// `spiffe_refresh_hint` and `spiffe_sequence` members. Only its keys with the `jwt-svid` use verify JWTs.
+type SPIFFEOptions struct {
+	// Bundle is the URL of the trust bundle. The file scheme reads the bundle from the local filesystem.
+	Bundle string
+	// Client is the HTTP client used to get the trust bundle via HTTP.
+	Client *http.Client
+	// RefreshInterval is the duration between refreshes when the bundle has no refresh hint.
+	// DefaultSPIFFERefreshInterval is used when zero.
+	RefreshInterval time.Duration
+	// RefreshRateLimit is the minimum duration between refreshes, including those caused by unknown key IDs and short
+	// refresh hints. DefaultSPIFFERefreshRateLimit is used when zero.
+	RefreshRateLimit time.Duration
+	// RefreshTimeout is the timeout for fetching the trust bundle.
+	RefreshTimeout time.Duration
+}
+
+// spiffeKeySource verifies JWT-SVIDs with the bundle of the trust domain of their SPIFFE ID.
+type spiffeKeySource struct {
+	bundles map[string]*spiffeBundle
+}
+
+func newSPIFFEKeySource(options map[string]SPIFFEOptions) (*spiffeKeySource, error) {
+	bundles := make(map[string]*spiffeBundle, len(options))
+	for td, opt := range options {
+		b, err := newSPIFFEBundle(td, opt)
+		if err != nil {
+			return nil, err
+		}
+		bundles[td] = b
+	}
+	return &spiffeKeySource{
+		bundles: bundles,
+	}, nil
+}
+
+// Keyfunc helps implement the keyfuncer interface. JWTs whose SPIFFE ID is not in a configured trust domain are
+// rejected without any requests.
+func (s *spiffeKeySource) Keyfunc(token *jwt.Token) (interface{}, error) {
+	sub := tokenSubject(token)
+	td, _ := spiffeTrustDomain(sub)
+	b, ok := s.bundles[td]
+	if !ok {
+		return nil, fmt.Errorf("%w: trust domain of %q is not allowed", ErrSPIFFE, sub)
+	}
+	return b.Keyfunc(token)
+}
+
+// spiffeBundle is the trust bundle of a single trust domain. It is refreshed when next used after its refresh hint has
+// passed or when a JWT has an unknown key ID.
+type spiffeBundle struct {
+	fetched     time.Time
+	jwks        *keyfunc.JWKS
+	mux         sync.Mutex
+	options     SPIFFEOptions
+	refreshHint time.Duration
+	sequence    *uint64
+	trustDomain string
+}
+
+// spiffeBundleJSON is the JSON representation of a SPIFFE bundle.
+type spiffeBundleJSON struct {
+	Keys        []json.RawMessage `json:"keys"`
+	RefreshHint int64             `json:"spiffe_refresh_hint"`
+	Sequence    *uint64           `json:"spiffe_sequence"`
+}
+
+func newSPIFFEBundle(td string, options SPIFFEOptions) (*spiffeBundle, error) {
+	if !trustDomain.MatchString(td) {
+		return nil, fmt.Errorf("%w: invalid SPIFFE trust domain %q", ErrInvalidConfig, td)
+	}
+	_, err := validateKeyURL(options.Bundle)
+	if err != nil {
+		return nil, err
+	}
+	if IsFileURL(options.Bundle) {
+		options.Client = fileClient
+	} else if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	if options.RefreshInterval == 0 {
+		options.RefreshInterval = DefaultSPIFFERefreshInterval
+	}
+	if options.RefreshRateLimit == 0 {
+		options.RefreshRateLimit = DefaultSPIFFERefreshRateLimit
+	}
+	if options.RefreshTimeout == 0 {
+		options.RefreshTimeout = defaultFetchTimeout
+	}
+	b := &spiffeBundle{
+		options:     options,
+		trustDomain: td,
+	}
+	err = b.refresh(time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SPIFFE bundle for trust domain %q: %w", td, err)
+	}
+	return b, nil
+}
+
+// Keyfunc helps implement the keyfuncer interface.
+func (b *spiffeBundle) Keyfunc(token *jwt.Token) (interface{}, error) {
+	jwks := b.current(false)
+	key, err := jwks.Keyfunc(token)
+	if errors.Is(err, keyfunc.ErrKIDNotFound) {
+		// The trust domain may have rotated its keys before the refresh hint passed.
+		if refreshed := b.current(true); refreshed != jwks {
+			return refreshed.Keyfunc(token)
+		}
+	}
+	return key, err
+}
+
+// current returns the bundle's JWK Set, refreshing it first when it is older than its refresh interval, or when forced
+// and not rate limited. Refreshes are serialized, so concurrent JWTs cause a single refresh. The previous JWK Set is
+// kept when a refresh fails.
+func (b *spiffeBundle) current(force bool) *keyfunc.JWKS {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	now := time.Now()
+	interval := b.options.RefreshInterval
+	if b.refreshHint != 0 {
+		interval = b.refreshHint
+	}
+	if interval < b.options.RefreshRateLimit {
+		interval = b.options.RefreshRateLimit
+	}
+	age := now.Sub(b.fetched)
+	if age > interval || (force && age > b.options.RefreshRateLimit) {
+		_ = b.refresh(now)
+	}
+	return b.jwks
+}
+
+// refresh fetches the bundle. Bundles with a lower sequence number than the held bundle are rejected. The lock must be
+// held.
+func (b *spiffeBundle) refresh(now time.Time) error {
+	// Rate limit failed fetches too.
+	b.fetched = now
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.options.RefreshTimeout)
+	defer cancel()
+
+	data, err := fetch(ctx, b.options.Client, b.options.Bundle)
+	if err != nil {
+		return fmt.Errorf("failed to get SPIFFE bundle %q: %w", b.options.Bundle, err)
+	}
+	var bundle spiffeBundleJSON
+	err = json.Unmarshal(data, &bundle)
+	if err != nil {
+		return fmt.Errorf("failed to parse SPIFFE bundle %q: %w", b.options.Bundle, err)
+	}
+	if b.sequence != nil && bundle.Sequence != nil && *bundle.Sequence < *b.sequence {
+		return fmt.Errorf("SPIFFE bundle %q sequence %d is older than %d", b.options.Bundle, *bundle.Sequence, *b.sequence)
+	}
+
+	keys := make([]json.RawMessage, 0, len(bundle.Keys))
+	for _, raw := range bundle.Keys {
+		var key struct {
+			Use string `json:"use"`
+		}
+		err = json.Unmarshal(raw, &key)
+		if err != nil {
+			return fmt.Errorf("failed to parse key of SPIFFE bundle %q: %w", b.options.Bundle, err)
+		}
+		if key.Use == useJWTSVID {
+			keys = append(keys, raw)
+		}
+	}
+	jwksJSON, err := json.Marshal(struct {
+		Keys []json.RawMessage `json:"keys"`
+	}{Keys: keys})
+	if err != nil {
+		return fmt.Errorf("failed to marshal JWT-SVID keys of SPIFFE bundle %q: %w", b.options.Bundle, err)
+	}
+	jwks, err := keyfunc.NewJSON(jwksJSON)
+	if err != nil {
+		return fmt.Errorf("failed to parse JWT-SVID keys of SPIFFE bundle %q: %w", b.options.Bundle, err)
+	}
+
+	b.jwks = jwks
+	b.refreshHint = 0
+	if bundle.RefreshHint > 0 {
+		b.refreshHint = time.Duration(bundle.RefreshHint) * time.Second
+	}
+	if bundle.Sequence != nil {
+		b.sequence = bundle.Sequence
+	}
+	return nil
+}
+
+// checkSPIFFE confirms a JWT verified with a trust domain's bundle is a JWT-SVID and returns its SPIFFE ID. When the
+// policy has SPIFFE ID patterns, the JWT must be a JWT-SVID and its SPIFFE ID must match one of them.
+func (p proxy) checkSPIFFE(policy Policy, source keySource, claims *tokenClaims) (string, error) {
+	if source != keySourceSPIFFE {
+		if len(policy.SPIFFEIDs) != 0 {
+			return "", fmt.Errorf("%w: %q is not a SPIFFE ID in an allowed trust domain", ErrSPIFFE, claims.Subject)
+		}
+		return "", nil
+	}
+	if claims.ExpiresAt == nil || len(claims.Audience) == 0 {
+		return "", fmt.Errorf("%w: JWT-SVIDs must have the %q and %q claims", ErrSPIFFE, audClaim, expClaim)
+	}
+	if len(policy.SPIFFEIDs) != 0 && !matchSPIFFEID(policy.SPIFFEIDs, claims.Subject) {
+		return "", fmt.Errorf("%w: %q does not match any SPIFFE ID pattern of the policy", ErrSPIFFE, claims.Subject)
+	}
+	return claims.Subject, nil
+}
+
+// matchSPIFFEID reports whether the SPIFFE ID matches one of the patterns. A `*` in a pattern matches a single path
+// segment or part of one.
+func matchSPIFFEID(patterns []string, id string) bool {
+	for _, pattern := range patterns {
+		ok, err := path.Match(pattern, id)
+		if err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// spiffeTrustDomain returns the trust domain of the SPIFFE ID.
+func spiffeTrustDomain(id string) (string, bool) {
+	match := spiffeID.FindStringSubmatch(id)
+	if match == nil {
+		return "", false
+	}
+	for _, segment := range strings.Split(match[2], "/") {
+		if segment == "." || segment == ".." {
+			return "", false
+		}
+	}
+	return match[1], true
+}
+
+// isSPIFFEID reports whether the JWT's subject looks like a SPIFFE ID.
+func isSPIFFEID(token *jwt.Token) bool {
+	return strings.HasPrefix(tokenSubject(token), spiffeIDPrefix)
+}
+
+func tokenSubject(token *jwt.Token) string {
+	switch claims := token.Claims.(type) {
+	case *jwt.RegisteredClaims:
+		return claims.Subject
+	case *tokenClaims:
+		return claims.Subject
+	case jwt.MapClaims:
+		sub, _ := claims[subClaim].(string)
+		return sub
+	default:
+		return ""
+	}
+}
+
+// validateSPIFFEIDPattern confirms the pattern is a valid pattern for SPIFFE IDs.
+func validateSPIFFEIDPattern(pattern string) error {
+	if !strings.HasPrefix(pattern, spiffeIDPrefix) {
+		return fmt.Errorf("SPIFFE ID pattern %q must start with %q", pattern, spiffeIDPrefix)
+	}
+	_, err := path.Match(pattern, "")
+	if err != nil {
+		return fmt.Errorf("invalid SPIFFE ID pattern %q: %s", pattern, err)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package jcp_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/MicahParks/jcp"
+)
+
+const (
+	spiffeKID         = "spiffe-key"
+	spiffePolicy      = "web"
+	spiffeRotatedKID  = "spiffe-rotated"
+	spiffeTrustDomain = "example.org"
+	spiffeWeb         = "spiffe://example.org/ns/prod/sa/web"
+	spiffeX509SVIDKID = "spiffe-x509-svid"
+	spiffeUseJWTSVID  = "jwt-svid"
+	spiffeUseX509SVID = "x509-svid"
+)
+
+type spiffeKey struct {
+	kid     string
+	private ed25519.PrivateKey
+	use     string
+}
+
+func spiffeBundle(t *testing.T, sequence uint64, keys ...spiffeKey) []byte {
+	jwks := make([]map[string]string, 0, len(keys))
+	for _, key := range keys {
+		jwks = append(jwks, map[string]string{
+			"crv": "Ed25519",
+			"kid": key.kid,
+			"kty": "OKP",
+			"use": key.use,
+			"x":   base64.RawURLEncoding.EncodeToString(key.private.Public().(ed25519.PublicKey)),
+		})
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"keys":                jwks,
+		"spiffe_refresh_hint": 3600,
+		"spiffe_sequence":     sequence,
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal SPIFFE bundle: %v.", err)
+	}
+	return data
+}
+
+func TestProxy_SPIFFE(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	newKey := func(kid, use string) spiffeKey {
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v.", err)
+		}
+		return spiffeKey{kid: kid, private: private, use: use}
+	}
+	key := newKey(spiffeKID, spiffeUseJWTSVID)
+	rotated := newKey(spiffeRotatedKID, spiffeUseJWTSVID)
+	x509SVID := newKey(spiffeX509SVIDKID, spiffeUseX509SVID)
+
+	var mux sync.Mutex
+	fetches := 0
+	bundle := spiffeBundle(t, 2, key, x509SVID)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+		fetches++
+		_, _ = w.Write(bundle)
+	}))
+	defer server.Close()
+	fetched := func() int {
+		mux.Lock()
+		defer mux.Unlock()
+		return fetches
+	}
+	serve := func(data []byte) {
+		mux.Lock()
+		defer mux.Unlock()
+		bundle = data
+	}
+
+	proxy, err := jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+		Policies: map[string]jcp.Policy{
+			spiffePolicy: {SPIFFEIDs: []string{"spiffe://example.org/ns/*/sa/web"}},
+		},
+		SPIFFE: map[string]jcp.SPIFFEOptions{
+			spiffeTrustDomain: {
+				Bundle: server.URL,
+				// The refresh hint of the bundle takes precedence.
+				RefreshInterval:  time.Nanosecond,
+				RefreshRateLimit: time.Nanosecond,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	sign := func(key spiffeKey, claims jwt.MapClaims) string {
+		j := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		j.Header[headerKID] = key.kid
+		token, err := j.SignedString(key.private)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return token
+	}
+	svid := func(sub string) jwt.MapClaims {
+		return jwt.MapClaims{
+			"aud": "https://api.example.org",
+			"exp": time.Now().Add(time.Minute).Unix(),
+			"sub": sub,
+		}
+	}
+
+	testCases := []struct {
+		err      error
+		fetches  int
+		name     string
+		policy   string
+		spiffeID string
+		token    string
+	}{
+		{
+			fetches:  1,
+			name:     "Valid",
+			spiffeID: spiffeWeb,
+			token:    sign(key, svid(spiffeWeb)),
+		},
+		{
+			fetches:  1,
+			name:     "PolicyMatch",
+			policy:   spiffePolicy,
+			spiffeID: spiffeWeb,
+			token:    sign(key, svid(spiffeWeb)),
+		},
+		{
+			err:     jcp.ErrSPIFFE,
+			fetches: 1,
+			name:    "PolicyMismatch",
+			policy:  spiffePolicy,
+			token:   sign(key, svid("spiffe://example.org/ns/prod/sa/db")),
+		},
+		{
+			err:     keyfunc.ErrKIDNotFound,
+			fetches: 1,
+			name:    "NotSPIFFEID",
+			policy:  spiffePolicy,
+			token:   sign(key, svid("web")),
+		},
+		{
+			err:     jcp.ErrSPIFFE,
+			fetches: 1,
+			name:    "UntrustedDomain",
+			token:   sign(key, svid("spiffe://example.com/ns/prod/sa/web")),
+		},
+		{
+			err:     jcp.ErrSPIFFE,
+			fetches: 1,
+			name:    "InvalidSPIFFEID",
+			token:   sign(key, svid("spiffe://example.org/ns/../sa/web")),
+		},
+		{
+			err:     jcp.ErrSPIFFE,
+			fetches: 1,
+			name:    "NoAudience",
+			token:   sign(key, jwt.MapClaims{"exp": time.Now().Add(time.Minute).Unix(), "sub": spiffeWeb}),
+		},
+		{
+			err:     keyfunc.ErrKIDNotFound,
+			fetches: 2,
+			name:    "X509SVIDKey",
+			token:   sign(x509SVID, svid(spiffeWeb)),
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := proxy.Validate(ctx, jcp.ValidateArgs{Policy: tc.policy, Token: tc.token})
+			if err != nil || tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+				}
+			}
+			if results.SPIFFEID != tc.spiffeID {
+				t.Fatalf("Expected SPIFFE ID %q, got %q.", tc.spiffeID, results.SPIFFEID)
+			}
+			if n := fetched(); n != tc.fetches {
+				t.Fatalf("Expected %d fetches, got %d.", tc.fetches, n)
+			}
+		})
+	}
+
+	serve(spiffeBundle(t, 1, rotated))
+	_, err = proxy.Validate(ctx, jcp.ValidateArgs{Token: sign(rotated, svid(spiffeWeb))})
+	if !errors.Is(err, keyfunc.ErrKIDNotFound) {
+		t.Fatalf("Expected a SPIFFE bundle with an older sequence to be rejected, got error %v.", err)
+	}
+	serve(spiffeBundle(t, 3, key, rotated))
+	_, err = proxy.Validate(ctx, jcp.ValidateArgs{Token: sign(rotated, svid(spiffeWeb))})
+	if err != nil {
+		t.Fatalf("Failed to validate token signed with a rotated key: %v.", err)
+	}
+
+	// A JWT with a SPIFFE ID subject that was verified by another key source is not a JWT-SVID.
+	shared, err := jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+		HMAC: map[string]jcp.HMACKey{
+			hmacKID: {
+				Issuers: []string{anyNonEmptyString},
+				Secret:  []byte(hmacSecret),
+			},
+		},
+		Policies: map[string]jcp.Policy{
+			spiffePolicy: {SPIFFEIDs: []string{"spiffe://example.org/ns/*/sa/web"}},
+		},
+		SPIFFE: map[string]jcp.SPIFFEOptions{
+			spiffeTrustDomain: {Bundle: server.URL},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+	claims := svid(spiffeWeb)
+	claims["iss"] = anyNonEmptyString
+	j := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	j.Header[headerKID] = hmacKID
+	token, err := j.SignedString([]byte(hmacSecret))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v.", err)
+	}
+	results, err := shared.Validate(ctx, jcp.ValidateArgs{Token: token})
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v.", err)
+	}
+	if results.SPIFFEID != "" {
+		t.Fatalf("Expected no SPIFFE ID for a JWT not verified with a SPIFFE bundle, got %q.", results.SPIFFEID)
+	}
+	_, err = shared.Validate(ctx, jcp.ValidateArgs{Policy: spiffePolicy, Token: token})
+	if !errors.Is(err, jcp.ErrSPIFFE) {
+		t.Fatalf("Expected error %v, got error %v.", jcp.ErrSPIFFE, err)
+	}
+}
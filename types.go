@@ -11,17 +11,64 @@ type ErrorResponse struct {
 	Msg  string      `json:"msg"`
 }
 
+// ExchangeErrorResponse is the error response for a token exchange as defined in RFC 6749 Section 5.2.
+type ExchangeErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// ExchangeResults are the results of a token exchange as defined in RFC 8693 Section 2.2.1.
+type ExchangeResults struct {
+	AccessToken     string `json:"access_token"`
+	ExpiresIn       int64  `json:"expires_in"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+}
+
 // RequestMeta is the metadata for a request.
 type RequestMeta struct {
 	UUID uuid.UUID `json:"uuid"`
 }
 
+// RevocationRequest is the request to add or remove a revocation.
+type RevocationRequest struct {
+	Args Revocation `json:"args"`
+}
+
+// RevocationsResponse is the response for managing revocations.
+type RevocationsResponse struct {
+	Meta    RequestMeta  `json:"meta"`
+	Results []Revocation `json:"results"`
+}
+
 // ValidateArgs are the arguments for a verification request.
 type ValidateArgs struct {
-	Aud   []string `json:"aud"`
-	Iss   []string `json:"iss"`
-	Sub   []string `json:"sub"`
-	Token string   `json:"token"`
+	AccessToken     string                 `json:"accessToken"`
+	Aud             []string               `json:"aud"`
+	ClientCert      string                 `json:"clientCert"`
+	Code            string                 `json:"code"`
+	DPoP            string                 `json:"dpop"`
+	Environments    []string               `json:"environments"`
+	Events          []string               `json:"events"`
+	Expressions     []string               `json:"expressions"`
+	HTM             string                 `json:"htm"`
+	HTU             string                 `json:"htu"`
+	Iss             []string               `json:"iss"`
+	MaxAge          *int64                 `json:"maxAge"`
+	Namespaces      []string               `json:"namespaces"`
+	Nonce           string                 `json:"nonce"`
+	Policy          string                 `json:"policy"`
+	Profile         string                 `json:"profile"`
+	Refs            []string               `json:"refs"`
+	RejectReplay    bool                   `json:"rejectReplay"`
+	Repositories    []string               `json:"repositories"`
+	RequirePod      bool                   `json:"requirePod"`
+	ServiceAccounts []string               `json:"serviceAccounts"`
+	Sub             []string               `json:"sub"`
+	Token           string                 `json:"token"`
+	Txn             string                 `json:"txn"`
+	Variables       map[string]interface{} `json:"variables"`
+	Workflows       []string               `json:"workflows"`
 }
 
 // ValidateRequest is the request for a verification.
@@ -37,5 +84,11 @@ type ValidateResponse struct {
 
 // ValidateResults are the results of a verification.
 type ValidateResults struct {
-	Success bool `json:"success"`
+	Act                *Actor            `json:"act"`
+	CertificateSubject string            `json:"certificateSubject"`
+	Kubernetes         *KubernetesClaims `json:"kubernetes"`
+	Pipeline           *Pipeline         `json:"pipeline"`
+	SecurityEvent      *SecurityEvent    `json:"securityEvent"`
+	SPIFFEID           string            `json:"spiffeID"`
+	Success            bool              `json:"success"`
 }
@@ -0,0 +1,145 @@
+package jcp
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	headerX5C = "x5c"
+	// x5cMaxCerts limits the work done for a single JWT's certificate chain.
+	x5cMaxCerts = 10
+)
+
+// ErrX5C is returned when a JWT's `x5c` header is malformed or its certificate does not meet the requirements.
+var ErrX5C = errors.New("x5c certificate chain rejected")
+
+// extKeyUsages maps the configuration names of extended key usages to their values.
+var extKeyUsages = map[string]x509.ExtKeyUsage{
+	"any":             x509.ExtKeyUsageAny,
+	"clientAuth":      x509.ExtKeyUsageClientAuth,
+	"codeSigning":     x509.ExtKeyUsageCodeSigning,
+	"emailProtection": x509.ExtKeyUsageEmailProtection,
+	"OCSPSigning":     x509.ExtKeyUsageOCSPSigning,
+	"serverAuth":      x509.ExtKeyUsageServerAuth,
+	"timeStamping":    x509.ExtKeyUsageTimeStamping,
+}
+
+// X5COptions are the options for verifying JWTs with the certificate chain in their `x5c` header. The chain must be
+// valid against the CA bundle, then the leaf certificate's key verifies the signature.
+type X5COptions struct {
+	// CABundle is the path to a PEM encoded bundle of trusted CA certificates. The `x5c` header is ignored when empty.
+	CABundle string
+	// ExtKeyUsages are the extended key usages the leaf certificate must be valid for, such as `codeSigning`. Any
+	// extended key usage is accepted when empty.
+	ExtKeyUsages []string
+	// Issuers are the `iss` claims JWTs verified with a certificate chain may have. At least one is required, so a
+	// certificate can not sign JWTs for issuers that have their own JWK Sets.
+	Issuers []string
+	// Subject is a regular expression the leaf certificate's subject distinguished name must match, such as
+	// `^CN=signer\.example\.com(,|$)`.
+	Subject string
+}
+
+type x5cKeySource struct {
+	issuers []string
+	roots   *x509.CertPool
+	subject *regexp.Regexp
+	usages  []x509.ExtKeyUsage
+}
+
+func newX5CKeySource(options X5COptions) (*x5cKeySource, error) {
+	if len(options.Issuers) == 0 {
+		return nil, fmt.Errorf("%w: x5c verification must be bound to at least one issuer", ErrInvalidConfig)
+	}
+	roots, err := loadCertPool(options.CABundle)
+	if err != nil {
+		return nil, err
+	}
+	x := &x5cKeySource{
+		issuers: options.Issuers,
+		roots:   roots,
+	}
+	for _, name := range options.ExtKeyUsages {
+		usage, ok := extKeyUsages[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown extended key usage %q", ErrInvalidConfig, name)
+		}
+		x.usages = append(x.usages, usage)
+	}
+	if options.Subject != "" {
+		x.subject, err = regexp.Compile(options.Subject)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid x5c subject pattern: %s", ErrInvalidConfig, err)
+		}
+	}
+	return x, nil
+}
+
+// Keyfunc helps implement the keyfuncer interface. The chain is verified before the leaf certificate's key is returned.
+func (x *x5cKeySource) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if iss := tokenIssuer(token); !contains(x.issuers, iss) {
+		return nil, fmt.Errorf("%w: issuer %q is not allowed", ErrX5C, iss)
+	}
+	certs, err := x5cChain(token)
+	if err != nil {
+		return nil, err
+	}
+	leaf := certs[0]
+	x5t, x5tS256 := thumbprints(leaf)
+	if h, ok := token.Header[headerX5T].(string); ok && h != x5t {
+		return nil, fmt.Errorf("%w: header %q", ErrThumbprint, headerX5T)
+	}
+	if h, ok := token.Header[headerX5TS256].(string); ok && h != x5tS256 {
+		return nil, fmt.Errorf("%w: header %q", ErrThumbprint, headerX5TS256)
+	}
+	err = verifyChain(certs, x.roots, time.Now(), x.usages)
+	if err != nil {
+		return nil, err
+	}
+	if x.subject != nil && !x.subject.MatchString(leaf.Subject.String()) {
+		return nil, fmt.Errorf("%w: subject %q does not match the pattern", ErrX5C, leaf.Subject.String())
+	}
+	return leaf.PublicKey, nil
+}
+
+// hasX5C reports whether the JWT has an `x5c` header.
+func hasX5C(token *jwt.Token) bool {
+	_, ok := token.Header[headerX5C]
+	return ok
+}
+
+// x5cChain parses the certificate chain in the JWT's `x5c` header. The leaf certificate is first.
+func x5cChain(token *jwt.Token) ([]*x509.Certificate, error) {
+	values, ok := token.Header[headerX5C].([]interface{})
+	if !ok || len(values) == 0 {
+		return nil, fmt.Errorf("%w: header %q must be a non-empty array", ErrX5C, headerX5C)
+	}
+	if len(values) > x5cMaxCerts {
+		return nil, fmt.Errorf("%w: more than %d certificates", ErrX5C, x5cMaxCerts)
+	}
+	certs := make([]*x509.Certificate, 0, len(values))
+	for i, value := range values {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: certificate %d is not a string", ErrX5C, i)
+		}
+		// RFC 7515 Section 4.1.6 uses base64 with padding, not base64url.
+		der, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: certificate %d is not base64 encoded: %s", ErrX5C, i, err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to parse certificate %d: %s", ErrX5C, i, err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
@@ -0,0 +1,196 @@
+package jcp_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/MicahParks/jcp"
+)
+
+const (
+	headerX5C = "x5c"
+	x5cIssuer = "https://signer.example.com"
+)
+
+func TestProxy_X5C(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	ca := createCA(t)
+	intermediate := createCert(t, &x509.Certificate{
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		Subject:               pkix.Name{CommonName: "Test Intermediate"},
+	}, &ca)
+	leaf := createCert(t, &x509.Certificate{
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		Subject:     pkix.Name{CommonName: "signer.example.com", Organization: []string{"Example"}},
+	}, &intermediate)
+	serverLeaf := createCert(t, &x509.Certificate{
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		Subject:     pkix.Name{CommonName: "signer.example.com"},
+	}, &intermediate)
+	otherLeaf := createCert(t, &x509.Certificate{
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		Subject:     pkix.Name{CommonName: "other.example.com"},
+	}, &intermediate)
+	expired := createCert(t, &x509.Certificate{
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		NotAfter:    time.Now().Add(-time.Minute),
+		NotBefore:   time.Now().Add(-time.Hour),
+		Subject:     pkix.Name{CommonName: "signer.example.com"},
+	}, &intermediate)
+	untrusted := createCA(t)
+	untrustedLeaf := createCert(t, &x509.Certificate{
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		Subject:     pkix.Name{CommonName: "signer.example.com"},
+	}, &untrusted)
+
+	proxy, err := jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+		X5C: jcp.X5COptions{
+			CABundle:     writeTemp(t, "ca.pem", certPEM(ca)),
+			ExtKeyUsages: []string{"codeSigning"},
+			Issuers:      []string{x5cIssuer},
+			Subject:      `^CN=[a-z]+\.example\.com(,|$)`,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v.", err)
+	}
+
+	chain := func(certs ...testCert) []interface{} {
+		x5c := make([]interface{}, 0, len(certs))
+		for _, c := range certs {
+			x5c = append(x5c, base64.StdEncoding.EncodeToString(c.der))
+		}
+		return x5c
+	}
+	signWithIssuer := func(iss string, header map[string]interface{}, private *ecdsa.PrivateKey) string {
+		j := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"iss": iss})
+		for k, v := range header {
+			j.Header[k] = v
+		}
+		token, err := j.SignedString(private)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v.", err)
+		}
+		return token
+	}
+	sign := func(header map[string]interface{}, private *ecdsa.PrivateKey) string {
+		return signWithIssuer(x5cIssuer, header, private)
+	}
+
+	results, err := proxy.Validate(ctx, jcp.ValidateArgs{Token: sign(map[string]interface{}{headerX5C: chain(leaf, intermediate)}, leaf.private)})
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v.", err)
+	}
+	if results.CertificateSubject != leaf.cert.Subject.String() {
+		t.Fatalf("Expected certificate subject %q, got %q.", leaf.cert.Subject.String(), results.CertificateSubject)
+	}
+
+	testCases := []struct {
+		err   error
+		name  string
+		token string
+	}{
+		{
+			err:   jcp.ErrCertificate,
+			name:  "MissingIntermediate",
+			token: sign(map[string]interface{}{headerX5C: chain(leaf)}, leaf.private),
+		},
+		{
+			err:   jcp.ErrCertificate,
+			name:  "Untrusted",
+			token: sign(map[string]interface{}{headerX5C: chain(untrustedLeaf, untrusted)}, untrustedLeaf.private),
+		},
+		{
+			err:   jcp.ErrCertificate,
+			name:  "Expired",
+			token: sign(map[string]interface{}{headerX5C: chain(expired, intermediate)}, expired.private),
+		},
+		{
+			err:   jcp.ErrCertificate,
+			name:  "WrongExtKeyUsage",
+			token: sign(map[string]interface{}{headerX5C: chain(serverLeaf, intermediate)}, serverLeaf.private),
+		},
+		{
+			name:  "OtherSubject",
+			token: sign(map[string]interface{}{headerX5C: chain(otherLeaf, intermediate)}, otherLeaf.private),
+		},
+		{
+			err:   jcp.ErrX5C,
+			name:  "SubjectMismatch",
+			token: sign(map[string]interface{}{headerX5C: chain(intermediate, ca)}, intermediate.private),
+		},
+		{
+			err:   jwt.ErrECDSAVerification,
+			name:  "WrongSigner",
+			token: sign(map[string]interface{}{headerX5C: chain(leaf, intermediate)}, otherLeaf.private),
+		},
+		{
+			err:   jcp.ErrX5C,
+			name:  "IssuerNotAllowed",
+			token: signWithIssuer("https://token.actions.githubusercontent.com", map[string]interface{}{headerX5C: chain(leaf, intermediate)}, leaf.private),
+		},
+		{
+			err:   jcp.ErrThumbprint,
+			name:  "ThumbprintMismatch",
+			token: sign(map[string]interface{}{headerX5C: chain(leaf, intermediate), headerX5TS256: anyNonEmptyString}, leaf.private),
+		},
+		{
+			err:   jcp.ErrX5C,
+			name:  "NotArray",
+			token: sign(map[string]interface{}{headerX5C: base64.StdEncoding.EncodeToString(leaf.der)}, leaf.private),
+		},
+		{
+			err:   jcp.ErrX5C,
+			name:  "NotStdEncoding",
+			token: sign(map[string]interface{}{headerX5C: []interface{}{base64.RawURLEncoding.EncodeToString(leaf.der) + "-_"}}, leaf.private),
+		},
+		{
+			err:   jwt.ErrTokenUnverifiable,
+			name:  "NoX5C",
+			token: sign(map[string]interface{}{headerKID: testKID}, leaf.private),
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := proxy.Validate(ctx, jcp.ValidateArgs{Token: tc.token})
+			if err != nil || tc.err != nil {
+				if errors.Is(err, tc.err) {
+					return
+				}
+				t.Fatalf("Expected error %v, got error %v.", tc.err, err)
+			}
+		})
+	}
+
+	_, err = jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+		X5C: jcp.X5COptions{
+			CABundle:     writeTemp(t, "ca.pem", certPEM(ca)),
+			ExtKeyUsages: []string{anyNonEmptyString},
+			Issuers:      []string{x5cIssuer},
+		},
+	})
+	if !errors.Is(err, jcp.ErrInvalidConfig) {
+		t.Fatalf("Expected error %v, got error %v.", jcp.ErrInvalidConfig, err)
+	}
+	_, err = jcp.NewProxyWithOptions(nil, jcp.ProxyOptions{
+		X5C: jcp.X5COptions{
+			CABundle: writeTemp(t, "ca.pem", certPEM(ca)),
+		},
+	})
+	if !errors.Is(err, jcp.ErrInvalidConfig) {
+		t.Fatalf("Expected error %v, got error %v.", jcp.ErrInvalidConfig, err)
+	}
+}